@@ -3,25 +3,242 @@ package tecnocratica
 import (
 	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	mathrand "math/rand/v2"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	userAgent      = "tecnocratica-libdns/1.0"
+	modulePath     = "github.com/libdns/tecnocratica"
 	DefaultBaseURL = "https://api.neodigit.net/v1"
+
+	// DefaultAPIPathPrefix is the path prefix used when Provider.APIPathPrefix is not set.
+	DefaultAPIPathPrefix = "dns"
+
+	// DefaultAuthHeaderName is the header carrying the API token when
+	// Provider.AuthHeaderName is not set.
+	DefaultAuthHeaderName = "X-TCpanel-Token"
+
+	// DefaultMaxResponseBytes is the response size limit used when
+	// Provider.MaxResponseBytes is not set.
+	DefaultMaxResponseBytes = 10 << 20
+)
+
+var (
+	// ErrResponseTooLarge is returned when an API response exceeds the size limit.
+	ErrResponseTooLarge = errors.New("response body too large")
+
+	// ErrUnauthorized is returned when the API rejects the token.
+	ErrUnauthorized = errors.New("API token rejected")
+
+	// ErrConflict is returned when a conditional update fails because the
+	// record was changed since it was read.
+	ErrConflict = errors.New("record was modified concurrently")
+
+	// ErrRecordExists is returned when a record cannot be created because the
+	// zone already holds the same record.
+	ErrRecordExists = errors.New("record already exists")
 )
 
+// APIError is returned when the API answers with a non-2xx status code.
+// It matches ErrUnauthorized and ErrConflict with errors.Is for the statuses
+// they stand for.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Message is the error message from the JSON error body, if there was one.
+	Message string
+
+	// Raw is the response body, truncated to the response size limit.
+	Raw []byte
+
+	request string
+
+	// retryAfter is the wait the API asked for with a Retry-After header, if any
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	prefix := "unexpected status code"
+	if sentinel := e.sentinel(); sentinel != nil {
+		prefix = sentinel.Error()
+	}
+
+	if e.Message != "" {
+		return fmt.Sprintf("%s: status code: %d, request: %s, message: %s", prefix, e.StatusCode, e.request, e.Message)
+	}
+
+	return fmt.Sprintf("%s: status code: %d, request: %s, response: %s", prefix, e.StatusCode, e.request, e.Raw)
+}
+
+// Is reports whether the error stands for target.
+func (e *APIError) Is(target error) bool {
+	sentinel := e.sentinel()
+	return sentinel != nil && sentinel == target
+}
+
+// sentinel returns the package error matching the status code, if any.
+func (e *APIError) sentinel() error {
+	switch e.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return ErrUnauthorized
+	case http.StatusPreconditionFailed:
+		return ErrConflict
+	default:
+		return nil
+	}
+}
+
+// duplicateRecordError wraps err with ErrRecordExists when the API rejected a
+// creation because the record already exists: a 409, or a 400 or 422 whose
+// message says so.
+func duplicateRecordError(err error) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusConflict:
+		return fmt.Errorf("%w: %w", ErrRecordExists, err)
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		msg := strings.ToLower(apiErr.Message)
+		if strings.Contains(msg, "already exists") || strings.Contains(msg, "duplicate") || strings.Contains(msg, "already been taken") {
+			return fmt.Errorf("%w: %w", ErrRecordExists, err)
+		}
+	}
+
+	return err
+}
+
+// apiErrorMessage extracts the message from a JSON error body such as
+// {"message": "..."}, {"error": "..."} or {"error": {"message": "..."}}.
+func apiErrorMessage(raw []byte) string {
+	var body struct {
+		Message string          `json:"message"`
+		Error   json.RawMessage `json:"error"`
+	}
+
+	err := json.Unmarshal(raw, &body)
+	if err != nil {
+		return ""
+	}
+
+	if body.Message != "" {
+		return body.Message
+	}
+
+	var message string
+	if json.Unmarshal(body.Error, &message) == nil {
+		return message
+	}
+
+	var nested struct {
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body.Error, &nested) == nil {
+		return nested.Message
+	}
+
+	return ""
+}
+
+// userAgent identifies the library, and its version, to the API.
+var userAgent = "tecnocratica-libdns/" + moduleVersion()
+
+// moduleVersion returns the version of this module as recorded in the build
+// information of the binary, or "devel" when it is not available.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+
+	modules := append([]*debug.Module{&info.Main}, info.Deps...)
+	for _, mod := range modules {
+		if mod.Path == modulePath && mod.Version != "" && mod.Version != "(devel)" {
+			return strings.TrimPrefix(mod.Version, "v")
+		}
+	}
+
+	return "devel"
+}
+
+// apiTokenKey is the context key holding a per-call API token.
+type apiTokenKey struct{}
+
+// WithAPIToken returns a copy of ctx carrying an API token that takes precedence
+// over Provider.APIToken for the calls made with it. This lets a single Provider
+// serve several accounts.
+func WithAPIToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, apiTokenKey{}, token)
+}
+
+// tracerKey is the context key holding a per-call Tracer.
+type tracerKey struct{}
+
+// WithTracer returns a copy of ctx carrying a Tracer that takes precedence over
+// Provider.Tracer for the calls made with it.
+func WithTracer(ctx context.Context, tracer Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tracer)
+}
+
+// operationKey is the context key naming the API call being made, for tracing.
+type operationKey struct{}
+
+// operation names an API call and the zone it is about.
+type operation struct {
+	name   string
+	zoneID int
+}
+
+// withOperation returns a copy of ctx naming the API call made with it.
+func withOperation(ctx context.Context, name string, zoneID int) context.Context {
+	return context.WithValue(ctx, operationKey{}, operation{name: name, zoneID: zoneID})
+}
+
 // Client is a Neodigit API client.
 type Client struct {
 	token      string
 	BaseURL    *url.URL
 	HTTPClient *http.Client
+
+	pathPrefix       string
+	authHeader       string
+	bearerAuth       bool
+	retries          *retryBudget
+	bulkCreate       bool
+	noBulkCreate     *atomic.Bool
+	pacer            *pacer
+	throttle         *throttle
+	qps              float64
+	onRateLimit      func(RateLimit)
+	rateLimitMu      sync.Mutex
+	rateLimit        *RateLimit
+	logger           Logger
+	tracer           Tracer
+	metrics          Metrics
+	userAgent        string
+	requestModifier  func(*http.Request)
+	recorder         *RequestRecorder
+	includeDisabled  bool
+	maxResponseBytes int64
 }
 
 // NewClient creates a new Client.
@@ -36,23 +253,138 @@ func newClient(p *Provider) (*Client, error) {
 		return nil, fmt.Errorf("invalid API URL: %w", err)
 	}
 
-	return &Client{
-		token:      p.APIToken,
-		BaseURL:    parsedURL,
-		HTTPClient: &http.Client{Timeout: 30 * time.Second},
-	}, nil
+	// The token travels in a header, so it must not be sent in cleartext
+	if parsedURL.Scheme != "https" && !p.AllowInsecureHTTP {
+		return nil, fmt.Errorf("API URL %s does not use HTTPS; set AllowInsecureHTTP to send the API token in cleartext", baseURL)
+	}
+
+	if p.ApexNotation != "" && p.ApexNotation != ApexNotationAt && p.ApexNotation != ApexNotationZone {
+		return nil, fmt.Errorf("invalid apex notation %q: want %q or %q", p.ApexNotation, ApexNotationAt, ApexNotationZone)
+	}
+
+	_, err = tlsVersion(p.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	// A leading slash would replace the path of the base URL
+	if strings.HasPrefix(p.APIPathPrefix, "/") {
+		return nil, fmt.Errorf("invalid API path prefix %q: must not start with a slash", p.APIPathPrefix)
+	}
+
+	client := &Client{
+		token:        p.APIToken,
+		BaseURL:      parsedURL,
+		HTTPClient:   p.httpClient(),
+		logger:       p.Logger,
+		tracer:       p.Tracer,
+		metrics:      p.Metrics,
+		pathPrefix:   p.APIPathPrefix,
+		bulkCreate:   p.BulkCreate,
+		noBulkCreate: &p.noBulkCreate,
+		authHeader:   p.AuthHeaderName,
+		bearerAuth:   p.BearerAuth,
+
+		onRateLimit:      p.OnRateLimit,
+		requestModifier:  p.RequestModifier,
+		recorder:         p.Recorder,
+		includeDisabled:  p.IncludeDisabled,
+		maxResponseBytes: p.MaxResponseBytes,
+	}
+
+	if p.UserAgent != "" {
+		client.userAgent = p.UserAgent + " " + userAgent
+	}
+
+	if p.RetryBudget > 0 {
+		client.retries = &retryBudget{tokens: p.RetryBudget}
+	}
+
+	if p.PaceRateLimit {
+		p.pacerOnce.Do(func() { p.pacer = new(pacer) })
+		client.pacer = p.pacer
+	}
+
+	if p.RequestsPerSecond > 0 {
+		client.throttle = &p.throttle
+		client.qps = p.RequestsPerSecond
+	}
+
+	return client, nil
+}
+
+// httpClient returns the HTTP client used to reach the API.
+// When transport settings are configured, a single transport is built and shared
+// by every client of the provider so that idle connections are reused.
+func (p *Provider) httpClient() *http.Client {
+	if p.MaxIdleConns <= 0 && p.MaxIdleConnsPerHost <= 0 && p.IdleConnTimeout <= 0 && p.TLSMinVersion == "" {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+
+	p.transportOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if p.MaxIdleConns > 0 {
+			transport.MaxIdleConns = p.MaxIdleConns
+		}
+		if p.MaxIdleConnsPerHost > 0 {
+			transport.MaxIdleConnsPerHost = p.MaxIdleConnsPerHost
+		}
+		if p.IdleConnTimeout > 0 {
+			transport.IdleConnTimeout = p.IdleConnTimeout
+		}
+		if p.TLSMinVersion != "" {
+			// Validated by newClient
+			minVersion, _ := tlsVersion(p.TLSMinVersion)
+			transport.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+
+			// A custom TLS config disables HTTP/2 unless it is asked for
+			transport.ForceAttemptHTTP2 = true
+		}
+		p.transport = transport
+	})
+
+	return &http.Client{Timeout: 30 * time.Second, Transport: p.transport}
+}
+
+// tlsVersion parses Provider.TLSMinVersion. An empty version gives zero, which
+// leaves the crypto/tls default in place.
+func tlsVersion(version string) (uint16, error) {
+	switch version {
+	case "":
+		return 0, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.0", "1.1":
+		return 0, fmt.Errorf("TLS version %s is too old: want 1.2 or 1.3", version)
+	default:
+		return 0, fmt.Errorf("invalid TLS version %q: want 1.2 or 1.3", version)
+	}
+}
+
+// endpoint returns the URL of an API path below the base URL and path prefix.
+func (c *Client) endpoint(elem ...string) *url.URL {
+	pathPrefix := c.pathPrefix
+	if pathPrefix == "" {
+		pathPrefix = DefaultAPIPathPrefix
+	}
+
+	return c.BaseURL.JoinPath(append([]string{pathPrefix}, elem...)...)
 }
 
 // GetZones lists all DNS zones.
 func (c *Client) getZones(ctx context.Context) ([]Zone, error) {
-	endpoint := c.BaseURL.JoinPath("dns", "zones")
+	ctx = withOperation(ctx, "getZones", 0)
+
+	endpoint := c.endpoint("zones")
 
 	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var zones []Zone
+	var zones listResponse[Zone]
 
 	err = c.do(req, &zones)
 	if err != nil {
@@ -62,22 +394,109 @@ func (c *Client) getZones(ctx context.Context) ([]Zone, error) {
 	return zones, nil
 }
 
+// createZone creates a zone with the given name.
+func (c *Client) createZone(ctx context.Context, name string) (*Zone, error) {
+	ctx = withOperation(ctx, "createZone", 0)
+
+	endpoint := c.endpoint("zones")
+
+	payload := ZoneRequest{Zone: NewZone{Name: name}}
+
+	req, err := doJSONRequest(ctx, http.MethodPost, endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var result Zone
+
+	err = c.do(req, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// deleteZone deletes a zone along with its records.
+func (c *Client) deleteZone(ctx context.Context, zoneID int) error {
+	ctx = withOperation(ctx, "deleteZone", zoneID)
+
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID))
+
+	req, err := doJSONRequest(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	return c.do(req, nil)
+}
+
+// getAPIInfo requests the version and features of the API. The endpoint is not
+// documented; it is assumed to live next to the DNS endpoints, outside the DNS
+// path prefix.
+func (c *Client) getAPIInfo(ctx context.Context) (*APIInfo, error) {
+	ctx = withOperation(ctx, "getAPIInfo", 0)
+
+	endpoint := c.BaseURL.JoinPath("version")
+
+	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var info APIInfo
+
+	err = c.do(req, &info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+// Probe checks that the base URL serves the API by requesting the zone list
+// and making sure a JSON document comes back.
+func (c *Client) probe(ctx context.Context) error {
+	ctx = withOperation(ctx, "probe", 0)
+
+	endpoint := c.endpoint("zones")
+
+	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	var raw json.RawMessage
+
+	err = c.do(req, &raw)
+	if err != nil {
+		return fmt.Errorf("configured API URL %v does not appear to be a Neodigit API: %w", c.BaseURL, err)
+	}
+
+	return nil
+}
+
 // GetRecords lists all records in a zone.
 func (c *Client) getRecords(ctx context.Context, zoneID int, recordType string) ([]Record, error) {
-	endpoint := c.BaseURL.JoinPath("dns", "zones", strconv.Itoa(zoneID), "records")
+	ctx = withOperation(ctx, "getRecords", zoneID)
 
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records")
+
+	query := endpoint.Query()
 	if recordType != "" {
-		query := endpoint.Query()
 		query.Set("type", recordType)
-		endpoint.RawQuery = query.Encode()
 	}
+	if c.includeDisabled {
+		query.Set("include_disabled", "true")
+	}
+	endpoint.RawQuery = query.Encode()
 
 	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var records []Record
+	var records listResponse[Record]
 
 	err = c.do(req, &records)
 	if err != nil {
@@ -87,114 +506,1029 @@ func (c *Client) getRecords(ctx context.Context, zoneID int, recordType string)
 	return records, nil
 }
 
-// CreateRecord creates a new DNS record.
-func (c *Client) createRecord(ctx context.Context, zoneID int, record Record) (*Record, error) {
-	endpoint := c.BaseURL.JoinPath("dns", "zones", strconv.Itoa(zoneID), "records")
+// GetRecordRaw fetches a single record as the untouched JSON returned by the API.
+func (c *Client) getRecordRaw(ctx context.Context, zoneID, recordID int) (json.RawMessage, error) {
+	ctx = withOperation(ctx, "getRecordRaw", zoneID)
 
-	payload := RecordRequest{Record: record}
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
 
-	req, err := doJSONRequest(ctx, http.MethodPost, endpoint, payload)
+	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	var result Record
+	var raw json.RawMessage
 
-	err = c.do(req, &result)
+	err = c.do(req, &raw)
 	if err != nil {
 		return nil, err
 	}
 
-	return &result, nil
+	return raw, nil
 }
 
-// UpdateRecord updates an existing DNS record.
-func (c *Client) updateRecord(ctx context.Context, zoneID, recordID int, record Record) (*Record, error) {
-	endpoint := c.BaseURL.JoinPath("dns", "zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
+// GetRecord fetches a single record, along with its ETag when the API sends one.
+func (c *Client) getRecord(ctx context.Context, zoneID, recordID int) (*Record, error) {
+	ctx = withOperation(ctx, "getRecord", zoneID)
 
-	payload := RecordRequest{Record: record}
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
 
-	req, err := doJSONRequest(ctx, http.MethodPut, endpoint, payload)
+	req, err := doJSONRequest(ctx, http.MethodGet, endpoint, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var result Record
 
-	err = c.do(req, &result)
+	header, err := c.doResponse(req, &result)
 	if err != nil {
 		return nil, err
 	}
 
+	if etag := header.Get("ETag"); etag != "" {
+		result.ETag = etag
+	}
+
 	return &result, nil
 }
 
-// DeleteRecord deletes a DNS record.
-func (c *Client) deleteRecord(ctx context.Context, zoneID, recordID int) error {
-	endpoint := c.BaseURL.JoinPath("dns", "zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
-
-	req, err := doJSONRequest(ctx, http.MethodDelete, endpoint, nil)
+// CreateRecord creates a new DNS record.
+//
+// Every attempt carries the same Idempotency-Key header. When the request fails
+// without a response, e.g. on a timeout, the record may still have been created,
+// so the zone is checked for an identical record before the creation is retried
+// once. Like other retries, this takes one retry from Provider.RetryBudget, so
+// without a budget a failed creation is not checked or sent again.
+func (c *Client) createRecord(ctx context.Context, zoneID int, zone string, record Record) (*Record, error) {
+	key, err := newIdempotencyKey()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return c.do(req, nil)
-}
+	result, err := c.postRecord(ctx, zoneID, zone, record, key)
 
-func (c *Client) do(req *http.Request, result any) error {
-	req.Header.Set("X-TCpanel-Token", c.token)
+	var urlErr *url.Error
+	if err == nil || !errors.As(err, &urlErr) || permanentTransportError(err) || ctx.Err() != nil {
+		return result, err
+	}
+	if !c.retries.take() {
+		return nil, err
+	}
 
-	resp, err := c.HTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("unexpected http error: request: %v, error: %w", req.URL, err)
+	c.logf("creating %s %s failed, checking whether it was created: %v", record.Name, record.Type, err)
+
+	existing, listErr := c.getRecords(ctx, zoneID, record.Type)
+	if listErr != nil {
+		return nil, err
 	}
 
-	defer func() { _ = resp.Body.Close() }()
+	for _, rec := range existing {
+		if sameRecordName(zone, rec.Name, record.Name) && sameContent(rec, record) && rec.Priority == record.Priority {
+			c.count(MetricRecordsCreated, 1)
+			return &rec, nil
+		}
+	}
 
-	if resp.StatusCode/100 != 2 {
-		raw, _ := io.ReadAll(resp.Body)
+	return c.postRecord(ctx, zoneID, zone, record, key)
+}
 
-		return fmt.Errorf("unexpected status code: %d, request: %v, response: %s", resp.StatusCode, req.URL, raw)
+// createRecords creates several records. They are created one by one, and a failed
+// creation does not stop the others: the created records are returned together with
+// an error joining one error per failed record. Once ctx is done, the remaining
+// records are not attempted and are reported in a single error.
+//
+// With Provider.BulkCreate set, they are created with a single request to the bulk
+// endpoint instead. When the API has no bulk endpoint (404 or 405), the records are
+// created one by one after all, and the API is not asked again for the lifetime of
+// the provider, unless Provider.GetAPIInfo later reports FeatureBulkCreate.
+func (c *Client) createRecords(ctx context.Context, zoneID int, zone string, records []Record) ([]Record, error) {
+	if len(records) > 1 && c.bulkCreate && (c.noBulkCreate == nil || !c.noBulkCreate.Load()) {
+		result, err := c.postRecords(ctx, zoneID, zone, records)
+		if err == nil {
+			return result, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || (apiErr.StatusCode != http.StatusNotFound && apiErr.StatusCode != http.StatusMethodNotAllowed) {
+			descriptions := make([]string, len(records))
+			for i, record := range records {
+				descriptions[i] = describeRecord(record)
+			}
+			return nil, fmt.Errorf("failed to create records %s: %w", strings.Join(descriptions, ", "), err)
+		}
+
+		c.logf("bulk record creation not supported, creating records one by one: %v", err)
+
+		if c.noBulkCreate != nil {
+			c.noBulkCreate.Store(true)
+		}
 	}
 
-	if result == nil {
-		return nil
+	var created []Record
+	var errs []error
+	for i, record := range records {
+		if err := ctx.Err(); err != nil {
+			descriptions := make([]string, 0, len(records)-i)
+			for _, record := range records[i:] {
+				descriptions = append(descriptions, describeRecord(record))
+			}
+			errs = append(errs, fmt.Errorf("records not created: %s: %w", strings.Join(descriptions, ", "), err))
+			break
+		}
+
+		result, err := c.createRecord(ctx, zoneID, zone, record)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to create record %s: %w", describeRecord(record), err))
+			continue
+		}
+		created = append(created, *result)
 	}
 
-	raw, err := io.ReadAll(resp.Body)
+	return created, errors.Join(errs...)
+}
+
+// postRecords sends a bulk record creation request.
+func (c *Client) postRecords(ctx context.Context, zoneID int, zone string, records []Record) ([]Record, error) {
+	ctx = withOperation(ctx, "createRecords", zoneID)
+
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records", "bulk")
+
+	payload := RecordsRequest{Records: records}
+
+	req, err := doJSONRequest(ctx, http.MethodPost, endpoint, payload)
 	if err != nil {
-		return fmt.Errorf("error reading response: status: %d, request: %v, error: %w", resp.StatusCode, req.URL, err)
+		return nil, err
 	}
 
-	err = json.Unmarshal(raw, result)
+	key, err := newIdempotencyKey()
 	if err != nil {
-		return fmt.Errorf("error unmarshaling response: status: %d, request: %v, response: %s, error: %w", resp.StatusCode, req.URL, raw, err)
+		return nil, err
 	}
+	req.Header.Set("Idempotency-Key", key)
 
-	return nil
+	var result listResponse[Record]
+
+	err = c.do(req, &result)
+	if err != nil {
+		return nil, duplicateRecordError(err)
+	}
+
+	if len(result) != 0 && len(result) != len(records) {
+		return nil, fmt.Errorf("bulk creation of %d records returned %d records", len(records), len(result))
+	}
+
+	c.count(MetricRecordsCreated, len(records))
+
+	return c.recoverRecordIDs(ctx, zoneID, zone, records, result)
 }
 
-func doJSONRequest(ctx context.Context, method string, endpoint *url.URL, payload any) (*http.Request, error) {
-	body := new(bytes.Buffer)
+// postRecord sends a single record creation request.
+func (c *Client) postRecord(ctx context.Context, zoneID int, zone string, record Record, idempotencyKey string) (*Record, error) {
+	ctx = withOperation(ctx, "createRecord", zoneID)
 
-	if payload != nil {
-		err := json.NewEncoder(body).Encode(payload)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create request JSON body: %w", err)
-		}
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records")
+
+	payload := RecordRequest{Record: record}
+
+	req, err := doJSONRequest(ctx, http.MethodPost, endpoint, payload)
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+
+	var result Record
+
+	err = c.do(req, &result)
 	if err != nil {
-		return nil, fmt.Errorf("unable to create request: %w", err)
+		return nil, duplicateRecordError(err)
 	}
 
-	req.Header.Set("User-Agent", userAgent)
-	req.Header.Set("Accept", "application/json")
+	c.count(MetricRecordsCreated, 1)
 
-	if payload != nil {
-		req.Header.Set("Content-Type", "application/json")
+	created, err := c.recoverRecordIDs(ctx, zoneID, zone, []Record{record}, []Record{result})
+	if err != nil {
+		return nil, err
 	}
 
-	return req, nil
+	return &created[0], nil
+}
+
+// recoverRecordIDs fills in the IDs a creation response lacked by looking the
+// created records up in the zone. Some API versions answer a creation with an
+// empty body or without the record ID, which would leave the records impossible
+// to update or delete by ID later. An empty created slice stands for the sent
+// records. When several records match, the newest one is taken. Names are
+// compared within zone, the name of the zone, so the apex matches in either
+// notation.
+func (c *Client) recoverRecordIDs(ctx context.Context, zoneID int, zone string, sent, created []Record) ([]Record, error) {
+	if len(created) == 0 {
+		created = slices.Clone(sent)
+	}
+
+	if !slices.ContainsFunc(created, func(rec Record) bool { return rec.ID == 0 }) {
+		return created, nil
+	}
+
+	c.logf("creation response for zone %d lacks record IDs, looking the records up", zoneID)
+
+	existing, err := c.getRecords(ctx, zoneID, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the created records: %w", err)
+	}
+
+	taken := make(map[int]bool)
+	for _, rec := range created {
+		taken[rec.ID] = true
+	}
+
+	for i, rec := range created {
+		if rec.ID != 0 {
+			continue
+		}
+
+		want := sent[i]
+		for _, candidate := range existing {
+			if !taken[candidate.ID] && candidate.ID > created[i].ID && candidate.Type == want.Type &&
+				sameRecordName(zone, candidate.Name, want.Name) && sameContent(candidate, want) && candidate.Priority == want.Priority {
+				created[i] = candidate
+			}
+		}
+
+		if created[i].ID == 0 {
+			return nil, fmt.Errorf("created record %s %s not found in zone %d", want.Name, want.Type, zoneID)
+		}
+		taken[created[i].ID] = true
+	}
+
+	return created, nil
+}
+
+// newIdempotencyKey returns a random key identifying one logical record creation.
+func newIdempotencyKey() (string, error) {
+	buf := make([]byte, 16)
+
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", fmt.Errorf("unable to generate idempotency key: %w", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// UpdateRecord updates an existing DNS record.
+// When the record carries an ETag, the update is conditional on it and fails
+// with ErrConflict if the record was changed in the meantime.
+func (c *Client) updateRecord(ctx context.Context, zoneID, recordID int, record Record) (*Record, error) {
+	ctx = withOperation(ctx, "updateRecord", zoneID)
+
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
+
+	payload := struct {
+		Record recordUpdate `json:"record"`
+	}{Record: recordUpdate{Record: record, Disabled: record.Disabled, Proxied: record.Proxied, Comment: record.Comment}}
+
+	req, err := doJSONRequest(ctx, http.MethodPut, endpoint, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.ETag != "" {
+		req.Header.Set("If-Match", record.ETag)
+	}
+
+	var result Record
+
+	header, err := c.doResponse(req, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	if etag := header.Get("ETag"); etag != "" {
+		result.ETag = etag
+	}
+
+	c.count(MetricRecordsUpdated, 1)
+
+	return &result, nil
+}
+
+// DeleteRecord deletes a DNS record. Any 2xx status is a success, whether or
+// not the API sends a body along.
+func (c *Client) deleteRecord(ctx context.Context, zoneID, recordID int) error {
+	ctx = withOperation(ctx, "deleteRecord", zoneID)
+
+	endpoint := c.endpoint("zones", strconv.Itoa(zoneID), "records", strconv.Itoa(recordID))
+
+	req, err := doJSONRequest(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	err = c.do(req, nil)
+	if err != nil {
+		return err
+	}
+
+	c.count(MetricRecordsDeleted, 1)
+
+	return nil
+}
+
+func (c *Client) do(req *http.Request, result any) error {
+	_, err := c.doResponse(req, result)
+	return err
+}
+
+// count reports a counter increment to the configured Metrics, if any.
+func (c *Client) count(name string, delta int) {
+	if c.metrics != nil && delta > 0 {
+		c.metrics.Add(name, delta)
+	}
+}
+
+// doResponse is like do but also returns the headers of the response.
+func (c *Client) doResponse(req *http.Request, result any) (http.Header, error) {
+	header, err := c.traceResponse(req, result)
+	if err != nil {
+		c.count(MetricAPIErrors, 1)
+	}
+
+	return header, err
+}
+
+// traceResponse sends the request, wrapped in a span when a tracer is set.
+func (c *Client) traceResponse(req *http.Request, result any) (http.Header, error) {
+	tracer := c.tracer
+	if ctxTracer, ok := req.Context().Value(tracerKey{}).(Tracer); ok && ctxTracer != nil {
+		tracer = ctxTracer
+	}
+
+	if tracer == nil {
+		_, header, err := c.sendRetrying(req, result)
+		return header, err
+	}
+
+	op, _ := req.Context().Value(operationKey{}).(operation)
+
+	ctx, span := tracer.Start(req.Context(), "tecnocratica."+op.name)
+	defer span.End()
+
+	span.SetAttribute("http.request.method", req.Method)
+	span.SetAttribute("url.full", req.URL.String())
+	if op.zoneID != 0 {
+		span.SetAttribute("tecnocratica.zone_id", op.zoneID)
+	}
+
+	statusCode, header, err := c.sendRetrying(req.WithContext(ctx), result)
+	if statusCode != 0 {
+		span.SetAttribute("http.response.status_code", statusCode)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+
+	return header, err
+}
+
+// retryBaseDelay is the wait before the first retry; it grows linearly with each attempt.
+var retryBaseDelay = 250 * time.Millisecond
+
+// maxRetryAfter is the longest Retry-After the client waits for before a retry;
+// a request the API asks to delay for longer fails instead.
+const maxRetryAfter = time.Minute
+
+// retryBudget bounds the number of retries made by all the requests of a client,
+// so a batch operation against a flaky API does not multiply its retries.
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens int
+}
+
+// take consumes a retry from the budget, reporting false when none is left.
+// A nil budget allows no retries.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.tokens <= 0 {
+		return false
+	}
+	b.tokens--
+
+	return true
+}
+
+// sendRetrying sends the request and retries transient failures while the retry
+// budget lasts, honouring the Retry-After header of 429 and 503 responses. A
+// retried deletion answered with 404 succeeded. Creations are only retried when
+// it is safe, see retrySafe.
+func (c *Client) sendRetrying(req *http.Request, result any) (int, http.Header, error) {
+	// Every attempt starts from the headers of the caller, so the request modifier
+	// sees the same request each time and the recorder knows what it added
+	original := req.Header.Clone()
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			req.Header = original.Clone()
+		}
+
+		statusCode, header, err := c.send(req, result)
+
+		// A deletion sent again may find the record already deleted by an earlier
+		// attempt whose response was lost
+		if attempt > 1 && req.Method == http.MethodDelete && statusCode == http.StatusNotFound {
+			return statusCode, header, nil
+		}
+
+		if err == nil || !retryable(err) || !retrySafe(req, err) {
+			return statusCode, header, err
+		}
+
+		delay, ok := retryDelay(attempt, err)
+		if !ok || !c.retries.take() {
+			return statusCode, header, err
+		}
+
+		c.logf("retrying %s %v in %v after attempt %d: %v", req.Method, req.URL, delay, attempt, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return statusCode, header, err
+		case <-timer.C:
+		}
+
+		if req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return statusCode, header, err
+			}
+			req.Body = body
+		}
+	}
+}
+
+// retrySafe reports whether req may be sent again after failing with err. A
+// creation is only sent again when it carries an Idempotency-Key and the API
+// answered; after a failure without a response, createRecord first checks
+// whether the record was created.
+func retrySafe(req *http.Request, err error) bool {
+	if req.Method != http.MethodPost {
+		return true
+	}
+
+	var apiErr *APIError
+	return req.Header.Get("Idempotency-Key") != "" && errors.As(err, &apiErr)
+}
+
+// retryDelay returns the wait before retrying a request that failed with err:
+// the Retry-After the API sent, or a delay growing with the attempts. It reports
+// false when the API asked to wait longer than maxRetryAfter.
+func retryDelay(attempt int, err error) (time.Duration, bool) {
+	delay := time.Duration(attempt) * retryBaseDelay
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		if apiErr.retryAfter > maxRetryAfter {
+			return 0, false
+		}
+		delay = apiErr.retryAfter
+	}
+
+	return delay, true
+}
+
+// parseRetryAfter parses a Retry-After header, given either in seconds or as an
+// HTTP date. It returns zero when the header is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0)
+	}
+
+	return 0
+}
+
+// retryable reports whether a failed request may succeed when sent again: the
+// API was unreachable, overloaded or failed internally.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) && !permanentTransportError(err)
+}
+
+// permanentTransportError reports whether err is a transport failure that sending
+// the request again cannot fix: the certificate of the API was rejected, or the
+// server does not speak TLS.
+func permanentTransportError(err error) bool {
+	var (
+		verifyErr    *tls.CertificateVerificationError
+		authorityErr x509.UnknownAuthorityError
+		hostnameErr  x509.HostnameError
+		invalidErr   x509.CertificateInvalidError
+		headerErr    tls.RecordHeaderError
+	)
+
+	return errors.As(err, &verifyErr) || errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &headerErr)
+}
+
+// send makes the request and decodes the response into result. It returns the
+// status code, or zero when no response was received.
+func (c *Client) send(req *http.Request, result any) (int, http.Header, error) {
+	token := c.token
+	if ctxToken, ok := req.Context().Value(apiTokenKey{}).(string); ok && ctxToken != "" {
+		token = ctxToken
+	}
+
+	header := c.authHeader
+	if header == "" {
+		header = DefaultAuthHeaderName
+		if c.bearerAuth {
+			header = "Authorization"
+		}
+	}
+
+	if c.bearerAuth {
+		token = "Bearer " + token
+	}
+	req.Header.Set(header, token)
+
+	if c.userAgent != "" {
+		req.Header.Set("User-Agent", c.userAgent)
+	}
+
+	// The headers as they were before the modifier, which may add credentials
+	var unmodified http.Header
+	if c.requestModifier != nil {
+		unmodified = req.Header.Clone()
+		c.requestModifier(req)
+	}
+
+	if c.throttle != nil {
+		err := c.throttle.wait(req.Context(), c.qps)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if c.pacer != nil {
+		err := c.pacer.wait(req.Context())
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	c.record(req, header, unmodified, resp, err)
+	if err != nil {
+		c.logf("%s %v: %v", req.Method, req.URL, err)
+
+		// A cancelled or expired context is reported as such, not as a network failure
+		if ctxErr := req.Context().Err(); ctxErr != nil {
+			return 0, nil, fmt.Errorf("request %v: %w", req.URL, ctxErr)
+		}
+
+		return 0, nil, fmt.Errorf("unexpected http error: request: %v, error: %w", req.URL, err)
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	c.logf("%s %v: %d", req.Method, req.URL, resp.StatusCode)
+
+	if c.pacer != nil {
+		c.pacer.update(resp.Header)
+	}
+
+	c.captureRateLimit(resp.Header)
+
+	if resp.StatusCode/100 != 2 {
+		// A body over the limit is only truncated here, the status code is the error
+		raw, _ := c.readBody(resp)
+
+		return resp.StatusCode, nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    apiErrorMessage(raw),
+			Raw:        raw,
+			request:    req.URL.String(),
+			retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	if result == nil {
+		// Drain any body, e.g. a confirmation sent with a 200, so the connection can be reused
+		_, _ = c.readBody(resp)
+		return resp.StatusCode, resp.Header, nil
+	}
+
+	raw, err := c.readBody(resp)
+	if err == nil && resp.StatusCode == http.StatusCreated && len(bytes.TrimSpace(raw)) == 0 {
+		// Some API versions confirm a creation without a body, leaving result as it is
+		return resp.StatusCode, resp.Header, nil
+	}
+	if ctxErr := req.Context().Err(); err != nil && ctxErr != nil {
+		return resp.StatusCode, nil, fmt.Errorf("reading response: request: %v: %w", req.URL, ctxErr)
+	}
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("error reading response: status: %d, request: %v, error: %w", resp.StatusCode, req.URL, err)
+	}
+
+	err = json.Unmarshal(raw, result)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("error unmarshaling response: status: %d, request: %v, response: %s, error: %w", resp.StatusCode, req.URL, raw, err)
+	}
+
+	return resp.StatusCode, resp.Header, nil
+}
+
+// captureRateLimit records the rate-limit headers of a response, if any, and
+// passes them to the OnRateLimit hook.
+func (c *Client) captureRateLimit(header http.Header) {
+	limit, ok := parseRateLimit(header, time.Now())
+	if !ok {
+		return
+	}
+
+	c.rateLimitMu.Lock()
+	c.rateLimit = &limit
+	c.rateLimitMu.Unlock()
+
+	if c.onRateLimit != nil {
+		c.onRateLimit(limit)
+	}
+}
+
+// lastRateLimit returns the rate-limit state reported with the last response that
+// carried rate-limit headers. It reports false when none did.
+func (c *Client) lastRateLimit() (RateLimit, bool) {
+	if c == nil {
+		return RateLimit{}, false
+	}
+
+	c.rateLimitMu.Lock()
+	defer c.rateLimitMu.Unlock()
+
+	if c.rateLimit == nil {
+		return RateLimit{}, false
+	}
+
+	return *c.rateLimit, true
+}
+
+// readBody reads the response body up to the size limit. When the body is larger,
+// the bytes read so far are returned along with ErrResponseTooLarge.
+func (c *Client) readBody(resp *http.Response) ([]byte, error) {
+	limit := c.maxResponseBytes
+	if limit <= 0 {
+		limit = DefaultMaxResponseBytes
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return raw, err
+	}
+
+	if int64(len(raw)) > limit {
+		return raw[:limit], fmt.Errorf("%w: limit is %d bytes", ErrResponseTooLarge, limit)
+	}
+
+	return raw, nil
+}
+
+// logf logs through the configured Logger, if any.
+func (c *Client) logf(format string, v ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, v...)
+	}
+}
+
+func doJSONRequest(ctx context.Context, method string, endpoint *url.URL, payload any) (*http.Request, error) {
+	body := new(bytes.Buffer)
+
+	if payload != nil {
+		err := json.NewEncoder(body).Encode(payload)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request JSON body: %w", err)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", "application/json")
+
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	return req, nil
+}
+
+// pacer spaces out requests using the X-RateLimit-Remaining and X-RateLimit-Reset
+// headers of the last response, so the remaining quota is spread evenly over
+// the time left until the limit resets.
+type pacer struct {
+	mu   sync.Mutex
+	next time.Time
+
+	// now and after replace time.Now and time.After when set, e.g. by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+}
+
+// clock returns the current time.
+func (p *pacer) clock() time.Time {
+	if p.now != nil {
+		return p.now()
+	}
+
+	return time.Now()
+}
+
+// wait blocks until the next request is allowed or the context is done.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	delay := p.next.Sub(p.clock())
+	p.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	var elapsed <-chan time.Time
+	if p.after != nil {
+		elapsed = p.after(delay)
+	} else {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		elapsed = timer.C
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-elapsed:
+		return nil
+	}
+}
+
+// update computes when the next request may be sent from the rate-limit headers.
+// Responses without rate-limit headers leave the pacing unchanged.
+func (p *pacer) update(header http.Header) {
+	now := p.clock()
+	limit, ok := parseRateLimit(header, now)
+	if !ok {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next = now.Add(limit.Reset.Sub(now) / time.Duration(limit.Remaining+1))
+}
+
+// throttle spaces out requests to stay under a fixed number of requests per second.
+// Each request reserves the next free slot; a random jitter of up to a tenth of the
+// interval is added so that several processes sharing a token drift apart.
+type throttle struct {
+	mu   sync.Mutex
+	next time.Time
+}
+
+// wait blocks until the slot reserved for the request comes or the context is done.
+func (t *throttle) wait(ctx context.Context, qps float64) error {
+	interval := time.Duration(float64(time.Second) / qps)
+	jitter := time.Duration(mathrand.Int64N(int64(interval)/10 + 1))
+
+	t.mu.Lock()
+	now := time.Now()
+	slot := t.next
+	if slot.Before(now) {
+		slot = now
+	}
+	t.next = slot.Add(interval + jitter)
+	t.mu.Unlock()
+
+	delay := slot.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// The slot goes unused, so it is handed back to the requests that follow,
+		// unless some already reserved the slots after it
+		t.mu.Lock()
+		if t.next.Equal(slot.Add(interval + jitter)) {
+			t.next = slot
+		}
+		t.mu.Unlock()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// RateLimit is the rate-limit state the API reported with a response.
+type RateLimit struct {
+	// Limit is the number of requests allowed per window, or zero when the
+	// API did not report it.
+	Limit int
+
+	// Remaining is the number of requests left in the current window.
+	Remaining int
+
+	// Reset is when the current window ends.
+	Reset time.Time
+}
+
+// parseRateLimit reads the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers. It reports false when the remaining count or the
+// reset time is missing or invalid.
+func parseRateLimit(header http.Header, now time.Time) (RateLimit, bool) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil || remaining < 0 {
+		return RateLimit{}, false
+	}
+
+	reset, err := strconv.ParseFloat(header.Get("X-RateLimit-Reset"), 64)
+	if err != nil || reset < 0 {
+		return RateLimit{}, false
+	}
+
+	// The reset header is either a number of seconds or a Unix timestamp
+	resetAt := now.Add(time.Duration(reset * float64(time.Second)))
+	if reset > 1e9 {
+		resetAt = time.Unix(int64(reset), 0)
+	}
+
+	// The limit is informational only, so a missing or invalid one is left at zero
+	limit, _ := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+
+	return RateLimit{
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     resetAt,
+	}, true
+}
+
+// DefaultRecorderSize is the number of exchanges a RequestRecorder keeps when
+// NewRequestRecorder is given no positive size.
+const DefaultRecorderSize = 100
+
+// RecordedExchange is an API call captured by a RequestRecorder.
+type RecordedExchange struct {
+	Time   time.Time
+	Method string
+	URL    string
+
+	// RequestHeader holds the headers sent, with the API token and the headers
+	// set by Provider.RequestModifier redacted.
+	RequestHeader http.Header
+	RequestBody   []byte
+
+	// StatusCode is zero and Err is set when no response was received.
+	StatusCode   int
+	ResponseBody []byte
+	Err          error
+}
+
+// RequestRecorder keeps the last API calls made through the providers it is set
+// on, for troubleshooting. It is safe for concurrent use. The zero value keeps
+// the last DefaultRecorderSize exchanges.
+type RequestRecorder struct {
+	mu        sync.Mutex
+	exchanges []RecordedExchange
+	next      int
+	full      bool
+}
+
+// NewRequestRecorder returns a recorder keeping the last size exchanges.
+func NewRequestRecorder(size int) *RequestRecorder {
+	if size <= 0 {
+		size = DefaultRecorderSize
+	}
+
+	return &RequestRecorder{exchanges: make([]RecordedExchange, size)}
+}
+
+// Exchanges returns the recorded exchanges, oldest first.
+func (r *RequestRecorder) Exchanges() []RecordedExchange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return slices.Clone(r.exchanges[:r.next])
+	}
+
+	return slices.Concat(r.exchanges[r.next:], r.exchanges[:r.next])
+}
+
+// Reset discards the recorded exchanges.
+func (r *RequestRecorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clear(r.exchanges)
+	r.next = 0
+	r.full = false
+}
+
+func (r *RequestRecorder) add(exchange RecordedExchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.exchanges) == 0 {
+		r.exchanges = make([]RecordedExchange, DefaultRecorderSize)
+	}
+
+	r.exchanges[r.next] = exchange
+	r.next = (r.next + 1) % len(r.exchanges)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// record captures an API call in the configured RequestRecorder, if any. The
+// response body is read up to the size limit and put back for the caller.
+//
+// The API token is redacted, and so is every header the RequestModifier set or
+// changed, as given by the headers from before it ran (unmodified), since custom
+// authentication goes there.
+func (c *Client) record(req *http.Request, authHeader string, unmodified http.Header, resp *http.Response, err error) {
+	if c.recorder == nil {
+		return
+	}
+
+	exchange := RecordedExchange{
+		Time:          time.Now(),
+		Method:        req.Method,
+		URL:           req.URL.String(),
+		RequestHeader: req.Header.Clone(),
+		Err:           err,
+	}
+
+	if exchange.RequestHeader.Get(authHeader) != "" {
+		exchange.RequestHeader.Set(authHeader, "REDACTED")
+	}
+	if unmodified != nil {
+		for name, values := range exchange.RequestHeader {
+			if !slices.Equal(values, unmodified[name]) {
+				exchange.RequestHeader[name] = []string{"REDACTED"}
+			}
+		}
+	}
+
+	if req.GetBody != nil {
+		body, bodyErr := req.GetBody()
+		if bodyErr == nil {
+			exchange.RequestBody, _ = io.ReadAll(body)
+			_ = body.Close()
+		}
+	}
+
+	if resp != nil {
+		limit := c.maxResponseBytes
+		if limit <= 0 {
+			limit = DefaultMaxResponseBytes
+		}
+
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(raw), resp.Body), resp.Body}
+
+		exchange.StatusCode = resp.StatusCode
+		exchange.ResponseBody = raw[:min(int64(len(raw)), limit)]
+	}
+
+	c.recorder.add(exchange)
 }
@@ -2,18 +2,30 @@ package tecnocratica
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewClient(t *testing.T) {
 	tests := []struct {
-		name    string
-		apiURL  string
-		wantErr bool
+		name          string
+		apiURL        string
+		allowInsecure bool
+		wantErr       bool
 	}{
 		{
 			name:    "default URL",
@@ -30,13 +42,25 @@ func TestNewClient(t *testing.T) {
 			apiURL:  "://invalid",
 			wantErr: true,
 		},
+		{
+			name:    "HTTP URL rejected by default",
+			apiURL:  "http://api.example.com/v1",
+			wantErr: true,
+		},
+		{
+			name:          "HTTP URL allowed on request",
+			apiURL:        "http://api.example.com/v1",
+			allowInsecure: true,
+			wantErr:       false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   tt.apiURL,
+				APIToken:          "test-token",
+				APIURL:            tt.apiURL,
+				AllowInsecureHTTP: tt.allowInsecure,
 			}
 
 			client, err := newClient(p)
@@ -65,6 +89,336 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClient_MaxIdleConnsPerHost(t *testing.T) {
+	p := &Provider{
+		APIToken:            "test-token",
+		MaxIdleConnsPerHost: 16,
+	}
+
+	first, err := newClient(p)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	transport, ok := first.HTTPClient.Transport.(*http.Transport)
+	if !ok {
+		t.Fatalf("newClient() transport = %T, want *http.Transport", first.HTTPClient.Transport)
+	}
+
+	if transport.MaxIdleConnsPerHost != 16 {
+		t.Errorf("MaxIdleConnsPerHost = %d, want 16", transport.MaxIdleConnsPerHost)
+	}
+
+	// The transport must be shared so idle connections survive across calls
+	second, err := newClient(p)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	if second.HTTPClient.Transport != first.HTTPClient.Transport {
+		t.Error("newClient() built a new transport instead of reusing the provider's")
+	}
+}
+
+func TestClient_RequestsPerSecond(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		RequestsPerSecond: 20,
+	}
+
+	// Every client of the provider shares the limit
+	for range 5 {
+		client, err := newClient(p)
+		if err != nil {
+			t.Fatalf("newClient() error = %v", err)
+		}
+
+		_, err = client.getZones(context.Background())
+		if err != nil {
+			t.Fatalf("getZones() error = %v", err)
+		}
+	}
+
+	interval := 50 * time.Millisecond
+	for i := 1; i < len(times); i++ {
+		// Allow for timer granularity; the jitter only ever adds to the interval
+		if gap := times[i].Sub(times[i-1]); gap < interval*9/10 {
+			t.Errorf("request %d sent %v after the previous one, want at least %v", i, gap, interval)
+		}
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	// Take the current slot so the request below has to wait for the next one
+	_ = p.throttle.wait(context.Background(), p.RequestsPerSecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err = client.getZones(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("getZones() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestThrottle_CancelledWait(t *testing.T) {
+	var th throttle
+
+	err := th.wait(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+	next := th.next
+
+	// A request cancelled while waiting for its slot must not hold up the next ones
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = th.wait(ctx, 10)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() error = %v, want context.Canceled", err)
+	}
+	if !th.next.Equal(next) {
+		t.Errorf("next slot after a cancelled wait = %v, want %v", th.next, next)
+	}
+}
+
+func TestThrottle_CancelledWaitInQueue(t *testing.T) {
+	var th throttle
+
+	// reserve starts a wait and returns once it has reserved its slot
+	reserve := func(ctx context.Context) (<-chan error, time.Time) {
+		th.mu.Lock()
+		before := th.next
+		th.mu.Unlock()
+
+		errc := make(chan error, 1)
+		go func() { errc <- th.wait(ctx, 10) }()
+
+		for {
+			th.mu.Lock()
+			next := th.next
+			th.mu.Unlock()
+			if !next.Equal(before) {
+				return errc, next
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	first, _ := reserve(context.Background())
+	if err := <-first; err != nil {
+		t.Fatalf("wait() error = %v", err)
+	}
+
+	ctxB, cancelB := context.WithCancel(context.Background())
+	defer cancelB()
+	waitB, afterB := reserve(ctxB)
+
+	ctxC, cancelC := context.WithCancel(context.Background())
+	defer cancelC()
+	waitC, afterC := reserve(ctxC)
+
+	// B gives up while C waits behind it: C keeps its slot and B's is not reused
+	cancelB()
+	if err := <-waitB; !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() error = %v, want context.Canceled", err)
+	}
+	th.mu.Lock()
+	next := th.next
+	th.mu.Unlock()
+	if !next.Equal(afterC) {
+		t.Errorf("next slot after cancelling a queued wait = %v, want %v", next, afterC)
+	}
+
+	// The last slot is handed back
+	cancelC()
+	if err := <-waitC; !errors.Is(err, context.Canceled) {
+		t.Fatalf("wait() error = %v, want context.Canceled", err)
+	}
+	th.mu.Lock()
+	next = th.next
+	th.mu.Unlock()
+	if !next.Equal(afterB) {
+		t.Errorf("next slot after cancelling the last wait = %v, want %v", next, afterB)
+	}
+}
+
+func TestNewClient_TransportSettings(t *testing.T) {
+	defaults := http.DefaultTransport.(*http.Transport)
+
+	tests := []struct {
+		name                    string
+		provider                *Provider
+		wantMaxIdleConns        int
+		wantMaxIdleConnsPerHost int
+		wantIdleConnTimeout     time.Duration
+	}{
+		{
+			name: "all settings",
+			provider: &Provider{
+				MaxIdleConns:        64,
+				MaxIdleConnsPerHost: 32,
+				IdleConnTimeout:     5 * time.Minute,
+			},
+			wantMaxIdleConns:        64,
+			wantMaxIdleConnsPerHost: 32,
+			wantIdleConnTimeout:     5 * time.Minute,
+		},
+		{
+			name: "unset settings keep the defaults",
+			provider: &Provider{
+				IdleConnTimeout: time.Minute,
+			},
+			wantMaxIdleConns:        defaults.MaxIdleConns,
+			wantMaxIdleConnsPerHost: defaults.MaxIdleConnsPerHost,
+			wantIdleConnTimeout:     time.Minute,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient(tt.provider)
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			transport, ok := client.HTTPClient.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("newClient() transport = %T, want *http.Transport", client.HTTPClient.Transport)
+			}
+
+			if transport.MaxIdleConns != tt.wantMaxIdleConns {
+				t.Errorf("MaxIdleConns = %d, want %d", transport.MaxIdleConns, tt.wantMaxIdleConns)
+			}
+			if transport.MaxIdleConnsPerHost != tt.wantMaxIdleConnsPerHost {
+				t.Errorf("MaxIdleConnsPerHost = %d, want %d", transport.MaxIdleConnsPerHost, tt.wantMaxIdleConnsPerHost)
+			}
+			if transport.IdleConnTimeout != tt.wantIdleConnTimeout {
+				t.Errorf("IdleConnTimeout = %v, want %v", transport.IdleConnTimeout, tt.wantIdleConnTimeout)
+			}
+		})
+	}
+}
+
+func TestNewClient_TLSMinVersion(t *testing.T) {
+	tests := []struct {
+		name           string
+		version        string
+		wantMinVersion uint16
+		wantErr        bool
+	}{
+		{name: "TLS 1.2", version: "1.2", wantMinVersion: tls.VersionTLS12},
+		{name: "TLS 1.3", version: "1.3", wantMinVersion: tls.VersionTLS13},
+		{name: "too old", version: "1.1", wantErr: true},
+		{name: "invalid", version: "tls13", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := newClient(&Provider{
+				APIToken:      "test-token",
+				TLSMinVersion: tt.version,
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			transport, ok := client.HTTPClient.Transport.(*http.Transport)
+			if !ok {
+				t.Fatalf("newClient() transport = %T, want *http.Transport", client.HTTPClient.Transport)
+			}
+
+			if transport.TLSClientConfig == nil || transport.TLSClientConfig.MinVersion != tt.wantMinVersion {
+				t.Errorf("TLSClientConfig = %+v, want MinVersion %#x", transport.TLSClientConfig, tt.wantMinVersion)
+			}
+			if !transport.ForceAttemptHTTP2 {
+				t.Error("ForceAttemptHTTP2 = false, want HTTP/2 to be negotiated")
+			}
+		})
+	}
+}
+
+func TestClient_APIPathPrefix(t *testing.T) {
+	tests := []struct {
+		name          string
+		apiPathPrefix string
+		wantPath      string
+		wantErr       bool
+	}{
+		{
+			name:          "default prefix",
+			apiPathPrefix: "",
+			wantPath:      "/v1/dns/zones",
+		},
+		{
+			name:          "custom prefix",
+			apiPathPrefix: "gateway/neodigit",
+			wantPath:      "/v1/gateway/neodigit/zones",
+		},
+		{
+			name:          "leading slash",
+			apiPathPrefix: "/dns",
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{})
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL + "/v1",
+				AllowInsecureHTTP: true,
+				APIPathPrefix:     tt.apiPathPrefix,
+			}
+
+			client, err := newClient(p)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newClient() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			_, err = client.getZones(context.Background())
+			if err != nil {
+				t.Fatalf("getZones() error = %v", err)
+			}
+
+			if gotPath != tt.wantPath {
+				t.Errorf("request path = %q, want %q", gotPath, tt.wantPath)
+			}
+		})
+	}
+}
+
 func TestClient_GetZones(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -230,6 +584,208 @@ func TestClient_GetRecords(t *testing.T) {
 	}
 }
 
+func TestClient_ListResponseShapes(t *testing.T) {
+	tests := []struct {
+		name         string
+		zonesBody    string
+		recordsBody  string
+		wantZones    int
+		wantRecords  int
+		wantRecordID int
+	}{
+		{
+			name:         "bare arrays",
+			zonesBody:    `[{"id":1,"name":"example.com"},{"id":2,"name":"example.org"}]`,
+			recordsBody:  `[{"id":7,"name":"www","type":"A","content":"192.0.2.1","ttl":3600}]`,
+			wantZones:    2,
+			wantRecords:  1,
+			wantRecordID: 7,
+		},
+		{
+			name:         "enveloped objects",
+			zonesBody:    `{"data":[{"id":1,"name":"example.com"}],"meta":{"total":1}}`,
+			recordsBody:  ` {"meta":{"page":1},"data":[{"id":8,"name":"www","type":"A","content":"192.0.2.1","ttl":3600}]}`,
+			wantZones:    1,
+			wantRecords:  1,
+			wantRecordID: 8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				if r.URL.Path == "/dns/zones" {
+					_, _ = w.Write([]byte(tt.zonesBody))
+				} else {
+					_, _ = w.Write([]byte(tt.recordsBody))
+				}
+			}))
+			defer server.Close()
+
+			baseURL, _ := url.Parse(server.URL)
+			client := &Client{
+				token:      "test-token",
+				BaseURL:    baseURL,
+				HTTPClient: server.Client(),
+			}
+
+			zones, err := client.getZones(context.Background())
+			if err != nil {
+				t.Fatalf("getZones() error = %v", err)
+			}
+			if len(zones) != tt.wantZones {
+				t.Errorf("getZones() returned %d zones, want %d", len(zones), tt.wantZones)
+			}
+
+			records, err := client.getRecords(context.Background(), 1, "")
+			if err != nil {
+				t.Fatalf("getRecords() error = %v", err)
+			}
+			if len(records) != tt.wantRecords {
+				t.Fatalf("getRecords() returned %d records, want %d", len(records), tt.wantRecords)
+			}
+			if records[0].ID != tt.wantRecordID {
+				t.Errorf("getRecords() record ID = %d, want %d", records[0].ID, tt.wantRecordID)
+			}
+		})
+	}
+}
+
+func TestRecord_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    Record
+		wantErr bool
+	}{
+		{
+			name: "numbers",
+			body: `{"id":7,"name":"@","type":"MX","content":"mail.example.com","ttl":3600,"prio":10,"weight":5,"disabled":true}`,
+			want: Record{ID: 7, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10, Weight: 5, Disabled: true},
+		},
+		{
+			name: "string-encoded numbers",
+			body: `{"id":"7","name":"@","type":"MX","content":"mail.example.com","ttl":"3600","prio":"10","weight":"5"}`,
+			want: Record{ID: 7, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10, Weight: 5},
+		},
+		{
+			name: "empty strings and nulls",
+			body: `{"id":7,"name":"www","type":"A","content":"192.0.2.1","ttl":"","prio":null}`,
+			want: Record{ID: 7, Name: "www", Type: "A", Content: "192.0.2.1"},
+		},
+		{
+			name: "integral floats",
+			body: `{"id":7,"name":"www","type":"A","content":"192.0.2.1","ttl":3600.0}`,
+			want: Record{ID: 7, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		},
+		{
+			name:    "non-numeric string",
+			body:    `{"id":7,"name":"www","type":"A","content":"192.0.2.1","ttl":"1h"}`,
+			wantErr: true,
+		},
+		{
+			name:    "fractional number",
+			body:    `{"id":7,"name":"www","type":"A","content":"192.0.2.1","ttl":1.5}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Record
+
+			err := json.Unmarshal([]byte(tt.body), &got)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("Unmarshal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZone_UnmarshalJSON(t *testing.T) {
+	var zones listResponse[Zone]
+
+	err := json.Unmarshal([]byte(`[{"id":"3","name":"example.com","human_name":"example.com","records_count":"12","serial":"2024010101"},{"id":4,"name":"example.org","serial":4294967295},{"id":6,"name":"example.io","serial":"3026101601"}]`), &zones)
+	if err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := []Zone{
+		{ID: 3, Name: "example.com", HumanName: "example.com", RecordCount: 12, Serial: 2024010101},
+		{ID: 4, Name: "example.org", Serial: 4294967295},
+		{ID: 6, Name: "example.io", Serial: 3026101601},
+	}
+	if !slices.Equal(zones, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", zones, want)
+	}
+
+	err = json.Unmarshal([]byte(`{"id":5,"name":"example.net","serial":4294967296}`), new(Zone))
+	if err == nil {
+		t.Error("Unmarshal() error = nil for a serial out of range")
+	}
+
+	err = json.Unmarshal([]byte(`{"id":5,"name":"example.net","serial":-1}`), new(Zone))
+	if err == nil {
+		t.Error("Unmarshal() error = nil for a negative serial")
+	}
+}
+
+func TestClient_MaxResponseBytes(t *testing.T) {
+	tests := []struct {
+		name             string
+		maxResponseBytes int64
+		wantErr          error
+	}{
+		{
+			name:             "response within the limit",
+			maxResponseBytes: 1 << 20,
+			wantErr:          nil,
+		},
+		{
+			name:             "oversized response",
+			maxResponseBytes: 1024,
+			wantErr:          ErrResponseTooLarge,
+		},
+	}
+
+	// Roughly 40 KB of zones
+	zones := make([]Zone, 1000)
+	for i := range zones {
+		zones[i] = Zone{ID: i, Name: "zone" + strconv.Itoa(i) + ".example.com"}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(zones)
+			}))
+			defer server.Close()
+
+			baseURL, _ := url.Parse(server.URL)
+			client := &Client{
+				token:            "test-token",
+				BaseURL:          baseURL,
+				HTTPClient:       server.Client(),
+				maxResponseBytes: tt.maxResponseBytes,
+			}
+
+			_, err := client.getZones(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("getZones() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestClient_CreateRecord(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -296,7 +852,7 @@ func TestClient_CreateRecord(t *testing.T) {
 				HTTPClient: server.Client(),
 			}
 
-			record, err := client.createRecord(context.Background(), tt.zoneID, tt.record)
+			record, err := client.createRecord(context.Background(), tt.zoneID, "example.com", tt.record)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("createRecord() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -309,39 +865,255 @@ func TestClient_CreateRecord(t *testing.T) {
 	}
 }
 
-func TestClient_DeleteRecord(t *testing.T) {
+func TestClient_UpdateRecordETag(t *testing.T) {
 	tests := []struct {
-		name           string
-		zoneID         int
-		recordID       int
-		responseStatus int
-		wantErr        bool
+		name        string
+		serverETag  string
+		wantIfMatch string
+		wantErr     error
 	}{
 		{
-			name:           "successful deletion",
-			zoneID:         1,
-			recordID:       123,
-			responseStatus: http.StatusNoContent,
-			wantErr:        false,
+			name:        "matching ETag",
+			serverETag:  `"v1"`,
+			wantIfMatch: `"v1"`,
 		},
 		{
-			name:           "record not found",
-			zoneID:         1,
-			recordID:       999,
-			responseStatus: http.StatusNotFound,
-			wantErr:        true,
+			name:        "record changed since it was read",
+			serverETag:  `"v1"`,
+			wantIfMatch: `"v1"`,
+			wantErr:     ErrConflict,
+		},
+		{
+			name:        "API without ETags",
+			serverETag:  "",
+			wantIfMatch: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIfMatch string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.serverETag != "" {
+					w.Header().Set("ETag", tt.serverETag)
+				}
+
+				switch r.Method {
+				case http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(Record{ID: 42, Name: "www", Type: "A", Content: "192.0.2.1"})
+				case http.MethodPut:
+					gotIfMatch = r.Header.Get("If-Match")
+					if tt.wantErr != nil {
+						w.WriteHeader(http.StatusPreconditionFailed)
+						return
+					}
+
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true})
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			record, err := client.getRecord(context.Background(), 1, 42)
+			if err != nil {
+				t.Fatalf("getRecord() error = %v", err)
+			}
+
+			if record.ETag != tt.serverETag {
+				t.Errorf("getRecord() ETag = %q, want %q", record.ETag, tt.serverETag)
+			}
+
+			record.Content = "192.0.2.2"
+
+			_, err = client.updateRecord(context.Background(), 1, 42, *record)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("updateRecord() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if gotIfMatch != tt.wantIfMatch {
+				t.Errorf("If-Match = %q, want %q", gotIfMatch, tt.wantIfMatch)
+			}
+		})
+	}
+}
+
+func TestClient_CreateRecordRetry(t *testing.T) {
+	tests := []struct {
+		name            string
+		createOnTimeout bool
+		retryBudget     int
+		wantPosts       int
+		wantErr         bool
+	}{
+		{
+			name:            "created before the timeout",
+			createOnTimeout: true,
+			retryBudget:     1,
+			wantPosts:       1,
+		},
+		{
+			name:            "not created before the timeout",
+			createOnTimeout: false,
+			retryBudget:     1,
+			wantPosts:       2,
+		},
+		{
+			name:            "no retry budget",
+			createOnTimeout: false,
+			wantPosts:       1,
+			wantErr:         true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var stored []Record
+			var keys []string
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				switch r.Method {
+				case http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(stored)
+				case http.MethodPost:
+					keys = append(keys, r.Header.Get("Idempotency-Key"))
+
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+
+					if len(keys) == 1 {
+						if tt.createOnTimeout {
+							req.Record.ID = 1
+							stored = append(stored, req.Record)
+						}
+						// Answer too late for the client
+						mu.Unlock()
+						time.Sleep(200 * time.Millisecond)
+						mu.Lock()
+						return
+					}
+
+					req.Record.ID = len(stored) + 1
+					stored = append(stored, req.Record)
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true, RetryBudget: tt.retryBudget})
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+			client.HTTPClient.Timeout = 50 * time.Millisecond
+
+			record := Record{Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}
+
+			created, err := client.createRecord(context.Background(), 1, "example.com", record)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if tt.wantErr {
+				if err == nil || len(keys) != tt.wantPosts {
+					t.Errorf("createRecord() error = %v after %d requests, want an error after %d", err, len(keys), tt.wantPosts)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("createRecord() error = %v", err)
+			}
+
+			if len(stored) != 1 {
+				t.Fatalf("server holds %d records, want exactly 1", len(stored))
+			}
+
+			if created.ID != stored[0].ID {
+				t.Errorf("createRecord() ID = %d, want %d", created.ID, stored[0].ID)
+			}
+
+			if len(keys) != tt.wantPosts {
+				t.Fatalf("createRecord() sent %d requests, want %d", len(keys), tt.wantPosts)
+			}
+
+			if keys[0] == "" || keys[len(keys)-1] != keys[0] {
+				t.Errorf("Idempotency-Key headers = %q, want one stable key", keys)
+			}
+		})
+	}
+}
+
+func TestClient_DeleteRecord(t *testing.T) {
+	tests := []struct {
+		name           string
+		zoneID         int
+		recordID       int
+		responseStatus int
+		responseBody   string
+		wantErr        bool
+	}{
+		{
+			name:           "successful deletion",
+			zoneID:         1,
+			recordID:       123,
+			responseStatus: http.StatusNoContent,
+			wantErr:        false,
+		},
+		{
+			name:           "deletion confirmed with a body",
+			zoneID:         1,
+			recordID:       123,
+			responseStatus: http.StatusOK,
+			responseBody:   `{"message":"record deleted","id":123}`,
+			wantErr:        false,
+		},
+		{
+			name:           "deletion accepted",
+			zoneID:         1,
+			recordID:       123,
+			responseStatus: http.StatusAccepted,
+			responseBody:   `{"status":"queued"}`,
+			wantErr:        false,
+		},
+		{
+			name:           "record not found",
+			zoneID:         1,
+			recordID:       999,
+			responseStatus: http.StatusNotFound,
+			wantErr:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if r.Method != http.MethodDelete {
 					t.Errorf("Expected DELETE request, got %s", r.Method)
 				}
 
 				w.WriteHeader(tt.responseStatus)
+				_, _ = w.Write([]byte(tt.responseBody))
 			}))
+
+			// Count connections to check that they are reused across requests
+			var connections int
+			server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					connections++
+				}
+			}
+			server.Start()
 			defer server.Close()
 
 			baseURL, _ := url.Parse(server.URL)
@@ -351,9 +1123,865 @@ func TestClient_DeleteRecord(t *testing.T) {
 				HTTPClient: server.Client(),
 			}
 
-			err := client.deleteRecord(context.Background(), tt.zoneID, tt.recordID)
+			for range 2 {
+				err := client.deleteRecord(context.Background(), tt.zoneID, tt.recordID)
+				if (err != nil) != tt.wantErr {
+					t.Errorf("deleteRecord() error = %v, wantErr %v", err, tt.wantErr)
+				}
+			}
+
+			if connections != 1 {
+				t.Errorf("deleteRecord() opened %d connections, want 1", connections)
+			}
+		})
+	}
+}
+
+func TestClient_DeleteRecordRetried(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	var deletes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deletes++
+		if deletes == 1 {
+			// The record is deleted, but the response is lost
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+			return
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true, RetryBudget: 1})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	err = client.deleteRecord(context.Background(), 1, 42)
+	if err != nil {
+		t.Errorf("deleteRecord() error = %v, want the 404 of the retry to count as deleted", err)
+	}
+	if deletes != 2 {
+		t.Errorf("deleteRecord() sent %d requests, want 2", deletes)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		want       time.Duration
+		wantRetry  bool
+	}{
+		{name: "no header", attempt: 2, want: 2 * retryBaseDelay, wantRetry: true},
+		{name: "seconds", retryAfter: "3", attempt: 1, want: 3 * time.Second, wantRetry: true},
+		{name: "HTTP date", retryAfter: now.Add(5 * time.Second).Format(http.TimeFormat), attempt: 1, want: 5 * time.Second, wantRetry: true},
+		{name: "invalid header", retryAfter: "soon", attempt: 1, want: retryBaseDelay, wantRetry: true},
+		{name: "too long", retryAfter: "3600", attempt: 1, wantRetry: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &APIError{
+				StatusCode: http.StatusServiceUnavailable,
+				retryAfter: parseRetryAfter(tt.retryAfter, now),
+			}
+
+			got, ok := retryDelay(tt.attempt, err)
+			if ok != tt.wantRetry || got != tt.want {
+				t.Errorf("retryDelay() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestClient_RetryPost(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name      string
+		key       string
+		wantPosts int
+		wantErr   bool
+	}{
+		{name: "without idempotency key", wantPosts: 1, wantErr: true},
+		{name: "with idempotency key", key: "key-1", wantPosts: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posts int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				posts++
+				if posts == 1 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(`{"id": 1}`))
+			}))
+			defer server.Close()
+
+			client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true, RetryBudget: 3})
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			req, err := doJSONRequest(context.Background(), http.MethodPost, client.endpoint("zones", "1", "records"), RecordRequest{})
+			if err != nil {
+				t.Fatalf("doJSONRequest() error = %v", err)
+			}
+			if tt.key != "" {
+				req.Header.Set("Idempotency-Key", tt.key)
+			}
+
+			err = client.do(req, nil)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("deleteRecord() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if posts != tt.wantPosts {
+				t.Errorf("do() sent %d requests, want %d", posts, tt.wantPosts)
+			}
+		})
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	transport := func(err error) error {
+		return fmt.Errorf("unexpected http error: %w", &url.Error{Op: "Get", URL: "https://api.example.com", Err: err})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "connection reset", err: transport(io.ErrUnexpectedEOF), want: true},
+		{name: "server error", err: &APIError{StatusCode: http.StatusBadGateway}, want: true},
+		{name: "rate limited", err: &APIError{StatusCode: http.StatusTooManyRequests}, want: true},
+		{name: "client error", err: &APIError{StatusCode: http.StatusBadRequest}, want: false},
+		{name: "unknown authority", err: transport(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), want: false},
+		{name: "wrong host", err: transport(x509.HostnameError{Host: "api.example.com"}), want: false},
+		{name: "plain HTTP server", err: transport(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryable(tt.err); got != tt.want {
+				t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClient_APIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		statusCode  int
+		body        string
+		wantMessage string
+		wantIs      error
+	}{
+		{
+			name:        "message field",
+			statusCode:  http.StatusUnprocessableEntity,
+			body:        `{"message":"content is not a valid IPv4 address"}`,
+			wantMessage: "content is not a valid IPv4 address",
+		},
+		{
+			name:        "nested error object",
+			statusCode:  http.StatusBadRequest,
+			body:        `{"error":{"code":"invalid_ttl","message":"ttl is too low"}}`,
+			wantMessage: "ttl is too low",
+		},
+		{
+			name:        "error string",
+			statusCode:  http.StatusUnauthorized,
+			body:        `{"error":"invalid token"}`,
+			wantMessage: "invalid token",
+			wantIs:      ErrUnauthorized,
+		},
+		{
+			name:        "not JSON",
+			statusCode:  http.StatusBadGateway,
+			body:        `<html>Bad Gateway</html>`,
+			wantMessage: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true})
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			_, err = client.getZones(context.Background())
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("getZones() error = %v, want an *APIError", err)
+			}
+
+			if apiErr.StatusCode != tt.statusCode {
+				t.Errorf("StatusCode = %d, want %d", apiErr.StatusCode, tt.statusCode)
+			}
+
+			if apiErr.Message != tt.wantMessage {
+				t.Errorf("Message = %q, want %q", apiErr.Message, tt.wantMessage)
+			}
+
+			if string(apiErr.Raw) != tt.body {
+				t.Errorf("Raw = %q, want %q", apiErr.Raw, tt.body)
+			}
+
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("getZones() error = %v, want it to match %v", err, tt.wantIs)
+			}
+		})
+	}
+}
+
+func TestClient_ContextAPIToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantToken string
+	}{
+		{
+			name:      "provider token",
+			ctx:       context.Background(),
+			wantToken: "test-token",
+		},
+		{
+			name:      "context token overrides provider token",
+			ctx:       WithAPIToken(context.Background(), "tenant-token"),
+			wantToken: "tenant-token",
+		},
+		{
+			name:      "empty context token falls back",
+			ctx:       WithAPIToken(context.Background(), ""),
+			wantToken: "test-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotToken string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotToken = r.Header.Get("X-TCpanel-Token")
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{})
+			}))
+			defer server.Close()
+
+			baseURL, _ := url.Parse(server.URL)
+			client := &Client{
+				token:      "test-token",
+				BaseURL:    baseURL,
+				HTTPClient: server.Client(),
+			}
+
+			_, err := client.getZones(tt.ctx)
+			if err != nil {
+				t.Fatalf("getZones() error = %v", err)
+			}
+
+			if gotToken != tt.wantToken {
+				t.Errorf("X-TCpanel-Token = %q, want %q", gotToken, tt.wantToken)
+			}
+		})
+	}
+}
+
+func TestClient_AuthHeader(t *testing.T) {
+	tests := []struct {
+		name           string
+		authHeaderName string
+		bearerAuth     bool
+		wantHeader     string
+		wantValue      string
+	}{
+		{
+			name:       "legacy header",
+			wantHeader: "X-TCpanel-Token",
+			wantValue:  "test-token",
+		},
+		{
+			name:       "bearer",
+			bearerAuth: true,
+			wantHeader: "Authorization",
+			wantValue:  "Bearer test-token",
+		},
+		{
+			name:           "renamed header",
+			authHeaderName: "X-Api-Key",
+			wantHeader:     "X-Api-Key",
+			wantValue:      "test-token",
+		},
+		{
+			name:           "bearer in a renamed header",
+			authHeaderName: "X-Auth",
+			bearerAuth:     true,
+			wantHeader:     "X-Auth",
+			wantValue:      "Bearer test-token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got http.Header
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Clone()
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{})
+			}))
+			defer server.Close()
+
+			client, err := newClient(&Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				AuthHeaderName:    tt.authHeaderName,
+				BearerAuth:        tt.bearerAuth,
+			})
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			_, err = client.getZones(context.Background())
+			if err != nil {
+				t.Fatalf("getZones() error = %v", err)
+			}
+
+			if v := got.Get(tt.wantHeader); v != tt.wantValue {
+				t.Errorf("%s = %q, want %q", tt.wantHeader, v, tt.wantValue)
+			}
+
+			// The token must not also leak through the default header
+			if tt.wantHeader != "X-TCpanel-Token" && got.Get("X-TCpanel-Token") != "" {
+				t.Errorf("X-TCpanel-Token = %q, want it unset", got.Get("X-TCpanel-Token"))
+			}
+		})
+	}
+}
+
+func TestClient_ContextCancellation(t *testing.T) {
+	tests := []struct {
+		name        string
+		partialBody bool
+		deadline    bool
+		wantErr     error
+	}{
+		{
+			name:    "cancelled while waiting for the response",
+			wantErr: context.Canceled,
+		},
+		{
+			name:     "deadline while waiting for the response",
+			deadline: true,
+			wantErr:  context.DeadlineExceeded,
+		},
+		{
+			name:        "cancelled while reading the body",
+			partialBody: true,
+			wantErr:     context.Canceled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.partialBody {
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte(`[{"id": 1,`))
+					w.(http.Flusher).Flush()
+				}
+
+				select {
+				case <-r.Context().Done():
+				case <-release:
+				}
+			}))
+			defer server.Close()
+			defer close(release)
+
+			baseURL, _ := url.Parse(server.URL)
+			client := &Client{
+				token:      "test-token",
+				BaseURL:    baseURL,
+				HTTPClient: server.Client(),
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			if tt.deadline {
+				ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+			} else {
+				time.AfterFunc(50*time.Millisecond, cancel)
+			}
+			defer cancel()
+
+			_, err := client.getZones(ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("getZones() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if retryable(err) {
+				t.Errorf("retryable(%v) = true, want cancelled requests not to be retried", err)
+			}
+		})
+	}
+}
+
+func TestClient_RequestModifier(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{})
+	}))
+	defer server.Close()
+
+	client, err := newClient(&Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		RequestModifier: func(req *http.Request) {
+			req.Header.Set("X-Tenant-ID", "tenant-42")
+			req.Header.Set("X-TCpanel-Token", "gateway-token")
+		},
+	})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	_, err = client.getZones(context.Background())
+	if err != nil {
+		t.Fatalf("getZones() error = %v", err)
+	}
+
+	if v := got.Get("X-Tenant-ID"); v != "tenant-42" {
+		t.Errorf("X-Tenant-ID = %q, want tenant-42", v)
+	}
+
+	// The modifier runs after the standard headers are set, so it can override them
+	if v := got.Get("X-TCpanel-Token"); v != "gateway-token" {
+		t.Errorf("X-TCpanel-Token = %q, want the modifier's gateway-token", v)
+	}
+
+	if v := got.Get("User-Agent"); v != userAgent {
+		t.Errorf("User-Agent = %q, want %q", v, userAgent)
+	}
+}
+
+func TestClient_RequestRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		case http.MethodPost:
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error":"invalid content"}`))
+		}
+	}))
+	defer server.Close()
+
+	recorder := NewRequestRecorder(2)
+	client, err := newClient(&Provider{
+		APIToken:          "secret-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		Recorder:          recorder,
+	})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	// The oldest call falls out of the ring buffer
+	for range 2 {
+		zones, err := client.getZones(context.Background())
+		if err != nil || len(zones) != 1 {
+			t.Fatalf("getZones() = %v, %v; the recorder must leave the response intact", zones, err)
+		}
+	}
+
+	_, err = client.createRecord(context.Background(), 1, "example.com", Record{Name: "www", Type: "A", Content: "bad"})
+	if err == nil {
+		t.Fatal("createRecord() error = nil")
+	}
+
+	exchanges := recorder.Exchanges()
+	if len(exchanges) != 2 {
+		t.Fatalf("Exchanges() returned %d exchanges, want 2", len(exchanges))
+	}
+
+	get, post := exchanges[0], exchanges[1]
+	if get.Method != http.MethodGet || get.URL != server.URL+"/dns/zones" || get.StatusCode != http.StatusOK ||
+		!strings.Contains(string(get.ResponseBody), `"example.com"`) {
+		t.Errorf("first exchange = %+v, want the zone listing", get)
+	}
+
+	if post.Method != http.MethodPost || post.StatusCode != http.StatusUnprocessableEntity ||
+		!strings.Contains(string(post.RequestBody), `"content":"bad"`) || string(post.ResponseBody) != `{"error":"invalid content"}` {
+		t.Errorf("second exchange = %+v, want the failed creation", post)
+	}
+
+	for _, exchange := range exchanges {
+		if v := exchange.RequestHeader.Get(DefaultAuthHeaderName); v != "REDACTED" {
+			t.Errorf("recorded %s = %q, want it redacted", DefaultAuthHeaderName, v)
+		}
+		if strings.Contains(fmt.Sprint(exchange), "secret-token") {
+			t.Errorf("recorded exchange %+v contains the API token", exchange)
+		}
+	}
+
+	recorder.Reset()
+	if n := len(recorder.Exchanges()); n != 0 {
+		t.Errorf("Exchanges() after Reset() returned %d exchanges, want 0", n)
+	}
+}
+
+func TestClient_RequestRecorderModifier(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt fails, so the modifier also runs on a retry
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"error":"unavailable"}`))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+	}))
+	defer server.Close()
+
+	// The zero value is usable
+	recorder := &RequestRecorder{}
+	client, err := newClient(&Provider{
+		APIToken:          "secret-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		Recorder:          recorder,
+		RetryBudget:       1,
+		RequestModifier: func(req *http.Request) {
+			req.Header.Set("X-Gateway-Key", "gateway-secret")
+		},
+	})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	_, err = client.getZones(context.Background())
+	if err != nil {
+		t.Fatalf("getZones() error = %v", err)
+	}
+
+	exchanges := recorder.Exchanges()
+	if len(exchanges) != 2 {
+		t.Fatalf("Exchanges() returned %d exchanges, want 2", len(exchanges))
+	}
+
+	for i, exchange := range exchanges {
+		header := exchange.RequestHeader
+		if v := header.Get("X-Gateway-Key"); v != "REDACTED" {
+			t.Errorf("attempt %d: recorded X-Gateway-Key = %q, want it redacted", i+1, v)
+		}
+		if v := header.Get("User-Agent"); v != userAgent {
+			t.Errorf("attempt %d: recorded User-Agent = %q, want %q", i+1, v, userAgent)
+		}
+	}
+}
+
+func TestClient_UserAgent(t *testing.T) {
+	tests := []struct {
+		name          string
+		userAgent     string
+		wantUserAgent string
+	}{
+		{
+			name:          "default",
+			userAgent:     "",
+			wantUserAgent: userAgent,
+		},
+		{
+			name:          "custom",
+			userAgent:     "my-service/2.3",
+			wantUserAgent: "my-service/2.3 " + userAgent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotUserAgent string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotUserAgent = r.Header.Get("User-Agent")
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{})
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				UserAgent:         tt.userAgent,
+			}
+
+			client, err := newClient(p)
+			if err != nil {
+				t.Fatalf("newClient() error = %v", err)
+			}
+
+			_, err = client.getZones(context.Background())
+			if err != nil {
+				t.Fatalf("getZones() error = %v", err)
+			}
+
+			if gotUserAgent != tt.wantUserAgent {
+				t.Errorf("User-Agent = %q, want %q", gotUserAgent, tt.wantUserAgent)
+			}
+		})
+	}
+}
+
+func TestClient_PaceRateLimit(t *testing.T) {
+	remaining := 3
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("X-RateLimit-Reset", "0.3")
+		remaining--
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{})
+	}))
+	defer server.Close()
+
+	// The clock only moves when the pacer waits, so the waits are exact
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	var waits []time.Duration
+	fake := &pacer{
+		now: func() time.Time { return now },
+		after: func(d time.Duration) <-chan time.Time {
+			waits = append(waits, d)
+			now = now.Add(d)
+			elapsed := make(chan time.Time, 1)
+			elapsed <- now
+			return elapsed
+		},
+	}
+
+	baseURL, _ := url.Parse(server.URL)
+	client := &Client{
+		token:      "test-token",
+		BaseURL:    baseURL,
+		HTTPClient: server.Client(),
+		pacer:      fake,
+	}
+
+	for range 4 {
+		_, err := client.getZones(context.Background())
+		if err != nil {
+			t.Fatalf("getZones() error = %v", err)
+		}
+	}
+
+	// 300ms spread over remaining+1 requests: 75ms, 100ms, 150ms
+	want := []time.Duration{75 * time.Millisecond, 100 * time.Millisecond, 150 * time.Millisecond}
+	if !slices.Equal(waits, want) {
+		t.Errorf("waits before the requests = %v, want %v", waits, want)
+	}
+
+	// Every client of a provider paces against the same state
+	p := &Provider{APIToken: "test-token", PaceRateLimit: true}
+	first, _ := newClient(p)
+	second, _ := newClient(p)
+	if first.pacer == nil || first.pacer != second.pacer {
+		t.Errorf("clients of one provider use pacers %p and %p, want a shared one", first.pacer, second.pacer)
+	}
+}
+
+func TestClient_RateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.Header().Set("X-RateLimit-Limit", "100")
+			w.Header().Set("X-RateLimit-Remaining", "42")
+			w.Header().Set("X-RateLimit-Reset", "1900000000")
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{})
+	}))
+	defer server.Close()
+
+	var hooked []RateLimit
+	client, err := newClient(&Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		OnRateLimit:       func(limit RateLimit) { hooked = append(hooked, limit) },
+	})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	if _, ok := client.lastRateLimit(); ok {
+		t.Error("lastRateLimit() reported a state before any request")
+	}
+
+	_, err = client.getZones(context.Background())
+	if err != nil {
+		t.Fatalf("getZones() error = %v", err)
+	}
+
+	want := RateLimit{Limit: 100, Remaining: 42, Reset: time.Unix(1900000000, 0)}
+
+	got, ok := client.lastRateLimit()
+	if !ok {
+		t.Fatal("lastRateLimit() reported no state after a response with rate-limit headers")
+	}
+	if got.Limit != want.Limit || got.Remaining != want.Remaining || !got.Reset.Equal(want.Reset) {
+		t.Errorf("lastRateLimit() = %+v, want %+v", got, want)
+	}
+
+	if len(hooked) != 1 || hooked[0].Remaining != want.Remaining {
+		t.Errorf("OnRateLimit received %+v, want one call with %+v", hooked, want)
+	}
+
+	// A response without the headers keeps the last known state
+	_, err = client.getRecords(context.Background(), 1, "")
+	if err != nil {
+		t.Fatalf("getRecords() error = %v", err)
+	}
+	if got, _ := client.lastRateLimit(); got.Remaining != want.Remaining {
+		t.Errorf("lastRateLimit() after a response without headers = %+v, want %+v", got, want)
+	}
+
+	var nilClient *Client
+	if _, ok := nilClient.lastRateLimit(); ok {
+		t.Error("lastRateLimit() on a nil client reported a state")
+	}
+}
+
+// recordingTracer is a Tracer keeping the spans it started.
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+func (t *recordingTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	span := &recordingSpan{name: spanName, attributes: make(map[string]any)}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+type recordingSpan struct {
+	name       string
+	attributes map[string]any
+	err        error
+	ended      bool
+}
+
+func (s *recordingSpan) SetAttribute(key string, value any) { s.attributes[key] = value }
+func (s *recordingSpan) RecordError(err error)              { s.err = err }
+func (s *recordingSpan) End()                               { s.ended = true }
+
+func TestClient_Tracer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{})
+	}))
+	defer server.Close()
+
+	providerTracer := &recordingTracer{}
+	contextTracer := &recordingTracer{}
+
+	client, err := newClient(&Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true, Tracer: providerTracer})
+	if err != nil {
+		t.Fatalf("newClient() error = %v", err)
+	}
+
+	_, err = client.getRecords(context.Background(), 7, "")
+	if err != nil {
+		t.Fatalf("getRecords() error = %v", err)
+	}
+
+	err = client.deleteRecord(WithTracer(context.Background(), contextTracer), 7, 42)
+	if err == nil {
+		t.Fatal("deleteRecord() error = nil, want the 404")
+	}
+
+	if len(providerTracer.spans) != 1 || len(contextTracer.spans) != 1 {
+		t.Fatalf("got %d provider and %d context spans, want 1 and 1", len(providerTracer.spans), len(contextTracer.spans))
+	}
+
+	tests := []struct {
+		span       *recordingSpan
+		wantName   string
+		wantMethod string
+		wantURL    string
+		wantStatus int
+		wantErr    bool
+	}{
+		{
+			span:       providerTracer.spans[0],
+			wantName:   "tecnocratica.getRecords",
+			wantMethod: http.MethodGet,
+			wantURL:    server.URL + "/dns/zones/7/records",
+			wantStatus: http.StatusOK,
+		},
+		{
+			span:       contextTracer.spans[0],
+			wantName:   "tecnocratica.deleteRecord",
+			wantMethod: http.MethodDelete,
+			wantURL:    server.URL + "/dns/zones/7/records/42",
+			wantStatus: http.StatusNotFound,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.wantName, func(t *testing.T) {
+			if tt.span.name != tt.wantName {
+				t.Errorf("span name = %q, want %q", tt.span.name, tt.wantName)
+			}
+			if !tt.span.ended {
+				t.Error("span was not ended")
+			}
+			if got := tt.span.attributes["http.request.method"]; got != tt.wantMethod {
+				t.Errorf("http.request.method = %v, want %v", got, tt.wantMethod)
+			}
+			if got := tt.span.attributes["url.full"]; got != tt.wantURL {
+				t.Errorf("url.full = %v, want %v", got, tt.wantURL)
+			}
+			if got := tt.span.attributes["http.response.status_code"]; got != tt.wantStatus {
+				t.Errorf("http.response.status_code = %v, want %v", got, tt.wantStatus)
+			}
+			if got := tt.span.attributes["tecnocratica.zone_id"]; got != 7 {
+				t.Errorf("tecnocratica.zone_id = %v, want 7", got)
+			}
+			if (tt.span.err != nil) != tt.wantErr {
+				t.Errorf("span error = %v, wantErr %v", tt.span.err, tt.wantErr)
 			}
 		})
 	}
@@ -2,4 +2,9 @@ module github.com/libdns/tecnocratica
 
 go 1.25.5
 
-require github.com/libdns/libdns v1.1.1
+require (
+	github.com/libdns/libdns v1.1.1
+	golang.org/x/net v0.54.0
+)
+
+require golang.org/x/text v0.37.0 // indirect
@@ -1,12 +1,30 @@
 package tecnocratica
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
 	"github.com/libdns/libdns"
+	"golang.org/x/net/idna"
 )
 
 // Provider implements DNS record manipulation with neodigit/virtualname.
@@ -14,374 +32,3063 @@ type Provider struct {
 	// The neodigit/virtualname api token.
 	APIToken string `json:"api_token,omitempty"`
 	APIURL   string `json:"api_url,omitempty"`
+
+	// AllowInsecureHTTP allows an APIURL that does not use HTTPS, e.g. a local
+	// test server. The API token is then sent in cleartext.
+	AllowInsecureHTTP bool `json:"allow_insecure_http,omitempty"`
+
+	// APIPathPrefix is the path, relative to APIURL, under which the DNS endpoints
+	// are mounted. It defaults to DefaultAPIPathPrefix and must not start with a slash.
+	APIPathPrefix string `json:"api_path_prefix,omitempty"`
+
+	// AuthHeaderName is the request header carrying the API token. It defaults
+	// to DefaultAuthHeaderName, or to Authorization when BearerAuth is set.
+	AuthHeaderName string `json:"auth_header_name,omitempty"`
+
+	// BearerAuth sends the API token with the Bearer scheme, i.e. as
+	// "Authorization: Bearer <token>" unless AuthHeaderName names another header.
+	BearerAuth bool `json:"bearer_auth,omitempty"`
+
+	// RequestModifier, when set, is called with every API request right before it
+	// is sent, after the token and the other standard headers are set, e.g. to add
+	// the headers an API gateway requires. It may override the standard headers.
+	RequestModifier func(*http.Request) `json:"-"`
+
+	// Recorder, when set, captures every API request and response, with the API
+	// token and the headers set by RequestModifier redacted, for troubleshooting.
+	// See NewRequestRecorder.
+	Recorder *RequestRecorder `json:"-"`
+
+	// UserAgent identifies the application using the provider. It is sent in
+	// the User-Agent header, followed by the name and version of this library.
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// PaceRateLimit spaces out requests according to the rate-limit headers
+	// returned by the API, slowing down as the remaining quota approaches zero.
+	PaceRateLimit bool `json:"pace_rate_limit,omitempty"`
+
+	// RequestsPerSecond, when positive, limits the requests sent to the API to
+	// this rate, with a little random jitter. Requests wait for their turn or
+	// until their context is done. The limit is shared by every operation made
+	// through the provider.
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+
+	// RetryBudget is the number of retries shared by all the requests of one
+	// operation, e.g. every update of a SetRecords call. Requests that fail
+	// because the API is unreachable, overloaded (429) or erroring (5xx) are
+	// retried until the budget is spent. Zero disables these retries.
+	RetryBudget int `json:"retry_budget,omitempty"`
+
+	// OnRateLimit, when set, is called with the rate-limit state reported by
+	// every response that carries rate-limit headers, so the application can
+	// back off before the API starts rejecting requests.
+	OnRateLimit func(RateLimit) `json:"-"`
+
+	// Logger, when set, receives diagnostics such as skipped records and the
+	// status of each API request.
+	Logger Logger `json:"-"`
+
+	// LooseDelete makes DeleteRecords fall back to deleting a record of the same
+	// name and type when no record matches the content exactly. By default such
+	// records are not deleted and DeleteRecords fails with ErrRecordNotFound, so a
+	// zone with several records on one name only loses the ones that were asked for.
+	LooseDelete bool `json:"loose_delete,omitempty"`
+
+	// FailOnMissingDelete makes DeleteRecords return an error wrapping
+	// ErrRecordNotFound that lists the records it could not find. By default
+	// they are only left out of the result.
+	FailOnMissingDelete bool `json:"fail_on_missing_delete,omitempty"`
+
+	// ProtectedRecords lists records that must never be removed, e.g. the apex A
+	// and MX records of a shared zone. DeleteRecords keeps them and reports them
+	// in an error wrapping ErrProtectedRecord, SetRecords and ReplaceZone fail
+	// rather than delete them, and DeleteRecordsMatching skips them. They may
+	// still be updated.
+	ProtectedRecords []ProtectedRecord `json:"protected_records,omitempty"`
+
+	// Tracer, when set, wraps every API call in a span. A tracer carried by the
+	// context (see WithTracer) takes precedence.
+	Tracer Tracer `json:"-"`
+
+	// OnChange, when set, is called with every record created, updated or deleted
+	// by AppendRecords, SetRecords and DeleteRecords, after the call made its
+	// changes. The changes of a failed SetRecords are rolled back and not reported.
+	OnChange func(ChangeEvent) `json:"-"`
+
+	// Metrics, when set, receives counters of the records created, updated and
+	// deleted and of the failed API calls.
+	Metrics Metrics `json:"-"`
+
+	// ApexCNAMEAsAlias rewrites CNAME records at the zone apex into ALIAS records
+	// instead of rejecting them with ErrApexCNAME.
+	ApexCNAMEAsAlias bool `json:"apex_cname_as_alias,omitempty"`
+
+	// IncludeDisabled makes GetRecords also return records that are disabled in
+	// the control panel. Their ProviderData reports them as disabled.
+	IncludeDisabled bool `json:"include_disabled,omitempty"`
+
+	// SortRecords makes GetRecords and the other listing methods return records
+	// sorted by name, type and data instead of in the order the API sends them,
+	// so listings of an unchanged zone can be compared. WalkRecords is not sorted.
+	SortRecords bool `json:"sort_records,omitempty"`
+
+	// StrictParsing makes GetRecords fail on records that cannot be converted to
+	// libdns records instead of skipping them.
+	StrictParsing bool `json:"strict_parsing,omitempty"`
+
+	// ResolveParentZone lets the record operations be given any name inside a
+	// zone instead of the zone itself, e.g. www.example.com for example.com: the
+	// zone with the longest name the given name ends in is used. Relative record
+	// names stay relative to the given name. ReplaceZone, DeleteAllRecords and the
+	// other whole-zone operations still need the zone name.
+	ResolveParentZone bool `json:"resolve_parent_zone,omitempty"`
+
+	// ApexNotation is how records at the zone apex are named in API requests:
+	// ApexNotationAt ("@", the default) or ApexNotationZone (the bare zone name),
+	// depending on what the API expects. Both are understood in responses.
+	ApexNotation string `json:"apex_notation,omitempty"`
+
+	// PreserveTXTQuotes keeps the surrounding double quotes of TXT values, for
+	// values that legitimately start and end with quotes. By default they are stripped.
+	PreserveTXTQuotes bool `json:"preserve_txt_quotes,omitempty"`
+
+	// MinTTL and MaxTTL bound the TTL of created and updated records.
+	// Out-of-range TTLs are clamped instead of being rejected by the API. Zero means no bound.
+	MinTTL time.Duration `json:"min_ttl,omitempty"`
+	MaxTTL time.Duration `json:"max_ttl,omitempty"`
+
+	// DefaultTTL is the TTL of created and updated records given without one.
+	// Zero leaves the TTL out of the request, so the API applies its own default.
+	DefaultTTL time.Duration `json:"default_ttl,omitempty"`
+
+	// VerifyEndpoint checks once, before the first operation, that APIURL points
+	// at the API and not at a web page or unrelated host.
+	VerifyEndpoint bool `json:"verify_endpoint,omitempty"`
+
+	// MaxResponseBytes caps the size of the API responses that are read, so a
+	// misbehaving endpoint cannot exhaust memory. Zero means DefaultMaxResponseBytes.
+	MaxResponseBytes int64 `json:"max_response_bytes,omitempty"`
+
+	// BulkCreate makes AppendRecords create several records with one request to
+	// the records/bulk endpoint, for API versions that have it. The endpoint is not
+	// part of the documented API, so records are created one by one by default.
+	// A failed bulk request fails the whole batch.
+	BulkCreate bool `json:"bulk_create,omitempty"`
+
+	// MaxIdleConns, MaxIdleConnsPerHost and IdleConnTimeout tune the connection
+	// pool of the transport used to reach the API, e.g. to keep more connections
+	// to the API host open during bulk operations (the net/http default is 2 per
+	// host). Zero values keep the net/http defaults; when all are zero the
+	// default transport is used.
+	MaxIdleConns        int           `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost int           `json:"max_idle_conns_per_host,omitempty"`
+	IdleConnTimeout     time.Duration `json:"idle_conn_timeout,omitempty"`
+
+	// TLSMinVersion is the lowest TLS version accepted from the API, "1.2" or
+	// "1.3". It defaults to the crypto/tls default. The transport used when it is
+	// set still negotiates HTTP/2 with the API.
+	TLSMinVersion string `json:"tls_min_version,omitempty"`
+
+	pacerOnce     sync.Once
+	pacer         *pacer
+	throttle      throttle
+	noBulkCreate  atomic.Bool
+	transportOnce sync.Once
+	transport     *http.Transport
+
+	verifyMu sync.Mutex
+	verified bool
+
+	zoneLocksMu sync.Mutex
+	zoneLocks   map[string]*zoneLock
+}
+
+// Environment variables read by NewProviderFromEnv.
+const (
+	envAPIToken = "NEODIGIT_TOKEN"
+	envAPIURL   = "NEODIGIT_API_URL"
+)
+
+// NewProviderFromEnv returns a Provider configured from the NEODIGIT_TOKEN and,
+// optionally, NEODIGIT_API_URL environment variables. It fails when no token is set.
+func NewProviderFromEnv() (*Provider, error) {
+	token := os.Getenv(envAPIToken)
+	if token == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", envAPIToken)
+	}
+
+	return &Provider{
+		APIToken: token,
+		APIURL:   os.Getenv(envAPIURL),
+	}, nil
+}
+
+// Clone returns a copy of the provider with the same settings. The copy shares the
+// provider's connection pool, but keeps its own rate-limit pacing and verification
+// state, which belong to the token in use.
+func (p *Provider) Clone() *Provider {
+	clone := &Provider{
+		APIToken:            p.APIToken,
+		APIURL:              p.APIURL,
+		AllowInsecureHTTP:   p.AllowInsecureHTTP,
+		APIPathPrefix:       p.APIPathPrefix,
+		AuthHeaderName:      p.AuthHeaderName,
+		BearerAuth:          p.BearerAuth,
+		RequestModifier:     p.RequestModifier,
+		Recorder:            p.Recorder,
+		UserAgent:           p.UserAgent,
+		PaceRateLimit:       p.PaceRateLimit,
+		RequestsPerSecond:   p.RequestsPerSecond,
+		RetryBudget:         p.RetryBudget,
+		OnRateLimit:         p.OnRateLimit,
+		Logger:              p.Logger,
+		LooseDelete:         p.LooseDelete,
+		FailOnMissingDelete: p.FailOnMissingDelete,
+		ProtectedRecords:    slices.Clone(p.ProtectedRecords),
+		Tracer:              p.Tracer,
+		Metrics:             p.Metrics,
+		OnChange:            p.OnChange,
+		ApexCNAMEAsAlias:    p.ApexCNAMEAsAlias,
+		IncludeDisabled:     p.IncludeDisabled,
+		SortRecords:         p.SortRecords,
+		StrictParsing:       p.StrictParsing,
+		PreserveTXTQuotes:   p.PreserveTXTQuotes,
+		ApexNotation:        p.ApexNotation,
+		ResolveParentZone:   p.ResolveParentZone,
+		MinTTL:              p.MinTTL,
+		MaxTTL:              p.MaxTTL,
+		DefaultTTL:          p.DefaultTTL,
+		VerifyEndpoint:      p.VerifyEndpoint,
+		MaxResponseBytes:    p.MaxResponseBytes,
+		BulkCreate:          p.BulkCreate,
+		MaxIdleConns:        p.MaxIdleConns,
+		MaxIdleConnsPerHost: p.MaxIdleConnsPerHost,
+		TLSMinVersion:       p.TLSMinVersion,
+		IdleConnTimeout:     p.IdleConnTimeout,
+	}
+
+	// Whether the API has a bulk endpoint does not depend on the token
+	clone.noBulkCreate.Store(p.noBulkCreate.Load())
+
+	// Build the shared transport, if any, so both providers use the same one
+	p.httpClient()
+	if p.transport != nil {
+		clone.transportOnce.Do(func() { clone.transport = p.transport })
+	}
+
+	return clone
+}
+
+// WithToken returns a copy of the provider, as made by Clone, that uses the given
+// API token, e.g. to act on behalf of another tenant.
+func (p *Provider) WithToken(token string) *Provider {
+	clone := p.Clone()
+	clone.APIToken = token
+
+	return clone
+}
+
+// Logger is the interface used to report diagnostics. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...any)
+}
+
+// logf logs through the configured Logger, if any.
+func (p *Provider) logf(format string, v ...any) {
+	if p.Logger != nil {
+		p.Logger.Printf(format, v...)
+	}
+}
+
+// Tracer starts the spans wrapping API calls. It mirrors the OpenTelemetry
+// trace.Tracer so an adapter only has to forward the calls.
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is a single traced API call.
+type Span interface {
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// Names of the counters reported to Metrics.
+const (
+	MetricRecordsCreated = "records_created"
+	MetricRecordsUpdated = "records_updated"
+	MetricRecordsDeleted = "records_deleted"
+	MetricAPIErrors      = "api_errors"
+)
+
+// Metrics receives counter increments, e.g. to expose them as Prometheus counters.
+// Add may be called concurrently.
+type Metrics interface {
+	Add(name string, delta int)
+}
+
+// ChangeOp is the kind of change a ChangeEvent reports.
+type ChangeOp string
+
+// Kinds of changes reported to Provider.OnChange.
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent describes a record change made through the provider.
+type ChangeEvent struct {
+	Op   ChangeOp
+	Zone string
+
+	// Record is the record as created or updated, or as it was before it was deleted.
+	Record libdns.Record
+}
+
+// Values of Provider.ApexNotation.
+const (
+	ApexNotationAt   = "@"
+	ApexNotationZone = "zone"
+)
+
+// ErrZoneNotFound is returned when the account has no zone with the given name.
+var ErrZoneNotFound = errors.New("zone not found")
+
+// ErrZoneExists is returned by CreateZone when the zone already exists.
+var ErrZoneExists = errors.New("zone already exists")
+
+// ErrRecordNotFound is returned by DeleteRecords when a record to delete does not
+// match the data of the existing records of its (name, type), or, when
+// FailOnMissingDelete is set, when some of the records to delete do not exist.
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrProtectedRecord is returned when a record listed in Provider.ProtectedRecords
+// would be removed.
+var ErrProtectedRecord = errors.New("record is protected")
+
+// ErrApexCNAME is returned when a CNAME record is requested at the zone apex.
+var ErrApexCNAME = errors.New("CNAME records are not allowed at the zone apex")
+
+// ErrUnsupportedRecordType is returned when a record to be written has a type
+// the converters do not handle.
+var ErrUnsupportedRecordType = errors.New("unsupported record type")
+
+// supportedRecordTypes are the record types the converters handle.
+var supportedRecordTypes = []string{
+	"A", "AAAA", "CAA", "CNAME", "DNSKEY", "DS", "MX", "NS", "PTR", "SRV", "SSHFP", "TXT",
+}
+
+// SupportedRecordTypes returns the record types that can be written through the
+// provider. Records of other types are rejected by AppendRecords and SetRecords.
+func SupportedRecordTypes() []string {
+	return slices.Clone(supportedRecordTypes)
+}
+
+// knownRecordTypes are the DNS record types accepted as a type filter.
+var knownRecordTypes = []string{
+	"A", "AAAA", "ALIAS", "CAA", "CNAME", "DNSKEY", "DS", "HTTPS", "MX", "NS",
+	"PTR", "SOA", "SPF", "SRV", "SSHFP", "SVCB", "TLSA", "TXT",
+}
+
+// APIVersionUnknown is the version GetAPIInfo reports when the API does not
+// report its version.
+const APIVersionUnknown = "unknown"
+
+// Features the API may list in APIInfo.
+const (
+	// FeatureBulkCreate is the endpoint creating several records at once.
+	FeatureBulkCreate = "bulk_create"
+)
+
+// GetAPIInfo asks the API for its version and the optional features it supports,
+// from the version endpoint under APIURL. Like the bulk endpoint, that endpoint is
+// not part of the documented API and may not exist: an API without it (404) is
+// reported with APIVersionUnknown and no features rather than as an error.
+//
+// When the API lists its features, they decide whether Provider.BulkCreate uses
+// the bulk endpoint: a list without FeatureBulkCreate turns it off, as if the API
+// had answered 404, and a list with it turns it back on.
+func (p *Provider) GetAPIInfo(ctx context.Context) (APIInfo, error) {
+	client, err := newClient(p)
+	if err != nil {
+		return APIInfo{}, err
+	}
+
+	info, err := client.getAPIInfo(ctx)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return APIInfo{Version: APIVersionUnknown}, nil
+	}
+	if err != nil {
+		return APIInfo{}, fmt.Errorf("failed to get API info: %w", err)
+	}
+
+	if info.Version == "" {
+		info.Version = APIVersionUnknown
+	}
+
+	if len(info.Features) > 0 {
+		p.noBulkCreate.Store(!info.Supports(FeatureBulkCreate))
+	}
+
+	return *info, nil
+}
+
+// ErrUnreachable is returned by Verify when the API cannot be reached.
+var ErrUnreachable = errors.New("API unreachable")
+
+// Verify checks that the API is reachable and accepts the token by making a
+// lightweight authenticated request. A rejected token yields ErrUnauthorized,
+// while DNS resolution failures, refused connections and timeouts yield ErrUnreachable.
+func (p *Provider) Verify(ctx context.Context) error {
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.getZones(ctx)
+	if err == nil {
+		return nil
+	}
+
+	var urlErr *url.Error
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return fmt.Errorf("verify: %w", err)
+	case errors.As(err, &urlErr) && urlErr.Timeout():
+		return fmt.Errorf("verify: %w: request timed out: %w", ErrUnreachable, err)
+	case errors.As(err, &urlErr):
+		return fmt.Errorf("verify: %w: %w", ErrUnreachable, err)
+	default:
+		return fmt.Errorf("verify: %w", err)
+	}
 }
 
 // getZoneID finds the zone ID for a given zone name.
 func (p *Provider) getZoneID(ctx context.Context, zone string) (int, error) {
-	client, err := newClient(p)
+	z, err := p.lookupZone(ctx, zone, false)
 	if err != nil {
 		return 0, err
 	}
 
+	return z.ID, nil
+}
+
+// resolveZone finds the zone the records of zone are handled in: the zone itself
+// or, with ResolveParentZone set, the zone enclosing the name. It returns the zone
+// ID and the name to handle the records with, which is zone unless a parent zone
+// was found.
+func (p *Provider) resolveZone(ctx context.Context, zone string) (int, string, error) {
+	z, err := p.lookupZone(ctx, zone, p.ResolveParentZone)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return z.ID, p.resolvedZoneName(z, zone), nil
+}
+
+// resolvedZoneName returns the name to handle the records of zone with once
+// they were found to belong to z: zone itself, or the name of the parent zone.
+func (p *Provider) resolvedZoneName(z Zone, zone string) string {
+	if zoneMatches(z, zone) {
+		return zone
+	}
+
+	p.logf("using zone %s for %s", z.Name, zone)
+
+	return z.Name
+}
+
+// lookupZone finds the zone with the given name or, when enclosing is set, the
+// zone enclosing the name.
+func (p *Provider) lookupZone(ctx context.Context, zone string, enclosing bool) (Zone, error) {
+	client, err := newClient(p)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	if p.VerifyEndpoint {
+		err = p.verifyEndpoint(ctx, client)
+		if err != nil {
+			return Zone{}, err
+		}
+	}
+
+	if enclosing {
+		return findEnclosingZone(ctx, client, zone)
+	}
+
+	return findZone(ctx, client, zone)
+}
+
+// normalizeZoneName returns the form zone names are compared in: lowercase and
+// without the trailing dot, as DNS names are case-insensitive.
+func normalizeZoneName(name string) string {
+	return strings.ToLower(asciiName(strings.TrimSuffix(name, ".")))
+}
+
+// asciiName converts the Unicode labels of a domain name, e.g. "münchen", to the
+// punycode form the API uses, "xn--mnchen-3ya". ASCII labels such as
+// "_acme-challenge" or "*" are kept as they are, and so are labels IDNA rejects.
+func asciiName(name string) string {
+	if isASCII(name) {
+		return name
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		if ascii, err := idna.Lookup.ToASCII(label); err == nil {
+			labels[i] = ascii
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// isASCII reports whether s holds only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// findZone looks up a zone by name in the zone list of the account.
+func findZone(ctx context.Context, client *Client, zone string) (Zone, error) {
 	zones, err := client.getZones(ctx)
 	if err != nil {
-		return 0, err
+		return Zone{}, err
+	}
+
+	if z, ok := pickZone(zones, zone, false); ok {
+		return z, nil
+	}
+
+	return Zone{}, fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+}
+
+// findEnclosingZone looks up the zone of the account a name belongs to: the
+// zone with the longest name the name ends in, e.g. example.com for
+// www.dev.example.com when the account has example.com but not dev.example.com.
+func findEnclosingZone(ctx context.Context, client *Client, name string) (Zone, error) {
+	zones, err := client.getZones(ctx)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	if z, ok := pickZone(zones, name, true); ok {
+		return z, nil
 	}
 
-	// Normalize the zone name (ensure it ends with a dot)
-	zoneName := strings.TrimSuffix(zone, ".")
+	return Zone{}, fmt.Errorf("%w: %s", ErrZoneNotFound, name)
+}
+
+// pickZone finds the zone with the given name among zones or, when enclosing is
+// set, the zone enclosing the name.
+func pickZone(zones []Zone, name string, enclosing bool) (Zone, bool) {
+	candidates := []string{name}
+	if enclosing {
+		// Walk up the labels, so the longest matching zone is found first
+		labels := strings.Split(normalizeZoneName(name), ".")
+		candidates = candidates[:0]
+		for i := range labels {
+			candidates = append(candidates, strings.Join(labels[i:], "."))
+		}
+	}
 
-	for _, z := range zones {
-		if strings.TrimSuffix(z.Name, ".") == zoneName {
-			return z.ID, nil
+	for _, candidate := range candidates {
+		for _, z := range zones {
+			if zoneMatches(z, candidate) {
+				return z, true
+			}
 		}
 	}
 
-	return 0, fmt.Errorf("zone not found: %s", zone)
+	return Zone{}, false
 }
 
-// libdnsToInternal converts a libdns.Record to an internal Record.
-func libdnsToInternal(zone string, rec libdns.Record) Record {
-	rr := rec.RR()
+// zoneMatches reports whether z is the zone with the given name. Internationalized
+// zones may be given in punycode, as in the name, or in Unicode, as in the
+// human-readable name.
+func zoneMatches(z Zone, zone string) bool {
+	zoneName := normalizeZoneName(zone)
+
+	return normalizeZoneName(z.Name) == zoneName || (z.HumanName != "" && normalizeZoneName(z.HumanName) == zoneName)
+}
+
+// rebaseRecords makes the relative names of records given for the zone from
+// absolute, so they keep their meaning once the records are handled in the
+// enclosing zone to. Records with absolute names are kept as they are. Rebased
+// records keep their type and ProviderData.
+func rebaseRecords(from, to string, records []libdns.Record) []libdns.Record {
+	if from == to {
+		return records
+	}
+
+	rebased := make([]libdns.Record, len(records))
+	for i, rec := range records {
+		rr := rec.RR()
+		if strings.HasSuffix(rr.Name, ".") {
+			rebased[i] = rec
+			continue
+		}
+
+		rr.Name = absoluteName(from, rr.Name)
+
+		// Parsing gives the record back its concrete type, which the ProviderData
+		// (record ID and options) needs to travel along
+		parsed, err := rr.Parse()
+		if err != nil {
+			rebased[i] = rr
+			continue
+		}
+		if pd, ok := providerData(rec); ok {
+			parsed = withProviderData(parsed, pd)
+		}
+		rebased[i] = parsed
+	}
+
+	return rebased
+}
+
+// zoneLock is the lock of a zone. It is a channel holding a token while the zone
+// is locked, so waiting for it can be abandoned when the context is done.
+type zoneLock struct {
+	held chan struct{}
+
+	// users counts the calls holding or waiting for the lock, guarded by
+	// zoneLocksMu; the lock is forgotten once it drops to zero
+	users int
+}
+
+// lockZone serializes the record changes of a zone, so that concurrent calls
+// for the same zone do not interleave their reads and writes. Calls for other
+// zones are not blocked. It returns the function releasing the lock, or the
+// error of ctx if it is done before the lock is acquired.
+func (p *Provider) lockZone(ctx context.Context, zone string) (func(), error) {
+	key := normalizeZoneName(zone)
+
+	p.zoneLocksMu.Lock()
+	if p.zoneLocks == nil {
+		p.zoneLocks = make(map[string]*zoneLock)
+	}
+	lock, ok := p.zoneLocks[key]
+	if !ok {
+		lock = &zoneLock{held: make(chan struct{}, 1)}
+		p.zoneLocks[key] = lock
+	}
+	lock.users++
+	p.zoneLocksMu.Unlock()
+
+	leave := func() {
+		p.zoneLocksMu.Lock()
+		lock.users--
+		if lock.users == 0 {
+			delete(p.zoneLocks, key)
+		}
+		p.zoneLocksMu.Unlock()
+	}
+
+	select {
+	case lock.held <- struct{}{}:
+	case <-ctx.Done():
+		leave()
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-lock.held
+		leave()
+	}, nil
+}
+
+// notifyChanges reports the records an operation created, updated and deleted in
+// zone to the OnChange hook. Operations defer it before locking the zone, with
+// the slices they fill in, so the changes are reported once the zone is unlocked,
+// letting OnChange change it in turn, and even when the operation fails partway.
+// A nil slice pointer stands for changes of a kind the operation does not make.
+func (p *Provider) notifyChanges(zone string, created, updated, deleted *[]libdns.Record) {
+	if created != nil {
+		p.notify(ChangeCreate, zone, *created...)
+	}
+	if updated != nil {
+		p.notify(ChangeUpdate, zone, *updated...)
+	}
+	if deleted != nil {
+		p.notify(ChangeDelete, zone, *deleted...)
+	}
+}
+
+// notify reports changes of the given kind to the OnChange hook, if any.
+func (p *Provider) notify(op ChangeOp, zone string, records ...libdns.Record) {
+	if p.OnChange == nil {
+		return
+	}
+
+	for _, rec := range records {
+		p.OnChange(ChangeEvent{Op: op, Zone: zone, Record: rec})
+	}
+}
+
+// verifyEndpoint probes the API URL once; a successful probe is remembered,
+// a failed one is retried on the next call.
+func (p *Provider) verifyEndpoint(ctx context.Context, client *Client) error {
+	p.verifyMu.Lock()
+	defer p.verifyMu.Unlock()
+
+	if p.verified {
+		return nil
+	}
+
+	err := client.probe(ctx)
+	if err != nil {
+		return err
+	}
 
-	// Convert relative name to the format expected by the API
-	// The API expects names relative to the zone, or "@" for the zone apex
-	name := rr.Name
+	p.verified = true
 
-	// Strip the zone suffix if present (FQDN to relative conversion)
-	// Normalize both name and zone by removing trailing dots for consistent matching
+	return nil
+}
+
+// apiName converts a libdns record name to the format expected by the API:
+// relative to the zone, or "@" for the zone apex. See relativeName.
+func apiName(zone, name string) string {
+	relative, _ := relativeName(zone, name)
+	return relative
+}
+
+// relativeName is the single place record names are interpreted. The zone and
+// the name may each be given with or without a trailing dot, and letter case is
+// ignored. The name is one of:
+//
+//   - the apex: "", "@" or the zone itself, giving "@"
+//   - a name inside the zone: one or more labels followed by the zone, giving
+//     those labels
+//   - anything else: a relative name or a name outside the zone, returned as
+//     given and reported as not qualified
+//
+// It reports whether the name was recognized as the apex or as a name ending in
+// the zone.
+func relativeName(zone, name string) (string, bool) {
+	zone, name = asciiName(zone), asciiName(name)
 	normalizedZone := strings.TrimSuffix(zone, ".")
 	normalizedName := strings.TrimSuffix(name, ".")
-	zoneSuffix := "." + normalizedZone
 
-	// Use CutSuffix for cleaner suffix removal
-	if after, found := strings.CutSuffix(normalizedName, zoneSuffix); found {
-		name = after
+	if normalizedName == "" || normalizedName == "@" || sameName(normalizedName, normalizedZone) {
+		return "@", true
+	}
+
+	// The suffix includes the separating dot, so the zone is only removed at a label
+	// boundary and "fooexample.com" is not mistaken for a name inside "example.com"
+	suffix := "." + normalizedZone
+	if len(normalizedName) > len(suffix) && sameName(normalizedName[len(normalizedName)-len(suffix):], suffix) {
+		return normalizedName[:len(normalizedName)-len(suffix)], true
+	}
+
+	// Wildcards need no special case: "*" and "*.sub" are plain labels that are
+	// kept, star included
+	return name, false
+}
+
+// sameName reports whether two record names are equal. DNS names are case-insensitive.
+func sameName(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
+
+// sameRecordName reports whether two names of records of the zone are equal,
+// whatever their form: relative, fully-qualified, or either apex notation.
+func sameRecordName(zone, a, b string) bool {
+	return sameName(apiName(zone, a), apiName(zone, b))
+}
+
+// converter converts records between libdns and the API format.
+// Its zero value applies the default conversions.
+type converter struct {
+	// preserveTXTQuotes keeps the surrounding quotes of TXT values instead of stripping them.
+	preserveTXTQuotes bool
+
+	// apexZoneName names the zone apex by the bare zone name instead of "@".
+	apexZoneName bool
+}
+
+// converter returns the record converter matching the provider settings.
+func (p *Provider) converter() converter {
+	return converter{
+		preserveTXTQuotes: p.PreserveTXTQuotes,
+		apexZoneName:      p.ApexNotation == ApexNotationZone,
+	}
+}
+
+// apiName is like the apiName function but names the zone apex in the configured notation.
+func (c converter) apiName(zone, name string) string {
+	name = apiName(zone, name)
+	if name == "@" && c.apexZoneName {
+		return asciiName(strings.TrimSuffix(zone, "."))
+	}
+
+	return name
+}
+
+// libdnsToInternal converts a libdns.Record to an internal Record using the default conversions.
+func libdnsToInternal(zone string, rec libdns.Record) (Record, error) {
+	return converter{}.libdnsToInternal(zone, rec)
+}
+
+// internalToLibdns converts an internal Record to a libdns.Record using the default conversions.
+func internalToLibdns(zone string, rec Record) (libdns.Record, error) {
+	return converter{}.internalToLibdns(zone, rec)
+}
+
+// libdnsToInternal converts a libdns.Record to an internal Record using the provider settings.
+func (p *Provider) libdnsToInternal(zone string, rec libdns.Record) (Record, error) {
+	return p.converter().libdnsToInternal(zone, rec)
+}
+
+// internalToLibdns converts an internal Record to a libdns.Record using the provider settings.
+func (p *Provider) internalToLibdns(zone string, rec Record) (libdns.Record, error) {
+	return p.converter().internalToLibdns(zone, rec)
+}
+
+// libdnsToInternal converts a libdns.Record to an internal Record.
+// It returns an error when the record data does not have the layout of its type.
+func (c converter) libdnsToInternal(zone string, rec libdns.Record) (Record, error) {
+	rr := rec.RR()
+
+	name := c.apiName(zone, rr.Name)
+
+	// Parse priority from data field for MX and SRV records
+	priority := 0
+	data := rr.Data
+
+	// For TXT records, remove quotes if present (libdns adds them, but API doesn't store them)
+	if rr.Type == "TXT" && !c.preserveTXTQuotes {
+		data = unquoteTXT(data)
+	}
+
+	switch rr.Type {
+	case "MX":
+		// MX format: "priority target"
+		parts := strings.Fields(rr.Data)
+		if len(parts) != 2 {
+			return Record{}, fmt.Errorf("invalid MX data %q: want \"priority target\"", rr.Data)
+		}
+
+		pref, err := strconv.ParseUint(parts[0], 10, 16)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid MX priority %q: %w", parts[0], err)
+		}
+
+		priority = int(pref)
+		data = parts[1]
+	case "SRV":
+		// SRV format: "priority weight port target"
+		parts := strings.Fields(rr.Data)
+		if len(parts) != 4 {
+			return Record{}, fmt.Errorf("invalid SRV data %q: want \"priority weight port target\"", rr.Data)
+		}
+
+		var err error
+		priority, err = strconv.Atoi(parts[0])
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid SRV priority %q: %w", parts[0], err)
+		}
+
+		// Keep weight, port, and target in the content
+		data = strings.Join(parts[1:], " ")
+
+		err = validateSRVContent(data)
+		if err != nil {
+			return Record{}, err
+		}
+	case "SSHFP":
+		// SSHFP format: "algorithm fp-type fingerprint", stored as is in the content
+		var err error
+		data, err = normalizeSSHFPContent(rr.Data)
+		if err != nil {
+			return Record{}, err
+		}
+	case "DS":
+		// DS format: "key-tag algorithm digest-type digest", stored as is in the content
+		var err error
+		data, err = normalizeDSContent(rr.Data)
+		if err != nil {
+			return Record{}, err
+		}
+	case "DNSKEY":
+		// DNSKEY format: "flags protocol algorithm public-key", stored as is in the content
+		var err error
+		data, err = normalizeDNSKEYContent(rr.Data)
+		if err != nil {
+			return Record{}, err
+		}
+	case "A", "AAAA":
+		// Send addresses in canonical form so they compare equal to what the API stores
+		addr, err := netip.ParseAddr(data)
+		if err != nil {
+			return Record{}, fmt.Errorf("invalid %s address %q: %w", rr.Type, data, err)
+		}
+		data = addr.String()
+	}
+
+	// Provider-specific fields travel in the record's ProviderData
+	pd, _ := providerData(rec)
+
+	return Record{
+		Name:     name,
+		Type:     rr.Type,
+		Content:  data,
+		TTL:      int(roundTTL(rr.TTL).Seconds()),
+		Priority: priority,
+		Weight:   pd.Weight,
+		Disabled: pd.Disabled,
+		Proxied:  pd.Proxied,
+		Comment:  pd.Comment,
+	}, nil
+}
+
+// absoluteName converts a record name returned by the API to the absolute (FQDN)
+// name libdns expects, e.g. "_acme-challenge.git.example.com.".
+// The API may return relative names (e.g., "_acme-challenge.git" or "@")
+// or sometimes already-qualified names (e.g., "_acme-challenge.git.example.com").
+//
+// It is the inverse of apiName: names are interpreted by relativeName, and a
+// name outside the zone that ends in a dot is already absolute and kept.
+func absoluteName(zone, name string) string {
+	zone, name = asciiName(zone), asciiName(name)
+	normalizedZone := strings.TrimSuffix(zone, ".")
+
+	relative, qualified := relativeName(zone, name)
+	switch {
+	case relative == "@":
+		return normalizedZone + "."
+	case qualified, strings.HasSuffix(name, "."):
+		// Already qualified, keeping the letter case it was given in
+		return strings.TrimSuffix(name, ".") + "."
+	default:
+		return name + "." + normalizedZone + "."
+	}
+}
+
+// validateSRVContent checks that SRV content, as stored by the API, holds
+// "weight port target" with numeric weight and port.
+func validateSRVContent(content string) error {
+	parts := strings.Fields(content)
+	if len(parts) != 3 {
+		return fmt.Errorf("invalid SRV content %q: want \"weight port target\"", content)
+	}
+
+	_, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid SRV weight %q: %w", parts[0], err)
+	}
+
+	_, err = strconv.ParseUint(parts[1], 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid SRV port %q: %w", parts[1], err)
+	}
+
+	return nil
+}
+
+// normalizeSSHFPContent checks that SSHFP data holds "algorithm fp-type fingerprint"
+// with small integer algorithm and fingerprint type and a hexadecimal fingerprint,
+// and returns it with single spaces between the fields.
+func normalizeSSHFPContent(content string) (string, error) {
+	parts := strings.Fields(content)
+	if len(parts) != 3 {
+		return "", fmt.Errorf("invalid SSHFP data %q: want \"algorithm fp-type fingerprint\"", content)
+	}
+
+	_, err := strconv.ParseUint(parts[0], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSHFP algorithm %q: %w", parts[0], err)
+	}
+
+	_, err = strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid SSHFP fingerprint type %q: %w", parts[1], err)
+	}
+
+	_, err = hex.DecodeString(parts[2])
+	if err != nil {
+		return "", fmt.Errorf("invalid SSHFP fingerprint %q: %w", parts[2], err)
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// normalizeDSContent checks that DS data holds "key-tag algorithm digest-type digest"
+// and returns it with single spaces. A digest split into several hex chunks, as
+// zone files allow, is joined back together.
+func normalizeDSContent(content string) (string, error) {
+	parts := strings.Fields(content)
+	if len(parts) < 4 {
+		return "", fmt.Errorf("invalid DS data %q: want \"key-tag algorithm digest-type digest\"", content)
+	}
+
+	_, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid DS key tag %q: %w", parts[0], err)
+	}
+
+	_, err = strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid DS algorithm %q: %w", parts[1], err)
+	}
+
+	_, err = strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid DS digest type %q: %w", parts[2], err)
+	}
+
+	digest := strings.Join(parts[3:], "")
+	_, err = hex.DecodeString(digest)
+	if err != nil {
+		return "", fmt.Errorf("invalid DS digest %q: %w", digest, err)
+	}
+
+	return strings.Join([]string{parts[0], parts[1], parts[2], digest}, " "), nil
+}
+
+// normalizeDNSKEYContent checks that DNSKEY data holds "flags protocol algorithm public-key"
+// and returns it with single spaces. A public key split into several base64 chunks,
+// as zone files allow, is joined back together.
+func normalizeDNSKEYContent(content string) (string, error) {
+	parts := strings.Fields(content)
+	if len(parts) < 4 {
+		return "", fmt.Errorf("invalid DNSKEY data %q: want \"flags protocol algorithm public-key\"", content)
+	}
+
+	_, err := strconv.ParseUint(parts[0], 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNSKEY flags %q: %w", parts[0], err)
+	}
+
+	_, err = strconv.ParseUint(parts[1], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNSKEY protocol %q: %w", parts[1], err)
+	}
+
+	_, err = strconv.ParseUint(parts[2], 10, 8)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNSKEY algorithm %q: %w", parts[2], err)
+	}
+
+	key := strings.Join(parts[3:], "")
+	_, err = base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("invalid DNSKEY public key %q: %w", key, err)
+	}
+
+	return strings.Join([]string{parts[0], parts[1], parts[2], key}, " "), nil
+}
+
+// toInternal converts a libdns.Record to be created or updated into an internal Record,
+// applying the provider's policies on top of libdnsToInternal.
+func (p *Provider) toInternal(zone string, rec libdns.Record) (Record, error) {
+	rr := rec.RR()
+	if !slices.Contains(supportedRecordTypes, rr.Type) {
+		return Record{}, fmt.Errorf("%w: %s %s", ErrUnsupportedRecordType, rr.Name, rr.Type)
+	}
+	if rr.TTL < 0 {
+		return Record{}, fmt.Errorf("invalid TTL %v of %s %s: must not be negative", rr.TTL, rr.Name, rr.Type)
+	}
+
+	internalRec, err := p.libdnsToInternal(zone, rec)
+	if err != nil {
+		return Record{}, err
+	}
+	internalRec.TTL = p.ttlSeconds(rr.TTL)
+
+	// DNS forbids a CNAME at the zone apex, so the API would reject it anyway
+	if internalRec.Type == "CNAME" && apiName(zone, internalRec.Name) == "@" {
+		if !p.ApexCNAMEAsAlias {
+			return Record{}, fmt.Errorf("zone %s: %w", zone, ErrApexCNAME)
+		}
+		internalRec.Type = "ALIAS"
+	}
+
+	return internalRec, nil
+}
+
+// roundTTL rounds a TTL to the nearest second, as the DNS has no finer
+// precision. Positive TTLs become at least one second, since a zero TTL
+// would stand for the API default instead.
+func roundTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+
+	return max(ttl.Round(time.Second), time.Second)
+}
+
+// ValidateRecord checks a record the way AppendRecords and SetRecords do before
+// sending it, without contacting the API, e.g. to give immediate feedback in a
+// form. It returns the error those methods would fail with, such as an invalid
+// address, MX data without a priority, a negative TTL or an unsupported type.
+func (p *Provider) ValidateRecord(zone string, rec libdns.Record) error {
+	_, err := p.toInternal(zone, rec)
+	return err
+}
+
+// ttlSeconds converts a libdns TTL into the seconds sent to the API, rounding
+// it as roundTTL does and clamping to MinTTL and MaxTTL. A zero TTL becomes
+// DefaultTTL; without one it stays zero, which leaves the field out of the
+// request so the API applies its default. The Logger is warned when rounding
+// changes the TTL.
+func (p *Provider) ttlSeconds(ttl time.Duration) int {
+	if ttl <= 0 {
+		ttl = p.DefaultTTL
+	}
+	if ttl <= 0 {
+		return 0
+	}
+
+	if rounded := roundTTL(ttl); rounded != ttl {
+		p.logf("TTL %v is not a whole number of seconds, using %v", ttl, rounded)
+		ttl = rounded
+	}
+
+	if p.MinTTL > 0 && ttl < p.MinTTL {
+		ttl = p.MinTTL
+	}
+
+	if p.MaxTTL > 0 && ttl > p.MaxTTL {
+		ttl = p.MaxTTL
+	}
+
+	return int(ttl.Seconds())
+}
+
+// unquoteTXT removes one pair of double quotes surrounding a TXT value. Quotes
+// that are part of the value, like the closing one of `key="value"`, are kept.
+// A value of several quoted strings, as long DKIM keys are stored, is joined
+// into one text as RFC 1035 concatenates them.
+func unquoteTXT(data string) string {
+	if parts, ok := splitTXTStrings(data); ok && len(parts) > 1 {
+		return strings.Join(parts, "")
+	}
+
+	if len(data) >= 2 && strings.HasPrefix(data, `"`) && strings.HasSuffix(data, `"`) {
+		return data[1 : len(data)-1]
+	}
+
+	return data
+}
+
+// splitTXTStrings splits a TXT value made only of quoted strings separated by
+// whitespace, e.g. `"v=DKIM1; k=rsa; " "p=MIIB..."`, into the text of each string.
+// It reports false if anything lies outside the quotes.
+func splitTXTStrings(data string) ([]string, bool) {
+	var parts []string
+
+	for i := 0; i < len(data); {
+		switch {
+		case data[i] == ' ' || data[i] == '\t':
+			i++
+			continue
+		case data[i] != '"':
+			return nil, false
+		}
+
+		var part []byte
+		for i++; ; {
+			if i >= len(data) {
+				return nil, false
+			}
+			if data[i] == '"' {
+				i++
+				break
+			}
+			if data[i] == '\\' {
+				b, n, err := zoneFileEscape(data[i:])
+				if err != nil {
+					return nil, false
+				}
+				part = append(part, b)
+				i += n
+				continue
+			}
+			part = append(part, data[i])
+			i++
+		}
+		if i < len(data) && data[i] != ' ' && data[i] != '\t' {
+			return nil, false
+		}
+		parts = append(parts, string(part))
+	}
+
+	return parts, len(parts) > 0
+}
+
+// internalToLibdns converts an internal Record to a libdns.Record.
+// The zone parameter is required to reconstruct absolute domain names from relative names.
+func (c converter) internalToLibdns(zone string, rec Record) (libdns.Record, error) {
+	data := rec.Content
+
+	// For TXT records, strip quotes if the API returns them
+	// This ensures consistency with libdnsToInternal which also strips quotes
+	if rec.Type == "TXT" && !c.preserveTXTQuotes {
+		data = unquoteTXT(data)
+	}
+
+	// For MX and SRV records, libdns expects the priority to be part of the Data field
+	// Format: "priority target" for MX, or "priority weight port target" for SRV
+	// The Neodigit API stores priority separately in the Priority field
+	switch rec.Type {
+	case "MX":
+		data = fmt.Sprintf("%d %s", rec.Priority, rec.Content)
+	case "SRV":
+		// SRV: API stores priority in Priority field, "weight port target" in Content
+		err := validateSRVContent(rec.Content)
+		if err != nil {
+			return nil, err
+		}
+		data = fmt.Sprintf("%d %s", rec.Priority, rec.Content)
+	case "SSHFP":
+		var err error
+		data, err = normalizeSSHFPContent(rec.Content)
+		if err != nil {
+			return nil, err
+		}
+	case "DS":
+		var err error
+		data, err = normalizeDSContent(rec.Content)
+		if err != nil {
+			return nil, err
+		}
+	case "DNSKEY":
+		var err error
+		data, err = normalizeDNSKEYContent(rec.Content)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	name := rec.Name
+
+	// Handle SRV records with empty names by using a placeholder
+	// The Neodigit API may return SRV records with empty names which are valid in their system
+	// but don't pass libdns strict SRV naming validation (_service._proto.name)
+	if rec.Type == "SRV" && apiName(zone, name) == "@" {
+		// Use a placeholder that satisfies libdns validation
+		// This preserves the record data while allowing it to pass validation
+		name = "_service._tcp"
+	}
+
+	rr := libdns.RR{
+		Name: absoluteName(zone, name),
+		Type: rec.Type,
+		Data: data,
+		TTL:  time.Duration(rec.TTL) * time.Second,
+	}
+
+	// Parse the RR into a type-specific record
+	parsed, err := rr.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return withProviderData(parsed, ProviderData{
+		ID:       rec.ID,
+		Weight:   rec.Weight,
+		Disabled: rec.Disabled,
+		Proxied:  rec.Proxied,
+		Comment:  rec.Comment,
+	}), nil
+}
+
+// providerData returns the ProviderData attached to a libdns record, if any.
+func providerData(rec libdns.Record) (ProviderData, bool) {
+	var data any
+
+	switch r := rec.(type) {
+	case libdns.Address:
+		data = r.ProviderData
+	case libdns.CAA:
+		data = r.ProviderData
+	case libdns.CNAME:
+		data = r.ProviderData
+	case libdns.MX:
+		data = r.ProviderData
+	case libdns.NS:
+		data = r.ProviderData
+	case libdns.SRV:
+		data = r.ProviderData
+	case libdns.ServiceBinding:
+		data = r.ProviderData
+	case libdns.TXT:
+		data = r.ProviderData
+	}
+
+	pd, ok := data.(ProviderData)
+
+	return pd, ok
+}
+
+// RecordID returns the API identifier of a record returned by the provider,
+// such as the records created by AppendRecords. It reports false for records
+// that carry no identifier.
+func RecordID(rec libdns.Record) (int, bool) {
+	pd, ok := providerData(rec)
+	if !ok || pd.ID == 0 {
+		return 0, false
+	}
+
+	return pd.ID, true
+}
+
+// WithOptions returns a copy of rec carrying the given provider-specific options,
+// which AppendRecords and SetRecords send along with the record. Records of types
+// that libdns does not parse into a dedicated struct cannot carry options and are
+// returned unchanged.
+func WithOptions(rec libdns.Record, opts RecordOptions) libdns.Record {
+	if rr, ok := rec.(libdns.RR); ok {
+		parsed, err := rr.Parse()
+		if err != nil {
+			return rec
+		}
+		rec = parsed
+	}
+
+	pd, _ := providerData(rec)
+	pd.Comment = opts.Comment
+	pd.Proxied = opts.Proxied
+	pd.Disabled = opts.Disabled
+	pd.Weight = opts.Weight
+	pd.ClearComment = opts.ClearComment
+
+	return withProviderData(rec, pd)
+}
+
+// withProviderData attaches ProviderData to a type-specific libdns record.
+// Records without a ProviderData field (such as libdns.RR) are returned unchanged.
+func withProviderData(rec libdns.Record, data ProviderData) libdns.Record {
+	switch r := rec.(type) {
+	case libdns.Address:
+		r.ProviderData = data
+		return r
+	case libdns.CAA:
+		r.ProviderData = data
+		return r
+	case libdns.CNAME:
+		r.ProviderData = data
+		return r
+	case libdns.MX:
+		r.ProviderData = data
+		return r
+	case libdns.NS:
+		r.ProviderData = data
+		return r
+	case libdns.SRV:
+		r.ProviderData = data
+		return r
+	case libdns.ServiceBinding:
+		r.ProviderData = data
+		return r
+	case libdns.TXT:
+		r.ProviderData = data
+		return r
+	}
+
+	return rec
+}
+
+// GetRecords lists all the records in the zone.
+// Each returned record carries a ProviderData value with the API fields that
+// libdns has no place for, such as the load-balancing weight.
+func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.getRecords(ctx, zone, "")
+}
+
+// GetRecordsByType lists the records of the given type in the zone.
+// The type is filtered server-side, which keeps the response small when only
+// a few records are of interest (e.g. TXT records for ACME validation).
+func (p *Provider) GetRecordsByType(ctx context.Context, zone, recordType string) ([]libdns.Record, error) {
+	recordType = strings.ToUpper(recordType)
+
+	if !slices.Contains(knownRecordTypes, recordType) {
+		return nil, fmt.Errorf("unknown record type: %q", recordType)
+	}
+
+	return p.getRecords(ctx, zone, recordType)
+}
+
+// GetRecord lists the records of the zone with the given name and type.
+// The name may be relative to the zone, fully-qualified, or "@" for the apex.
+func (p *Provider) GetRecord(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	records, err := p.GetRecordsByType(ctx, zone, recordType)
+	if err != nil {
+		return nil, err
+	}
+
+	wantName := apiName(zone, name)
+
+	var matches []libdns.Record
+	for _, rec := range records {
+		if sameName(apiName(zone, rec.RR().Name), wantName) {
+			matches = append(matches, rec)
+		}
+	}
+
+	return matches, nil
+}
+
+// WalkRecords calls fn for each record of the zone, converting the records one
+// at a time instead of building a list of libdns records. The API response is
+// still fetched and decoded in full before fn is first called, so this does not
+// bound memory use for large zones. It stops at the first error returned by fn
+// and returns it.
+func (p *Provider) WalkRecords(ctx context.Context, zone string, fn func(libdns.Record) error) error {
+	return p.walkRecords(ctx, zone, "", nil, fn)
+}
+
+// GetRecordsWithZone lists all the records in the zone like GetRecords, and also
+// returns the ID of the zone, as reported by ListZoneInfos, so callers handling
+// several zones can tell them apart without looking the zone up again.
+func (p *Provider) GetRecordsWithZone(ctx context.Context, zone string) (int, []libdns.Record, error) {
+	zoneID, zone, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var libdnsRecords []libdns.Record
+
+	err = p.walkZoneRecords(ctx, zone, zoneID, "", nil, func(rec libdns.Record) error {
+		libdnsRecords = append(libdnsRecords, rec)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if p.SortRecords {
+		sortRecords(libdnsRecords)
+	}
+
+	return zoneID, libdnsRecords, nil
+}
+
+// allRecordsConcurrency bounds the number of zones GetAllRecords fetches at once.
+const allRecordsConcurrency = 4
+
+// GetAllRecords returns the records of every zone of the account, keyed by the
+// fully-qualified zone name, e.g. for an inventory. The zones are fetched a few
+// at a time. A zone that cannot be fetched is left out of the map, and the
+// others are still returned together with an error joining the failures.
+func (p *Provider) GetAllRecords(ctx context.Context) (map[string][]libdns.Record, error) {
+	infos, err := p.ListZoneInfos(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	all := make(map[string][]libdns.Record, len(infos))
+
+	sem := make(chan struct{}, allRecordsConcurrency)
+	var wg sync.WaitGroup
+	for _, info := range infos {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var records []libdns.Record
+			err := p.walkZoneRecords(ctx, info.Name, info.ID, "", nil, func(rec libdns.Record) error {
+				records = append(records, rec)
+				return nil
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to get records of zone %s: %w", info.Name, err))
+				return
+			}
+
+			if p.SortRecords {
+				sortRecords(records)
+			}
+			all[info.Name] = records
+		})
+	}
+	wg.Wait()
+
+	return all, errors.Join(errs...)
+}
+
+// getRecords lists the records in the zone, optionally filtered by type.
+func (p *Provider) getRecords(ctx context.Context, zone, recordType string) ([]libdns.Record, error) {
+	var libdnsRecords []libdns.Record
+
+	err := p.walkRecords(ctx, zone, recordType, nil, func(rec libdns.Record) error {
+		libdnsRecords = append(libdnsRecords, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.SortRecords {
+		sortRecords(libdnsRecords)
+	}
+
+	return libdnsRecords, nil
+}
+
+// sortRecords sorts records by name, type and data.
+func sortRecords(records []libdns.Record) {
+	slices.SortStableFunc(records, func(a, b libdns.Record) int {
+		ra, rb := a.RR(), b.RR()
+		return cmp.Or(
+			strings.Compare(ra.Name, rb.Name),
+			strings.Compare(ra.Type, rb.Type),
+			strings.Compare(ra.Data, rb.Data),
+		)
+	})
+}
+
+// walkRecords calls fn for each record in the zone, optionally filtered by type
+// and by match when it is not nil.
+func (p *Provider) walkRecords(ctx context.Context, zone, recordType string, match func(Record) bool, fn func(libdns.Record) error) error {
+	zoneID, zone, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	return p.walkZoneRecords(ctx, zone, zoneID, recordType, match, fn)
+}
+
+// walkZoneRecords is walkRecords for a zone whose ID is already known.
+func (p *Provider) walkZoneRecords(ctx context.Context, zone string, zoneID int, recordType string, match func(Record) bool, fn func(libdns.Record) error) error {
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
+
+	records, err := client.getRecords(ctx, zoneID, recordType)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		if record.Disabled && !p.IncludeDisabled {
+			continue
+		}
+		if match != nil && !match(record) {
+			continue
+		}
+
+		libdnsRec, err := p.internalToLibdns(zone, record)
+		if err != nil && p.StrictParsing {
+			return fmt.Errorf("failed to convert record %d (%s %s): %w", record.ID, record.Type, record.Name, err)
+		}
+		if err != nil {
+			// Skip records that can't be parsed
+			// This allows the operation to continue even if some records are invalid
+			p.logf("skipping record %d (%s %s): %v", record.ID, record.Type, record.Name, err)
+			continue
+		}
+
+		err = fn(libdnsRec)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FindRecordsByContent lists the records of the zone, of any type, whose content
+// is the given value, e.g. every record pointing at a decommissioned address.
+// The API has no content filter, so the zone is filtered client-side; addresses
+// match whatever their notation.
+func (p *Provider) FindRecordsByContent(ctx context.Context, zone, content string) ([]libdns.Record, error) {
+	want := content
+	if addr, err := netip.ParseAddr(content); err == nil {
+		want = addr.String()
+	}
+
+	var matches []libdns.Record
+
+	err := p.walkRecords(ctx, zone, "", func(rec Record) bool {
+		return canonicalContent(rec) == want
+	}, func(rec libdns.Record) error {
+		matches = append(matches, rec)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.SortRecords {
+		sortRecords(matches)
+	}
+
+	return matches, nil
+}
+
+// ListRecordsRaw returns the records of the zone as the API sent them, with their
+// IDs, priorities and untransformed content. It is meant for diagnosing records
+// that do not convert as expected.
+func (p *Provider) ListRecordsRaw(ctx context.Context, zone string) ([]Record, error) {
+	zoneID, err := p.getZoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.getRecords(ctx, zoneID, "")
+}
+
+// GetRecordRaw returns the JSON the API sent for a single record, without any conversion.
+// It is meant for troubleshooting records that fail to convert to libdns records.
+func (p *Provider) GetRecordRaw(ctx context.Context, zone string, recordID int) (json.RawMessage, error) {
+	zoneID, err := p.getZoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	return client.getRecordRaw(ctx, zoneID, recordID)
+}
+
+// AppendRecords adds records to the zone. It returns the records that were added.
+//
+// When some of the records cannot be created, the records that were added are still
+// returned, together with an error joining one error per failed record.
+func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	created, _, err := p.appendRecords(ctx, zone, records, false)
+	return created, err
+}
+
+// AppendIfAbsent is like AppendRecords but only creates the records the zone lacks,
+// so that provisioning can be repeated without creating duplicates. A record is
+// present when a record with the same name and type holds equivalent data, as
+// DeleteRecords compares it: domain names ignore case and a trailing dot, and TXT
+// values ignore surrounding quotes. It returns the records that were created and
+// the existing records that were skipped.
+func (p *Provider) AppendIfAbsent(ctx context.Context, zone string, records []libdns.Record) (created, skipped []libdns.Record, err error) {
+	return p.appendRecords(ctx, zone, records, true)
+}
+
+// appendRecords implements AppendRecords and, when ifAbsent is set, AppendIfAbsent.
+func (p *Provider) appendRecords(ctx context.Context, zone string, records []libdns.Record, ifAbsent bool) ([]libdns.Record, []libdns.Record, error) {
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, zone = rebaseRecords(zone, resolved, records), resolved
+
+	var appendedRecords []libdns.Record
+	defer p.notifyChanges(zone, &appendedRecords, nil, nil)
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Convert every record up front so invalid input fails before anything is created
+	internalRecs := make([]Record, 0, len(records))
+	for _, record := range records {
+		internalRec, err := p.toInternal(zone, record)
+		if err != nil {
+			return nil, nil, err
+		}
+		internalRecs = append(internalRecs, internalRec)
+	}
+
+	var skippedRecords []libdns.Record
+	if ifAbsent {
+		existingRecords, err := client.getRecords(ctx, zoneID, "")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		missing := internalRecs[:0]
+		for _, internalRec := range internalRecs {
+			i := slices.IndexFunc(existingRecords, func(existing Record) bool {
+				return sameRecordName(zone, existing.Name, internalRec.Name) && existing.Type == internalRec.Type &&
+					equivalentData(existing, internalRec) && existing.Priority == internalRec.Priority
+			})
+			if i < 0 {
+				missing = append(missing, internalRec)
+				continue
+			}
+
+			libdnsRec, err := p.internalToLibdns(zone, existingRecords[i])
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to convert existing record %d: %w", existingRecords[i].ID, err)
+			}
+			skippedRecords = append(skippedRecords, libdnsRec)
+		}
+		internalRecs = missing
+
+		if len(internalRecs) == 0 {
+			return nil, skippedRecords, nil
+		}
+	}
+
+	// A failed creation does not stop the others, so the caller learns about every
+	// record that was created and can retry or clean up just the failures
+	createdRecs, err := client.createRecords(ctx, zoneID, zone, internalRecs)
+	if err != nil {
+		err = fmt.Errorf("failed to append records to zone %s: %w", zone, err)
+	}
+
+	errs := []error{err}
+	for _, createdRec := range createdRecs {
+		libdnsRec, err := p.internalToLibdns(zone, createdRec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to convert created record %d: %w", createdRec.ID, err))
+			continue
+		}
+
+		appendedRecords = append(appendedRecords, libdnsRec)
+	}
+
+	return appendedRecords, skippedRecords, errors.Join(errs...)
+}
+
+// UpdateRecordByID replaces the record with the given ID by record, without
+// looking at the other records of the zone. It returns the updated record.
+// A record given without ProviderData stays disabled if it was, and a record
+// without a comment keeps the existing one unless RecordOptions.ClearComment is set.
+func (p *Provider) UpdateRecordByID(ctx context.Context, zone string, id int, record libdns.Record) (libdns.Record, error) {
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	record, zone = rebaseRecords(zone, resolved, []libdns.Record{record})[0], resolved
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	internalRec, err := p.toInternal(zone, record)
+	if err != nil {
+		return nil, err
+	}
+
+	// The record keeps the comment and, without ProviderData, the state it has
+	// in the panel, unless the input replaces them
+	var options *ProviderData
+	if pd, ok := providerData(record); ok {
+		options = &pd
+	}
+	if options == nil || (options.Comment == "" && !options.ClearComment) {
+		existing, err := client.getRecord(ctx, zoneID, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get record %d: %w", id, err)
+		}
+		keepExistingState(*existing, &internalRec, options)
+	}
+
+	updatedRec, err := client.updateRecord(ctx, zoneID, id, internalRec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update record %d: %w", id, err)
+	}
+
+	libdnsRec, err := p.internalToLibdns(zone, *updatedRec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert updated record: %w", err)
+	}
+
+	return libdnsRec, nil
+}
+
+// RenameRecord moves the record with the given ID to newName, keeping its type,
+// content, TTL, priority and ID. Unlike a delete followed by a create, the record
+// never disappears from the zone. It returns the renamed record.
+func (p *Provider) RenameRecord(ctx context.Context, zone string, id int, newName string) (libdns.Record, error) {
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if resolved != zone && !strings.HasSuffix(newName, ".") {
+		newName = absoluteName(zone, newName)
+	}
+	zone = resolved
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := client.getRecord(ctx, zoneID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record %d: %w", id, err)
+	}
+
+	renamed := *existing
+	renamed.Name = p.converter().apiName(zone, newName)
+
+	// DNS forbids a CNAME at the zone apex, and renaming must not change the type
+	if renamed.Type == "CNAME" && apiName(zone, renamed.Name) == "@" {
+		return nil, fmt.Errorf("zone %s: %w", zone, ErrApexCNAME)
+	}
+
+	updatedRec, err := client.updateRecord(ctx, zoneID, id, renamed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rename record %d: %w", id, err)
+	}
+
+	libdnsRec, err := p.internalToLibdns(zone, *updatedRec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert renamed record: %w", err)
+	}
+
+	return libdnsRec, nil
+}
+
+// DisableRecord disables the record with the given ID, keeping it in the zone so
+// it can be enabled again. It returns the updated record; note that GetRecords
+// skips disabled records unless IncludeDisabled is set.
+func (p *Provider) DisableRecord(ctx context.Context, zone string, id int) (libdns.Record, error) {
+	return p.setRecordDisabled(ctx, zone, id, true)
+}
+
+// EnableRecord enables the record with the given ID. It returns the updated record.
+func (p *Provider) EnableRecord(ctx context.Context, zone string, id int) (libdns.Record, error) {
+	return p.setRecordDisabled(ctx, zone, id, false)
+}
+
+// setRecordDisabled updates the disabled state of a record, leaving its other fields
+// as they are. A record already in that state is not updated.
+func (p *Provider) setRecordDisabled(ctx context.Context, zone string, id int, disabled bool) (libdns.Record, error) {
+	zoneID, zone, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := client.getRecord(ctx, zoneID, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get record %d: %w", id, err)
+	}
+
+	updatedRec := existing
+	if existing.Disabled != disabled {
+		record := *existing
+		record.Disabled = disabled
+
+		updatedRec, err = client.updateRecord(ctx, zoneID, id, record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update record %d: %w", id, err)
+		}
+	}
+
+	libdnsRec, err := p.internalToLibdns(zone, *updatedRec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert updated record: %w", err)
+	}
+
+	return libdnsRec, nil
+}
+
+// SetRecords sets the records in the zone, either by updating existing records or creating new ones.
+// Per libdns spec: for any (name, type) pair in the input, SetRecords ensures that the only
+// records in the output zone with that (name, type) pair are those provided in the input.
+// It returns the records which were set.
+//
+// A record with empty data (e.g. a libdns.TXT without text) deletes every existing
+// record of its (name, type) instead of creating one.
+//
+// Existing records already holding one of the given values are kept as they are, and
+// the remaining ones are updated with the changed values, so records keep their IDs
+// and a round-robin set where one value changes costs a single update. Values are
+// matched like in AppendIfAbsent, so a record spelling a value differently, e.g. a
+// quoted TXT value, keeps its ID and is only rewritten to the given spelling.
+//
+// Surplus records are only deleted once every update and creation succeeded, so a failure
+// never removes old data before the new data is in place. On failure, the changes already
+// made are rolled back on a best-effort basis; the zone is not guaranteed to be restored.
+// A call that would delete a record listed in ProtectedRecords fails with
+// ErrProtectedRecord before changing anything.
+//
+// Empty input touches no (name, type) pair, so it is a no-op: no API call is made,
+// not even to look the zone up, and an empty slice is returned.
+//
+// Concurrent calls changing the records of the same zone through the same Provider
+// are serialized; calls for different zones proceed in parallel.
+func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	if len(records) == 0 {
+		return []libdns.Record{}, nil
+	}
+
+	return p.setRecords(ctx, zone, records, false)
+}
+
+// SetRecordsMultiZone sets the records of several zones, like SetRecords called
+// for each zone of the map. It returns the records which were set, keyed like
+// the input.
+//
+// The zones are looked up with a single request. A zone whose records cannot be
+// set is left out of the result, and the other zones are still set; the failures
+// are returned joined into one error.
+func (p *Provider) SetRecordsMultiZone(ctx context.Context, recordsByZone map[string][]libdns.Record) (map[string][]libdns.Record, error) {
+	set := make(map[string][]libdns.Record, len(recordsByZone))
+	if len(recordsByZone) == 0 {
+		return set, nil
+	}
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.VerifyEndpoint {
+		err = p.verifyEndpoint(ctx, client)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	zones, err := client.getZones(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, zone := range slices.Sorted(maps.Keys(recordsByZone)) {
+		records := recordsByZone[zone]
+		if len(records) == 0 {
+			set[zone] = []libdns.Record{}
+			continue
+		}
+
+		z, ok := pickZone(zones, zone, p.ResolveParentZone)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrZoneNotFound, zone))
+			continue
+		}
+
+		zoneRecords, err := p.setZoneRecords(ctx, z.ID, zone, p.resolvedZoneName(z, zone), records, false)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to set records of zone %s: %w", zone, err))
+			continue
+		}
+		set[zone] = zoneRecords
+	}
+
+	return set, errors.Join(errs...)
+}
+
+// ReplaceZone makes the records of the zone match the given records, creating,
+// updating and deleting as few records as possible. Unchanged records keep their IDs.
+// It returns the records which were set.
+//
+// SOA records are not replaced: they cannot be written through the provider, so
+// giving one fails with ErrUnsupportedRecordType, and the existing SOA record is
+// always kept. The NS records at the zone apex are only touched when records of
+// that (name, type) are given. Failures are rolled back like in SetRecords.
+func (p *Provider) ReplaceZone(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	return p.setRecords(ctx, zone, records, true)
+}
+
+// setRecords implements SetRecords and, when replaceZone is set, ReplaceZone.
+//
+// Existing records are paired with the input by content and then by position, except
+// TXT records outside replaceZone, which are paired by content only so unchanged
+// values are never rewritten. With replaceZone, TXT records are paired like every
+// other type, and the records of every (name, type) absent from the input are deleted.
+func (p *Provider) setRecords(ctx context.Context, zone string, records []libdns.Record, replaceZone bool) ([]libdns.Record, error) {
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.setZoneRecords(ctx, zoneID, zone, resolved, records, replaceZone)
+}
+
+// setZoneRecords does the work of setRecords once the zone was looked up: zoneID
+// is the ID of the zone the records of zone are handled in, named resolved.
+func (p *Provider) setZoneRecords(ctx context.Context, zoneID int, zone, resolved string, records []libdns.Record, replaceZone bool) ([]libdns.Record, error) {
+	// Replacing an enclosing zone by mistake would delete all its other records
+	if replaceZone && resolved != zone {
+		return nil, fmt.Errorf("%w: %s", ErrZoneNotFound, zone)
+	}
+	records, zone = rebaseRecords(zone, resolved, records), resolved
+
+	var created, updated, deleted []libdns.Record
+	defer p.notifyChanges(zone, &created, &updated, &deleted)
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get all existing records
+	existingRecords, err := client.getRecords(ctx, zoneID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Group input records by (name, type), names relative with "@" for the apex and
+	// lowercased as DNS ignores case
+	type recordKey struct{ Name, Type string }
+	inputByKey := make(map[recordKey][]Record)
+	// The ProviderData each input carries, if any, in the order of inputByKey
+	optionsByKey := make(map[recordKey][]*ProviderData)
+	clearKeys := make(map[recordKey]bool)
+	for _, record := range records {
+		// A record with empty data clears every record of its (name, type)
+		if rr := record.RR(); rr.Data == "" {
+			if rr.Type == "SOA" {
+				return nil, fmt.Errorf("%w: %s %s", ErrUnsupportedRecordType, rr.Name, rr.Type)
+			}
+			clearKeys[recordKey{strings.ToLower(apiName(zone, rr.Name)), rr.Type}] = true
+			continue
+		}
+
+		internalRec, err := p.toInternal(zone, record)
+		if err != nil {
+			return nil, err
+		}
+		key := recordKey{strings.ToLower(apiName(zone, internalRec.Name)), internalRec.Type}
+		inputByKey[key] = append(inputByKey[key], internalRec)
+		var options *ProviderData
+		if pd, ok := providerData(record); ok {
+			options = &pd
+		}
+		optionsByKey[key] = append(optionsByKey[key], options)
+	}
+
+	var (
+		setRecords []libdns.Record
+		toDelete   []Record
+		changes    setChanges
+	)
+
+	// fail undoes the changes made so far and returns err
+	fail := func(err error) ([]libdns.Record, error) {
+		// Rolled back changes are not reported
+		created, updated = nil, nil
+
+		rollbackErr := changes.rollback(ctx, client, zoneID, zone)
+		if rollbackErr != nil {
+			return nil, fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+
+		return nil, err
+	}
+
+	// Pair each (name, type) group with its existing records before changing anything,
+	// so a refused deletion leaves the zone untouched
+	pairsByKey := make(map[recordKey][]*Record, len(inputByKey))
+	for key, inputRecs := range inputByKey {
+		// Find all existing records with this (name, type)
+		var existingForKey []Record
+		for _, existing := range existingRecords {
+			if sameRecordName(zone, existing.Name, key.Name) && existing.Type == key.Type {
+				existingForKey = append(existingForKey, existing)
+			}
+		}
+
+		// Pair input records with the existing records they replace. Unchanged values
+		// keep their record, so a round-robin set where one address changes costs a
+		// single update and the other records keep their IDs. TXT sets are paired by
+		// content only, so unchanged values (e.g. pending ACME challenges) are left
+		// alone and only the differences are created or deleted.
+		var pairs []*Record
+		var surplus []Record
+		if key.Type == "TXT" && !replaceZone {
+			pairs, surplus = pairByContent(inputRecs, existingForKey)
+		} else {
+			pairs, surplus = pairByContentThenPosition(inputRecs, existingForKey)
+		}
+		pairsByKey[key] = pairs
+
+		// Existing records left without a counterpart are deleted last
+		toDelete = append(toDelete, surplus...)
+	}
+
+	// (name, type) pairs given only with empty data lose all their records
+	for key := range clearKeys {
+		if _, ok := inputByKey[key]; ok {
+			continue
+		}
+
+		for _, existing := range existingRecords {
+			if sameRecordName(zone, existing.Name, key.Name) && existing.Type == key.Type {
+				toDelete = append(toDelete, existing)
+			}
+		}
+	}
+
+	// When replacing the zone, records of (name, type) pairs not given are removed,
+	// except the SOA record, which cannot be written, and the apex NS records, which
+	// only change when explicitly given
+	if replaceZone {
+		for _, existing := range existingRecords {
+			key := recordKey{strings.ToLower(apiName(zone, existing.Name)), existing.Type}
+			if _, ok := inputByKey[key]; ok {
+				continue
+			}
+			if clearKeys[key] {
+				// Already scheduled above
+				continue
+			}
+			if existing.Type == "SOA" || (existing.Type == "NS" && apiName(zone, existing.Name) == "@") {
+				continue
+			}
+
+			toDelete = append(toDelete, existing)
+		}
+	}
+
+	var refused []string
+	for _, existing := range toDelete {
+		if p.protected(zone, existing) {
+			refused = append(refused, describeRecord(existing))
+		}
+	}
+	if len(refused) > 0 {
+		return nil, fmt.Errorf("%w, not deleted: %s", ErrProtectedRecord, strings.Join(refused, ", "))
+	}
+
+	// Update/create input records, reusing existing record IDs where possible
+	for key, inputRecs := range inputByKey {
+		pairs := pairsByKey[key]
+		for i, internalRec := range inputRecs {
+			existing := pairs[i]
+			if existing != nil {
+				keepExistingState(*existing, &internalRec, optionsByKey[key][i])
+			}
+
+			var resultRec *Record
+			switch {
+			case existing == nil:
+				// Create new record
+				resultRec, err = client.createRecord(ctx, zoneID, zone, internalRec)
+				if err != nil {
+					return fail(fmt.Errorf("failed to create record %s in zone %s: %w", describeRecord(internalRec), zone, err))
+				}
+				changes.created = append(changes.created, *resultRec)
+			case sameRecordData(*existing, internalRec):
+				// Nothing to change
+				resultRec = existing
+			default:
+				// Conditional on the listed record, when the API sends ETags
+				internalRec.ETag = existing.ETag
+				resultRec, err = client.updateRecord(ctx, zoneID, existing.ID, internalRec)
+				if err != nil {
+					return fail(fmt.Errorf("failed to update record %d (%s) in zone %s: %w", existing.ID, describeRecord(*existing), zone, err))
+				}
+				changes.updated = append(changes.updated, *existing)
+			}
+
+			libdnsRec, err := p.internalToLibdns(zone, *resultRec)
+			if err != nil {
+				return fail(fmt.Errorf("failed to convert record: %w", err))
+			}
+			setRecords = append(setRecords, libdnsRec)
+
+			switch {
+			case existing == nil:
+				created = append(created, libdnsRec)
+			case resultRec != existing:
+				updated = append(updated, libdnsRec)
+			}
+		}
+	}
+
+	for _, existing := range toDelete {
+		err := client.deleteRecord(ctx, zoneID, existing.ID)
+		if err != nil {
+			return fail(fmt.Errorf("failed to delete extra record %d (%s) in zone %s: %w", existing.ID, describeRecord(existing), zone, err))
+		}
+		changes.deleted = append(changes.deleted, existing)
+	}
+
+	for _, existing := range changes.deleted {
+		libdnsRec, err := p.internalToLibdns(zone, existing)
+		if err != nil {
+			p.logf("not reporting the deletion of record %d: %v", existing.ID, err)
+			continue
+		}
+		deleted = append(deleted, libdnsRec)
+	}
+
+	return setRecords, nil
+}
+
+// pairByContent pairs input records with existing records holding equivalent data
+// (see equivalentData). Inputs without a match are left unpaired and existing records
+// without a match are returned as surplus.
+func pairByContent(inputRecs, existingRecs []Record) ([]*Record, []Record) {
+	pairs := make([]*Record, len(inputRecs))
+	paired := make([]bool, len(existingRecs))
+
+	for i, input := range inputRecs {
+		for j := range existingRecs {
+			if !paired[j] && equivalentData(existingRecs[j], input) {
+				pairs[i] = &existingRecs[j]
+				paired[j] = true
+				break
+			}
+		}
+	}
+
+	var surplus []Record
+	for j, existing := range existingRecs {
+		if !paired[j] {
+			surplus = append(surplus, existing)
+		}
+	}
+
+	return pairs, surplus
+}
+
+// pairByContentThenPosition pairs input records with existing records holding the same
+// content, then pairs the remaining ones in order so they are updated rather than
+// replaced. Existing records left without a counterpart are returned as surplus.
+func pairByContentThenPosition(inputRecs, existingRecs []Record) ([]*Record, []Record) {
+	pairs, surplus := pairByContent(inputRecs, existingRecs)
+
+	for i := range pairs {
+		if pairs[i] == nil && len(surplus) > 0 {
+			pairs[i] = &surplus[0]
+			surplus = surplus[1:]
+		}
+	}
+
+	return pairs, surplus
+}
+
+// sameContent reports whether two records of the same type hold the same content.
+// Addresses are compared in canonical form, so "2001:db8::1" matches "2001:0db8:0:0::1".
+func sameContent(a, b Record) bool {
+	return canonicalContent(a) == canonicalContent(b)
+}
+
+// equivalentData reports whether two records of the same type hold the same data,
+// compared by the meaning of their type rather than as strings: MX and SRV records
+// also compare their priority, domain names ignore case and a trailing dot, and
+// TXT values ignore surrounding quotes. It decides which existing records
+// DeleteRecords removes, which SetRecords and ReplaceZone keep for the given
+// values, and which AppendIfAbsent finds present.
+func equivalentData(a, b Record) bool {
+	switch a.Type {
+	case "MX", "SRV":
+		if a.Priority != b.Priority {
+			return false
+		}
+		fallthrough
+	case "CNAME", "NS", "PTR", "ALIAS":
+		// The last field is a domain name, the others are numbers
+		fieldsA, fieldsB := strings.Fields(a.Content), strings.Fields(b.Content)
+		if len(fieldsA) == 0 || len(fieldsA) != len(fieldsB) {
+			return a.Content == b.Content
+		}
+		for i := range fieldsA {
+			if !strings.EqualFold(strings.TrimSuffix(fieldsA[i], "."), strings.TrimSuffix(fieldsB[i], ".")) {
+				return false
+			}
+		}
+		return true
+	case "TXT":
+		return unquoteTXT(a.Content) == unquoteTXT(b.Content)
+	default:
+		return sameContent(a, b)
+	}
+}
+
+// canonicalContent returns the content of the record, with A and AAAA addresses
+// in canonical form. Content that does not parse is returned unchanged.
+func canonicalContent(rec Record) string {
+	if rec.Type != "A" && rec.Type != "AAAA" {
+		return rec.Content
+	}
+
+	addr, err := netip.ParseAddr(rec.Content)
+	if err != nil {
+		return rec.Content
+	}
+
+	return addr.String()
+}
+
+// keepExistingState gives input, about to update existing, the state of existing
+// it leaves unspecified: the comment, unless input has one or options clear it,
+// and the disabled and proxied flags, unless input carries ProviderData (options).
+func keepExistingState(existing Record, input *Record, options *ProviderData) {
+	if input.Comment == "" && (options == nil || !options.ClearComment) {
+		input.Comment = existing.Comment
+	}
+	if options == nil {
+		input.Disabled = existing.Disabled
+		input.Proxied = existing.Proxied
+	}
+}
+
+// sameRecordData reports whether updating existing with input would change
+// nothing, once input has been completed by keepExistingState.
+func sameRecordData(existing, input Record) bool {
+	return sameContent(existing, input) &&
+		existing.TTL == input.TTL &&
+		existing.Priority == input.Priority &&
+		existing.Weight == input.Weight &&
+		existing.Proxied == input.Proxied &&
+		existing.Disabled == input.Disabled &&
+		existing.Comment == input.Comment
+}
+
+// setChanges tracks the changes made by SetRecords so they can be undone on failure.
+type setChanges struct {
+	created []Record
+	updated []Record // the records as they were before the update
+	deleted []Record
+}
+
+// rollback reverts the tracked changes on a best-effort basis and reports the
+// changes that could not be reverted.
+func (c *setChanges) rollback(ctx context.Context, client *Client, zoneID int, zone string) error {
+	// Undo even if the original context was cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	var errs []error
+
+	for _, rec := range c.deleted {
+		original := rec
+		original.ID = 0
+
+		_, err := client.createRecord(ctx, zoneID, zone, original)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore deleted record %d (%s): %w", rec.ID, describeRecord(rec), err))
+		}
+	}
+
+	for _, rec := range c.updated {
+		// The ETag read with the record is stale once it was updated
+		rec.ETag = ""
+		_, err := client.updateRecord(ctx, zoneID, rec.ID, rec)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to restore updated record %d (%s): %w", rec.ID, describeRecord(rec), err))
+		}
+	}
+
+	for _, rec := range c.created {
+		err := client.deleteRecord(ctx, zoneID, rec.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to remove created record %d (%s): %w", rec.ID, describeRecord(rec), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// DeleteRecords deletes the specified records from the zone. It returns the records that were deleted.
+// Records carrying a ProviderData with a non-zero ID (as returned by the other methods)
+// delete exactly that record instead of being matched by name, type and content.
+//
+// Other records are matched by name, type and data, compared by the meaning of their
+// type: "10 mail.example.com." matches an MX record of priority 10 pointing at
+// mail.example.com, whatever the letter case. As libdns specifies, an empty type,
+// a zero TTL or empty data matches every value, so a record with only a name and a
+// type deletes every record of that (name, type); a non-zero TTL must match the TTL
+// of the record. A record whose (name, type) exists with other data only is not deleted and makes DeleteRecords fail with
+// ErrRecordNotFound after deleting the others, unless LooseDelete is set, in
+// which case one of those records is deleted instead. Records whose (name, type)
+// does not exist at all are left out of the result; with FailOnMissingDelete set,
+// they make DeleteRecords fail with ErrRecordNotFound too.
+// Matching records listed in ProtectedRecords are kept, and make DeleteRecords fail
+// with ErrProtectedRecord after deleting the others.
+func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	records, zone = rebaseRecords(zone, resolved, records), resolved
+
+	var deletedRecords []libdns.Record
+	defer p.notifyChanges(zone, nil, nil, &deletedRecords)
+
+	unlock, err := p.lockZone(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	client, err := newClient(p)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get all existing records
+	existingRecords, err := client.getRecords(ctx, zoneID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var missing, mismatched, refused []string
+
+	// remove deletes an existing record, unless it is protected
+	remove := func(existing Record) error {
+		if p.protected(zone, existing) {
+			refused = append(refused, describeRecord(existing))
+			return nil
+		}
+
+		err := client.deleteRecord(ctx, zoneID, existing.ID)
+		if err != nil {
+			return fmt.Errorf("failed to delete record %d (%s) in zone %s: %w", existing.ID, describeRecord(existing), zone, err)
+		}
+
+		libdnsRec, err := p.internalToLibdns(zone, existing)
+		if err != nil {
+			return fmt.Errorf("failed to convert deleted record: %w", err)
+		}
+
+		deletedRecords = append(deletedRecords, libdnsRec)
+		return nil
+	}
+
+	for _, record := range records {
+		// Records that carry their API ID are deleted by ID only
+		if pd, ok := providerData(record); ok && pd.ID != 0 {
+			found := false
+			for _, existing := range existingRecords {
+				if existing.ID != pd.ID {
+					continue
+				}
+
+				err := remove(existing)
+				if err != nil {
+					return nil, err
+				}
+
+				found = true
+				break
+			}
+
+			if !found {
+				missing = append(missing, fmt.Sprintf("record %d", pd.ID))
+			}
+			continue
+		}
+
+		// Per libdns, an empty type, TTL or data matches every value
+		rr := record.RR()
+		internalRec := Record{Name: apiName(zone, rr.Name), Type: rr.Type, Content: rr.Data}
+		if rr.Type != "" && rr.Data != "" {
+			internalRec, err = p.libdnsToInternal(zone, record)
+			if err != nil {
+				return nil, err
+			}
+		}
+		ttl := 0
+		if rr.TTL != 0 {
+			ttl = p.ttlSeconds(rr.TTL)
+		}
+
+		matches := func(existing Record) bool {
+			switch {
+			case !sameRecordName(zone, existing.Name, internalRec.Name):
+				return false
+			case rr.Type != "" && existing.Type != rr.Type:
+				return false
+			case ttl != 0 && existing.TTL != ttl:
+				return false
+			case rr.Data == "":
+				return true
+			case rr.Type != "":
+				return equivalentData(existing, internalRec)
+			}
+
+			// Without a type, the data is read as the type of each record
+			candidate, err := p.libdnsToInternal(zone, libdns.RR{Name: rr.Name, Type: existing.Type, Data: rr.Data})
+			return err == nil && equivalentData(existing, candidate)
+		}
+
+		found := false
+		for _, existing := range existingRecords {
+			if matches(existing) {
+				err := remove(existing)
+				if err != nil {
+					return nil, err
+				}
+
+				found = true
+			}
+		}
+
+		// Records of the same (name, type) holding other data are not guessed at
+		sameKey := rr.Type != "" && rr.Data != "" && slices.ContainsFunc(existingRecords, func(existing Record) bool {
+			return sameRecordName(zone, existing.Name, internalRec.Name) && existing.Type == internalRec.Type
+		})
+		if !found && sameKey && !p.LooseDelete {
+			mismatched = append(mismatched, describeRecord(internalRec))
+			continue
+		}
+
+		if !found && sameKey {
+			// Record not found - this could be because:
+			// 1. It doesn't exist
+			// 2. The content doesn't match exactly (e.g., whitespace differences)
+			// Try matching by name and type only as a fallback
+			for _, existing := range existingRecords {
+				if sameRecordName(zone, existing.Name, internalRec.Name) && existing.Type == internalRec.Type {
+					err := remove(existing)
+					if err != nil {
+						return nil, err
+					}
+
+					found = true
+					break
+				}
+			}
+		}
+
+		if !found {
+			missing = append(missing, fmt.Sprintf("%s %s %q", internalRec.Name, internalRec.Type, internalRec.Content))
+		}
+	}
+
+	var errs []error
+	if len(refused) > 0 {
+		errs = append(errs, fmt.Errorf("%w, not deleted: %s", ErrProtectedRecord, strings.Join(refused, ", ")))
+	}
+	if len(mismatched) > 0 {
+		errs = append(errs, fmt.Errorf("%w, no record holds the data of: %s", ErrRecordNotFound, strings.Join(mismatched, ", ")))
+	}
+	if p.FailOnMissingDelete && len(missing) > 0 {
+		errs = append(errs, fmt.Errorf("%w: %s", ErrRecordNotFound, strings.Join(missing, ", ")))
 	}
 
-	// Handle apex records
-	if name == "" || name == "@" || name == zone || name == strings.TrimSuffix(zone, ".") {
-		name = "@"
-	}
+	return deletedRecords, errors.Join(errs...)
+}
 
-	// Parse priority from data field for MX and SRV records
-	priority := 0
-	data := rr.Data
+// ProtectedRecord selects records by (name, type) for Provider.ProtectedRecords.
+type ProtectedRecord struct {
+	// Name is a pattern, in the syntax of path.Match, matched against record names
+	// relative to the zone, ignoring case: "@" is the apex, "_dmarc" a single
+	// name and "*" every name. Fully-qualified names are made relative first.
+	Name string `json:"name"`
 
-	// For TXT records, remove quotes if present (libdns adds them, but API doesn't store them)
-	if rr.Type == "TXT" {
-		data = strings.Trim(data, "\"")
-	}
+	// Type is the record type, e.g. "MX". Empty matches every type.
+	Type string `json:"type,omitempty"`
+}
 
-	switch rr.Type {
-	case "MX":
-		// MX format: "priority target"
-		parts := strings.Fields(rr.Data)
-		if len(parts) >= 2 {
-			_, _ = fmt.Sscanf(parts[0], "%d", &priority)
-			data = strings.Join(parts[1:], " ")
+// protected reports whether rec, a record of zone, is listed in ProtectedRecords.
+func (p *Provider) protected(zone string, rec Record) bool {
+	name := strings.ToLower(apiName(zone, rec.Name))
+	for _, pr := range p.ProtectedRecords {
+		if pr.Type != "" && !strings.EqualFold(pr.Type, rec.Type) {
+			continue
 		}
-	case "SRV":
-		// SRV format: "priority weight port target"
-		parts := strings.Fields(rr.Data)
-		if len(parts) >= 4 {
-			_, _ = fmt.Sscanf(parts[0], "%d", &priority)
-			// Keep weight, port, and target in the content
-			data = strings.Join(parts[1:], " ")
+
+		matched, err := path.Match(strings.ToLower(apiName(zone, pr.Name)), name)
+		if err != nil {
+			p.logf("ignoring protected record pattern %q: %v", pr.Name, err)
+			continue
+		}
+		if matched {
+			return true
 		}
 	}
 
-	return Record{
-		Name:     name,
-		Type:     rr.Type,
-		Content:  data,
-		TTL:      int(rr.TTL.Seconds()),
-		Priority: priority,
-	}
+	return false
 }
 
-// internalToLibdns converts an internal Record to a libdns.Record.
-// The zone parameter is required to reconstruct absolute domain names from relative names.
-func internalToLibdns(zone string, rec Record) (libdns.Record, error) {
-	data := rec.Content
+// describeRecord identifies a record in error messages.
+func describeRecord(rec Record) string {
+	return fmt.Sprintf("%s %s %q", rec.Name, rec.Type, rec.Content)
+}
 
-	// For TXT records, strip quotes if the API returns them
-	// This ensures consistency with libdnsToInternal which also strips quotes
-	if rec.Type == "TXT" {
-		data = strings.Trim(data, "\"")
-	}
+// DeleteAllOption configures DeleteAllRecords and DeleteRecordsMatching.
+type DeleteAllOption func(*deleteAllOptions)
 
-	// For MX and SRV records, libdns expects the priority to be part of the Data field
-	// Format: "priority target" for MX, or "priority weight port target" for SRV
-	// The Neodigit API stores priority separately in the Priority field
-	switch rec.Type {
-	case "MX":
-		data = fmt.Sprintf("%d %s", rec.Priority, rec.Content)
-	case "SRV":
-		// SRV: API stores priority in Priority field, "weight port target" in Content
-		data = fmt.Sprintf("%d %s", rec.Priority, rec.Content)
+type deleteAllOptions struct {
+	keepTypes    []string
+	deleteApexNS bool
+}
+
+// KeepTypes leaves the records of the given types alone.
+func KeepTypes(types ...string) DeleteAllOption {
+	return func(o *deleteAllOptions) {
+		for _, typ := range types {
+			o.keepTypes = append(o.keepTypes, strings.ToUpper(typ))
+		}
 	}
+}
 
-	name := rec.Name
+// DeleteApexNS makes DeleteAllRecords delete the NS and SOA records at the zone
+// apex too, which it keeps by default so the zone keeps being served.
+func DeleteApexNS() DeleteAllOption {
+	return func(o *deleteAllOptions) {
+		o.deleteApexNS = true
+	}
+}
 
-	// Handle SRV records with empty names by using a placeholder
-	// The Neodigit API may return SRV records with empty names which are valid in their system
-	// but don't pass libdns strict SRV naming validation (_service._proto.name)
-	if rec.Type == "SRV" && (name == "" || name == "@") {
-		// Use a placeholder that satisfies libdns validation
-		// This preserves the record data while allowing it to pass validation
-		name = "_service._tcp"
+// DeleteAllRecords deletes every record of the zone, except the apex NS and SOA
+// records and the types kept with the given options. It is meant to clean up
+// test zones. A failed deletion does not stop the others; the records that were
+// deleted are returned together with an error joining the failures.
+func (p *Provider) DeleteAllRecords(ctx context.Context, zone string, opts ...DeleteAllOption) ([]libdns.Record, error) {
+	var options deleteAllOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	// Convert relative names to absolute (FQDN) by appending the zone
-	// The API may return relative names (e.g., "_acme-challenge.git" or "@")
-	// or sometimes already-qualified names (e.g., "_acme-challenge.git.etaboada.com")
-	// libdns expects absolute names (e.g., "_acme-challenge.git.etaboada.com.")
-	normalizedZone := strings.TrimSuffix(zone, ".")
+	return p.DeleteRecordsMatching(ctx, zone, func(rec libdns.Record) bool {
+		rr := rec.RR()
+		return options.deleteApexNS || apiName(zone, rr.Name) != "@" || (rr.Type != "NS" && rr.Type != "SOA")
+	}, opts...)
+}
 
-	if name == "" || name == "@" {
-		// "@" or empty represents the zone apex, so use the zone itself
-		if !strings.HasSuffix(zone, ".") {
-			name = zone + "."
-		} else {
-			name = zone
-		}
-	} else if strings.HasSuffix(name, "."+normalizedZone) || strings.HasSuffix(name, "."+normalizedZone+".") {
-		// Name already contains the zone (API returned FQDN), just ensure trailing dot
-		name = strings.TrimSuffix(name, ".") + "."
-	} else if name == normalizedZone || name == normalizedZone+"." {
-		// Name is the zone itself (apex record with zone name)
-		name = normalizedZone + "."
-	} else {
-		// Name is relative, append the zone
-		name = name + "." + normalizedZone + "."
+// DeleteRecordsMatching deletes the records of the zone for which matcher returns
+// true, e.g. every "_acme-challenge" TXT record, and returns the deleted records.
+// Records that cannot be converted are passed to matcher as a libdns.RR.
+//
+// Unlike with DeleteAllRecords, the apex NS and SOA records are deleted when
+// matcher selects them, so it should check the type and name of the records it
+// accepts. Records listed in ProtectedRecords are always kept. A failed deletion
+// does not stop the others.
+//
+// Like DeleteRecords, it honours ResolveParentZone, only looking at the records
+// named inside zone when zone is resolved to its parent, and reports the
+// deletions to OnChange.
+func (p *Provider) DeleteRecordsMatching(ctx context.Context, zone string, matcher func(libdns.Record) bool, opts ...DeleteAllOption) ([]libdns.Record, error) {
+	var options deleteAllOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
 
-	rr := libdns.RR{
-		Name: name,
-		Type: rec.Type,
-		Data: data,
-		TTL:  time.Duration(rec.TTL) * time.Second,
+	zoneID, resolved, err := p.resolveZone(ctx, zone)
+	if err != nil {
+		return nil, err
 	}
+	requested, zone := zone, resolved
 
-	// Parse the RR into a type-specific record
-	return rr.Parse()
-}
+	var deletedRecords []libdns.Record
+	defer p.notifyChanges(zone, nil, nil, &deletedRecords)
 
-// GetRecords lists all the records in the zone.
-func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	zoneID, err := p.getZoneID(ctx, zone)
+	unlock, err := p.lockZone(ctx, zone)
 	if err != nil {
 		return nil, err
 	}
+	defer unlock()
 
 	client, err := newClient(p)
 	if err != nil {
 		return nil, err
 	}
 
-	records, err := client.getRecords(ctx, zoneID, "")
+	existingRecords, err := client.getRecords(ctx, zoneID, "")
 	if err != nil {
 		return nil, err
 	}
 
-	var libdnsRecords []libdns.Record
-	for _, record := range records {
-		libdnsRec, err := internalToLibdns(zone, record)
+	var errs []error
+	for _, existing := range existingRecords {
+		if slices.Contains(options.keepTypes, existing.Type) {
+			continue
+		}
+		// The parent zone also holds records that are not part of the requested one
+		if _, inside := relativeName(requested, absoluteName(zone, existing.Name)); !inside {
+			continue
+		}
+		if p.protected(zone, existing) {
+			continue
+		}
+
+		libdnsRec, err := p.internalToLibdns(zone, existing)
 		if err != nil {
-			// Skip records that can't be parsed
-			// This allows the operation to continue even if some records are invalid
-			// In debug mode, you could log: record ID, type, name, and error
+			libdnsRec = libdns.RR{
+				Name: absoluteName(zone, existing.Name),
+				Type: existing.Type,
+				Data: existing.Content,
+				TTL:  time.Duration(existing.TTL) * time.Second,
+			}
+		}
+
+		if !matcher(libdnsRec) {
+			continue
+		}
+
+		err = client.deleteRecord(ctx, zoneID, existing.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to delete record %d (%s) in zone %s: %w", existing.ID, describeRecord(existing), zone, err))
 			continue
 		}
-		libdnsRecords = append(libdnsRecords, libdnsRec)
+
+		deletedRecords = append(deletedRecords, libdnsRec)
 	}
 
-	return libdnsRecords, nil
+	return deletedRecords, errors.Join(errs...)
 }
 
-// AppendRecords adds records to the zone. It returns the records that were added.
-func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
+// DiffZone compares the live zone against the desired records without changing anything.
+// It returns the desired records absent from the zone (missing), the live records that are
+// not part of the desired set (extra), and the desired records whose live counterpart
+// SetRecords would update (changed). Records are paired and compared the way
+// ReplaceZone does, with TTLs in the seconds sent to the API.
+func (p *Provider) DiffZone(ctx context.Context, zone string, desired []libdns.Record) (missing, extra, changed []libdns.Record, err error) {
 	zoneID, err := p.getZoneID(ctx, zone)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	client, err := newClient(p)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	var appendedRecords []libdns.Record
-	for _, record := range records {
-		internalRec := libdnsToInternal(zone, record)
+	existingRecords, err := client.getRecords(ctx, zoneID, "")
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-		createdRec, err := client.createRecord(ctx, zoneID, internalRec)
+	// Pair the records as SetRecords and ReplaceZone do, so the diff shows the
+	// changes they would make
+	type recordKey struct{ Name, Type string }
+	desiredInternal := make([]Record, len(desired))
+	indexesByKey := make(map[recordKey][]int)
+	for d, record := range desired {
+		internalRec, err := p.toInternal(zone, record)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create record: %w", err)
+			return nil, nil, nil, err
+		}
+		desiredInternal[d] = internalRec
+		key := recordKey{strings.ToLower(apiName(zone, internalRec.Name)), internalRec.Type}
+		indexesByKey[key] = append(indexesByKey[key], d)
+	}
+
+	pairs := make([]*Record, len(desired))
+	surplus := make(map[Record]int)
+	for key, indexes := range indexesByKey {
+		var existingForKey []Record
+		for _, existing := range existingRecords {
+			if sameRecordName(zone, existing.Name, key.Name) && existing.Type == key.Type {
+				existingForKey = append(existingForKey, existing)
+			}
+		}
+
+		inputRecs := make([]Record, len(indexes))
+		for i, d := range indexes {
+			inputRecs[i] = desiredInternal[d]
 		}
 
-		libdnsRec, err := internalToLibdns(zone, *createdRec)
+		keyPairs, keySurplus := pairByContentThenPosition(inputRecs, existingForKey)
+		for i, d := range indexes {
+			pairs[d] = keyPairs[i]
+		}
+		for _, existing := range keySurplus {
+			surplus[existing]++
+		}
+	}
+
+	for d, internalRec := range desiredInternal {
+		existing := pairs[d]
+		if existing == nil {
+			missing = append(missing, desired[d])
+			continue
+		}
+
+		var options *ProviderData
+		if pd, ok := providerData(desired[d]); ok {
+			options = &pd
+		}
+		keepExistingState(*existing, &internalRec, options)
+		if !sameRecordData(*existing, internalRec) {
+			changed = append(changed, desired[d])
+		}
+	}
+
+	for _, existing := range existingRecords {
+		key := recordKey{strings.ToLower(apiName(zone, existing.Name)), existing.Type}
+		if _, ok := indexesByKey[key]; ok {
+			if surplus[existing] == 0 {
+				continue
+			}
+			surplus[existing]--
+		}
+
+		libdnsRec, err := p.internalToLibdns(zone, existing)
 		if err != nil {
-			return nil, fmt.Errorf("failed to convert created record: %w", err)
+			return nil, nil, nil, fmt.Errorf("failed to convert record %d: %w", existing.ID, err)
 		}
 
-		appendedRecords = append(appendedRecords, libdnsRec)
+		extra = append(extra, libdnsRec)
 	}
 
-	return appendedRecords, nil
+	return missing, extra, changed, nil
 }
 
-// SetRecords sets the records in the zone, either by updating existing records or creating new ones.
-// Per libdns spec: for any (name, type) pair in the input, SetRecords ensures that the only
-// records in the output zone with that (name, type) pair are those provided in the input.
-// It returns the records which were set.
-func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	zoneID, err := p.getZoneID(ctx, zone)
+// ZoneSnapshot is the content of a zone at a point in time.
+type ZoneSnapshot struct {
+	Records []libdns.Record
+
+	// Checksum is a hash of the records that does not depend on their order.
+	// Two snapshots with the same checksum hold the same records.
+	Checksum string
+}
+
+// GetZoneSnapshot returns the records of the zone along with their checksum,
+// so callers can detect changes by comparing checksums.
+func (p *Provider) GetZoneSnapshot(ctx context.Context, zone string) (ZoneSnapshot, error) {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return ZoneSnapshot{}, err
+	}
+
+	return ZoneSnapshot{
+		Records:  records,
+		Checksum: recordsChecksum(records),
+	}, nil
+}
+
+// recordsChecksum hashes the sorted (name, type, TTL, data) tuples of the records.
+func recordsChecksum(records []libdns.Record) string {
+	lines := make([]string, 0, len(records))
+	for _, rec := range records {
+		rr := rec.RR()
+		lines = append(lines, fmt.Sprintf("%s\t%s\t%d\t%s", rr.Name, rr.Type, int(rr.TTL.Seconds()), rr.Data))
+	}
+	slices.Sort(lines)
+
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ListZones returns the zones of the account.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	infos, err := p.ListZoneInfos(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	zones := make([]libdns.Zone, 0, len(infos))
+	for _, info := range infos {
+		zones = append(zones, libdns.Zone{Name: info.Name})
+	}
+
+	return zones, nil
+}
+
+// ListZoneInfos returns the zones of the account along with their metadata,
+// such as the number of records.
+func (p *Provider) ListZoneInfos(ctx context.Context) ([]ZoneInfo, error) {
 	client, err := newClient(p)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get all existing records
-	existingRecords, err := client.getRecords(ctx, zoneID, "")
+	zones, err := client.getZones(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	// Group input records by (name, type)
-	type recordKey struct{ Name, Type string }
-	inputByKey := make(map[recordKey][]Record)
-	for _, record := range records {
-		internalRec := libdnsToInternal(zone, record)
-		key := recordKey{internalRec.Name, internalRec.Type}
-		inputByKey[key] = append(inputByKey[key], internalRec)
+	infos := make([]ZoneInfo, 0, len(zones))
+	for _, zone := range zones {
+		infos = append(infos, zoneInfo(zone))
 	}
 
-	var setRecords []libdns.Record
+	return infos, nil
+}
 
-	// Process each (name, type) group
-	for key, inputRecs := range inputByKey {
-		// Find all existing records with this (name, type)
-		var existingForKey []Record
-		for _, existing := range existingRecords {
-			if existing.Name == key.Name && existing.Type == key.Type {
-				existingForKey = append(existingForKey, existing)
-			}
-		}
+// GetZone returns the zone with the given name. It fails with ErrZoneNotFound
+// when the account has no such zone.
+func (p *Provider) GetZone(ctx context.Context, zone string) (libdns.Zone, error) {
+	info, err := p.GetZoneInfo(ctx, zone)
+	if err != nil {
+		return libdns.Zone{}, err
+	}
 
-		// Update/create input records, reusing existing record IDs where possible
-		for i, internalRec := range inputRecs {
-			var resultRec *Record
-			if i < len(existingForKey) {
-				// Update existing record
-				resultRec, err = client.updateRecord(ctx, zoneID, existingForKey[i].ID, internalRec)
-				if err != nil {
-					return nil, fmt.Errorf("failed to update record %d: %w", existingForKey[i].ID, err)
-				}
-			} else {
-				// Create new record
-				resultRec, err = client.createRecord(ctx, zoneID, internalRec)
-				if err != nil {
-					return nil, fmt.Errorf("failed to create record: %w", err)
-				}
-			}
+	return libdns.Zone{Name: info.Name}, nil
+}
 
-			libdnsRec, err := internalToLibdns(zone, *resultRec)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert record: %w", err)
-			}
-			setRecords = append(setRecords, libdnsRec)
-		}
+// GetZoneInfo returns the zone with the given name along with its metadata.
+// It fails with ErrZoneNotFound when the account has no such zone.
+func (p *Provider) GetZoneInfo(ctx context.Context, zone string) (ZoneInfo, error) {
+	client, err := newClient(p)
+	if err != nil {
+		return ZoneInfo{}, err
+	}
 
-		// Delete extra existing records that exceed the input count
-		for i := len(inputRecs); i < len(existingForKey); i++ {
-			err := client.deleteRecord(ctx, zoneID, existingForKey[i].ID)
-			if err != nil {
-				return nil, fmt.Errorf("failed to delete extra record %d: %w", existingForKey[i].ID, err)
-			}
-		}
+	// The API has no lookup by name, so the zone is picked from the list
+	z, err := findZone(ctx, client, zone)
+	if err != nil {
+		return ZoneInfo{}, err
 	}
 
-	return setRecords, nil
+	return zoneInfo(z), nil
 }
 
-// DeleteRecords deletes the specified records from the zone. It returns the records that were deleted.
-func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	zoneID, err := p.getZoneID(ctx, zone)
+// GetZoneSerial returns the SOA serial of the zone, e.g. to watch a change
+// propagate to the name servers. The API increments the serial itself whenever
+// the zone changes, so there is no need to bump it after making changes.
+//
+// The serial is taken from the zone list when the API reports it there, and
+// from the SOA record of the zone otherwise.
+func (p *Provider) GetZoneSerial(ctx context.Context, zone string) (uint32, error) {
+	client, err := newClient(p)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	client, err := newClient(p)
+	z, err := findZone(ctx, client, zone)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	// Get all existing records
-	existingRecords, err := client.getRecords(ctx, zoneID, "")
+	if z.Serial != 0 {
+		return z.Serial, nil
+	}
+
+	records, err := client.getRecords(ctx, z.ID, "SOA")
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	var deletedRecords []libdns.Record
-	for _, record := range records {
-		internalRec := libdnsToInternal(zone, record)
+	for _, rec := range records {
+		if rec.Type != "SOA" || apiName(zone, rec.Name) != "@" {
+			continue
+		}
 
-		// Find matching records by name, type, and content
-		found := false
-		for _, existing := range existingRecords {
-			if existing.Name == internalRec.Name &&
-				existing.Type == internalRec.Type &&
-				existing.Content == internalRec.Content {
-				err := client.deleteRecord(ctx, zoneID, existing.ID)
-				if err != nil {
-					return nil, fmt.Errorf("failed to delete record %d: %w", existing.ID, err)
-				}
+		// SOA content: "mname rname serial refresh retry expire minimum"
+		fields := strings.Fields(rec.Content)
+		if len(fields) < 3 {
+			return 0, fmt.Errorf("invalid SOA data %q", rec.Content)
+		}
 
-				libdnsRec, err := internalToLibdns(zone, existing)
-				if err != nil {
-					return nil, fmt.Errorf("failed to convert deleted record: %w", err)
-				}
+		serial, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid SOA serial %q: %w", fields[2], err)
+		}
 
-				deletedRecords = append(deletedRecords, libdnsRec)
-				found = true
-			}
+		return uint32(serial), nil
+	}
+
+	return 0, fmt.Errorf("no SOA serial reported for zone %s", zone)
+}
+
+// CreateZone adds the zone to the account. It fails with ErrZoneExists when the
+// account already has a zone with that name.
+func (p *Provider) CreateZone(ctx context.Context, name string) (libdns.Zone, error) {
+	client, err := newClient(p)
+	if err != nil {
+		return libdns.Zone{}, err
+	}
+
+	_, err = findZone(ctx, client, name)
+	if err == nil {
+		return libdns.Zone{}, fmt.Errorf("%w: %s", ErrZoneExists, name)
+	}
+	if !errors.Is(err, ErrZoneNotFound) {
+		return libdns.Zone{}, err
+	}
+
+	created, err := client.createZone(ctx, strings.TrimSuffix(name, "."))
+	if err != nil {
+		// Another client may have created the zone since it was looked up
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+			return libdns.Zone{}, fmt.Errorf("%w: %s", ErrZoneExists, name)
 		}
+		return libdns.Zone{}, fmt.Errorf("failed to create zone %s: %w", name, err)
+	}
 
-		if !found {
-			// Record not found - this could be because:
-			// 1. It doesn't exist
-			// 2. The content doesn't match exactly (e.g., whitespace differences)
-			// Try matching by name and type only as a fallback
-			for _, existing := range existingRecords {
-				if existing.Name == internalRec.Name && existing.Type == internalRec.Type {
-					err := client.deleteRecord(ctx, zoneID, existing.ID)
-					if err != nil {
-						return nil, fmt.Errorf("failed to delete record %d: %w", existing.ID, err)
-					}
+	return libdns.Zone{Name: zoneInfo(*created).Name}, nil
+}
 
-					libdnsRec, err := internalToLibdns(zone, existing)
-					if err != nil {
-						return nil, fmt.Errorf("failed to convert deleted record: %w", err)
-					}
+// DeleteZone removes the zone and all its records from the account. It fails with
+// ErrZoneNotFound when the account has no zone with that name.
+func (p *Provider) DeleteZone(ctx context.Context, name string) error {
+	client, err := newClient(p)
+	if err != nil {
+		return err
+	}
 
-					deletedRecords = append(deletedRecords, libdnsRec)
-					break
-				}
-			}
+	z, err := findZone(ctx, client, name)
+	if err != nil {
+		return err
+	}
+
+	err = client.deleteZone(ctx, z.ID)
+	if err != nil {
+		// Another client may have deleted the zone since it was looked up
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return fmt.Errorf("%w: %s", ErrZoneNotFound, name)
 		}
+		return fmt.Errorf("failed to delete zone %s: %w", name, err)
 	}
 
-	return deletedRecords, nil
+	return nil
+}
+
+// zoneInfo converts a zone returned by the API to a ZoneInfo.
+func zoneInfo(zone Zone) ZoneInfo {
+	return ZoneInfo{
+		ID:          zone.ID,
+		Name:        strings.TrimSuffix(zone.Name, ".") + ".",
+		HumanName:   zone.HumanName,
+		RecordCount: zone.RecordCount,
+		Status:      zone.Status,
+	}
 }
 
 // Interface guards
 var (
+	_ libdns.ZoneLister     = (*Provider)(nil)
 	_ libdns.RecordGetter   = (*Provider)(nil)
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
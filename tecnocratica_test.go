@@ -1,19 +1,338 @@
 package tecnocratica
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
 	"net/http"
 	"net/http/httptest"
+	"net/netip"
 	"os"
+	"path"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/libdns/libdns"
 )
 
+func TestAPIName(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		input    string
+		wantName string
+	}{
+		{name: "relative name", zone: "example.com.", input: "www", wantName: "www"},
+		{name: "relative multi-label name", zone: "example.com.", input: "a.b", wantName: "a.b"},
+		{name: "FQDN", zone: "example.com.", input: "www.example.com.", wantName: "www"},
+		{name: "deeply nested FQDN", zone: "example.com.", input: "a.b.c.d.example.com.", wantName: "a.b.c.d"},
+		{name: "FQDN without trailing dot", zone: "example.com", input: "a.b.example.com", wantName: "a.b"},
+		{name: "zone without trailing dot", zone: "example.com", input: "a.b.example.com.", wantName: "a.b"},
+		{name: "apex as FQDN", zone: "example.com.", input: "example.com.", wantName: "@"},
+		{name: "apex as zone without dot", zone: "example.com.", input: "example.com", wantName: "@"},
+		{name: "apex as @", zone: "example.com.", input: "@", wantName: "@"},
+		{name: "apex as empty", zone: "example.com.", input: "", wantName: "@"},
+		{name: "false prefix match", zone: "example.com.", input: "fooexample.com", wantName: "fooexample.com"},
+		{name: "false prefix match FQDN", zone: "example.com.", input: "fooexample.com.", wantName: "fooexample.com."},
+		{name: "label ending with zone name", zone: "example.com.", input: "www.fooexample.com.", wantName: "www.fooexample.com."},
+		{name: "zone label repeated", zone: "example.com.", input: "example.example.com.", wantName: "example"},
+		{name: "mixed-case FQDN", zone: "example.com.", input: "WWW.Example.COM.", wantName: "WWW"},
+		{name: "mixed-case apex", zone: "example.com.", input: "EXAMPLE.com.", wantName: "@"},
+		{name: "wildcard", zone: "example.com.", input: "*", wantName: "*"},
+		{name: "wildcard FQDN", zone: "example.com.", input: "*.example.com.", wantName: "*"},
+		{name: "wildcard below subdomain", zone: "example.com.", input: "*.sub", wantName: "*.sub"},
+		{name: "wildcard below subdomain FQDN", zone: "example.com", input: "*.sub.example.com.", wantName: "*.sub"},
+		{name: "reverse zone octet", zone: "2.0.192.in-addr.arpa.", input: "1", wantName: "1"},
+		{name: "reverse zone FQDN", zone: "2.0.192.in-addr.arpa.", input: "1.2.0.192.in-addr.arpa.", wantName: "1"},
+		{name: "reverse /16 zone", zone: "0.192.in-addr.arpa", input: "1.2.0.192.in-addr.arpa.", wantName: "1.2"},
+		{name: "reverse zone octet matching a zone label", zone: "2.0.192.in-addr.arpa.", input: "2.2.0.192.in-addr.arpa.", wantName: "2"},
+		{name: "reverse zone apex", zone: "2.0.192.in-addr.arpa.", input: "2.0.192.in-addr.arpa.", wantName: "@"},
+		{name: "other reverse zone", zone: "2.0.192.in-addr.arpa.", input: "1.12.0.192.in-addr.arpa.", wantName: "1.12.0.192.in-addr.arpa."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := apiName(tt.zone, tt.input); got != tt.wantName {
+				t.Errorf("apiName(%q, %q) = %q, want %q", tt.zone, tt.input, got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestAbsoluteName(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		input    string
+		wantName string
+	}{
+		{name: "relative name", zone: "example.com.", input: "www", wantName: "www.example.com."},
+		{name: "relative name in zone without dot", zone: "example.com", input: "a.b", wantName: "a.b.example.com."},
+		{name: "FQDN", zone: "example.com.", input: "www.example.com.", wantName: "www.example.com."},
+		{name: "FQDN without trailing dot", zone: "example.com.", input: "www.example.com", wantName: "www.example.com."},
+		{name: "apex as @", zone: "example.com.", input: "@", wantName: "example.com."},
+		{name: "apex as empty", zone: "example.com", input: "", wantName: "example.com."},
+		{name: "apex as FQDN", zone: "example.com.", input: "example.com.", wantName: "example.com."},
+		{name: "apex as zone without dot", zone: "example.com.", input: "example.com", wantName: "example.com."},
+		{name: "mixed-case FQDN keeps case", zone: "example.com.", input: "WWW.Example.COM", wantName: "WWW.Example.COM."},
+		{name: "false suffix match", zone: "example.com.", input: "fooexample.com", wantName: "fooexample.com.example.com."},
+		{name: "FQDN outside the zone", zone: "example.com.", input: "other.net.", wantName: "other.net."},
+		{name: "false suffix match FQDN", zone: "example.com.", input: "fooexample.com.", wantName: "fooexample.com."},
+		{name: "wildcard", zone: "example.com.", input: "*", wantName: "*.example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := absoluteName(tt.zone, tt.input); got != tt.wantName {
+				t.Errorf("absoluteName(%q, %q) = %q, want %q", tt.zone, tt.input, got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNameRoundTrip(t *testing.T) {
+	inputs := []string{"", "@", "www", "a.b", "*", "*.sub", "www.example.com.", "www.example.com", "example.com", "example.com.", "EXAMPLE.com."}
+	for _, zone := range []string{"example.com.", "example.com"} {
+		for _, input := range inputs {
+			abs := absoluteName(zone, input)
+			if again := absoluteName(zone, apiName(zone, abs)); !sameName(again, abs) {
+				t.Errorf("zone %q, name %q: absolute %q became %q after a round trip", zone, input, abs, again)
+			}
+			if rel := apiName(zone, input); apiName(zone, absoluteName(zone, rel)) != rel {
+				t.Errorf("zone %q, name %q: relative %q is not stable", zone, input, rel)
+			}
+		}
+	}
+}
+
+func TestNewProviderFromEnv(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		apiURL     string
+		wantErr    bool
+		wantAPIURL string
+	}{
+		{
+			name:    "missing token",
+			token:   "",
+			apiURL:  "https://api.example.com/v1",
+			wantErr: true,
+		},
+		{
+			name:       "token only",
+			token:      "env-token",
+			wantAPIURL: "",
+		},
+		{
+			name:       "token and API URL",
+			token:      "env-token",
+			apiURL:     "https://api.example.com/v1",
+			wantAPIURL: "https://api.example.com/v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NEODIGIT_TOKEN", tt.token)
+			t.Setenv("NEODIGIT_API_URL", tt.apiURL)
+
+			p, err := NewProviderFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewProviderFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if p.APIToken != tt.token {
+				t.Errorf("APIToken = %q, want %q", p.APIToken, tt.token)
+			}
+			if p.APIURL != tt.wantAPIURL {
+				t.Errorf("APIURL = %q, want %q", p.APIURL, tt.wantAPIURL)
+			}
+		})
+	}
+}
+
+func TestProvider_GetAPIInfo(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		body       string
+		noBulk     bool
+		want       APIInfo
+		wantErr    bool
+		wantNoBulk bool
+	}{
+		{
+			name:   "version and features",
+			status: http.StatusOK,
+			body:   `{"version":"1.4.2","features":["bulk_create","record_comments"]}`,
+			want:   APIInfo{Version: "1.4.2", Features: []string{"bulk_create", "record_comments"}},
+		},
+		{
+			name:       "features without bulk creation",
+			status:     http.StatusOK,
+			body:       `{"version":"1.2","features":["record_comments"]}`,
+			want:       APIInfo{Version: "1.2", Features: []string{"record_comments"}},
+			wantNoBulk: true,
+		},
+		{
+			name:   "bulk creation listed again",
+			status: http.StatusOK,
+			body:   `{"version":"1.5","features":["bulk_create"]}`,
+			noBulk: true,
+			want:   APIInfo{Version: "1.5", Features: []string{"bulk_create"}},
+		},
+		{
+			name:       "no features listed",
+			status:     http.StatusOK,
+			body:       `{"version":"1.5"}`,
+			noBulk:     true,
+			want:       APIInfo{Version: "1.5"},
+			wantNoBulk: true,
+		},
+		{
+			name:   "version only",
+			status: http.StatusOK,
+			body:   `{"version":"1.0"}`,
+			want:   APIInfo{Version: "1.0"},
+		},
+		{
+			name:   "no version reported",
+			status: http.StatusOK,
+			body:   `{}`,
+			want:   APIInfo{Version: APIVersionUnknown},
+		},
+		{
+			name:   "no info endpoint",
+			status: http.StatusNotFound,
+			body:   `{"error":"not found"}`,
+			want:   APIInfo{Version: APIVersionUnknown},
+		},
+		{
+			name:    "server error",
+			status:  http.StatusInternalServerError,
+			body:    `{"error":"internal error"}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/version" {
+					t.Errorf("request to %s, want /version", r.URL.Path)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+			p.noBulkCreate.Store(tt.noBulk)
+
+			info, err := p.GetAPIInfo(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetAPIInfo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("GetAPIInfo() = %+v, want %+v", info, tt.want)
+			}
+
+			if got := p.noBulkCreate.Load(); got != tt.wantNoBulk {
+				t.Errorf("bulk creation disabled = %v, want %v", got, tt.wantNoBulk)
+			}
+		})
+	}
+}
+
+func TestProvider_WithToken(t *testing.T) {
+	var gotTokens []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTokens = append(gotTokens, r.Header.Get("X-TCpanel-Token"))
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:            "base-token",
+		APIURL:              server.URL,
+		AllowInsecureHTTP:   true,
+		APIPathPrefix:       "dns",
+		UserAgent:           "tenant-sync/1.0",
+		OnRateLimit:         func(RateLimit) {},
+		Logger:              log.New(io.Discard, "", 0),
+		StrictParsing:       true,
+		ProtectedRecords:    []ProtectedRecord{{Name: "@", Type: "MX"}},
+		MinTTL:              time.Minute,
+		MaxIdleConnsPerHost: 8,
+	}
+	p.noBulkCreate.Store(true)
+
+	clone := p.WithToken("tenant-token")
+
+	if clone.APIToken != "tenant-token" || p.APIToken != "base-token" {
+		t.Errorf("WithToken() token = %q, original %q, want tenant-token and base-token", clone.APIToken, p.APIToken)
+	}
+
+	// Every exported setting but the token is inherited
+	pv, cv := reflect.ValueOf(p).Elem(), reflect.ValueOf(clone).Elem()
+	for i := range pv.NumField() {
+		field := pv.Type().Field(i)
+		if !field.IsExported() || field.Name == "APIToken" {
+			continue
+		}
+
+		want, got := pv.Field(i), cv.Field(i)
+		if field.Type.Kind() == reflect.Func {
+			if want.Pointer() != got.Pointer() {
+				t.Errorf("WithToken() did not inherit %s", field.Name)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(want.Interface(), got.Interface()) {
+			t.Errorf("WithToken() %s = %v, want %v", field.Name, got.Interface(), want.Interface())
+		}
+	}
+
+	if clone.transport == nil || clone.transport != p.transport {
+		t.Error("WithToken() does not share the transport of the original provider")
+	}
+
+	if !clone.noBulkCreate.Load() {
+		t.Error("WithToken() forgot that the API has no bulk endpoint")
+	}
+
+	for _, provider := range []*Provider{p, clone} {
+		_, err := provider.ListZones(context.Background())
+		if err != nil {
+			t.Fatalf("ListZones() error = %v", err)
+		}
+	}
+
+	if !slices.Equal(gotTokens, []string{"base-token", "tenant-token"}) {
+		t.Errorf("providers sent tokens %v, want base-token then tenant-token", gotTokens)
+	}
+}
+
 func TestLibdnsToInternal(t *testing.T) {
 	tests := []struct {
 		name         string
@@ -160,6 +479,111 @@ func TestLibdnsToInternal(t *testing.T) {
 			wantTTL:      3600,
 			wantPriority: 10,
 		},
+		{
+			name: "SSHFP record",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "SSHFP",
+				Name: "host",
+				Data: "4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789",
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "host",
+			wantType:     "SSHFP",
+			wantData:     "4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789",
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
+		{
+			name: "DS record",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "DS",
+				Name: "sub",
+				Data: "60485 5 1 2BB183AF5F22588179A53B0A 98631FAD1A292118",
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "sub",
+			wantType:     "DS",
+			wantData:     "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
+		{
+			name: "DNSKEY record",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "DNSKEY",
+				Name: "@",
+				Data: "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0d xCjjnopKl+GqJxpVXckHAeF+KkxLbxIL fDLUT0rAK9iUzy1L53eKGQ==",
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "@",
+			wantType:     "DNSKEY",
+			wantData:     "257 3 13 mdsswUyr3DPW132mOi8V9xESWE8jTo0dxCjjnopKl+GqJxpVXckHAeF+KkxLbxILfDLUT0rAK9iUzy1L53eKGQ==",
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
+		{
+			name: "AAAA record",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "AAAA",
+				Name: "www",
+				Data: "2001:db8::1",
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "www",
+			wantType:     "AAAA",
+			wantData:     "2001:db8::1",
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
+		{
+			name: "NS record has no priority",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "NS",
+				Name: "sub",
+				Data: "ns1.example.net.",
+				TTL:  86400 * time.Second,
+			},
+			wantName:     "sub",
+			wantType:     "NS",
+			wantData:     "ns1.example.net.",
+			wantTTL:      86400,
+			wantPriority: 0,
+		},
+		{
+			name: "PTR record has no priority",
+			zone: "2.0.192.in-addr.arpa.",
+			rr: libdns.RR{
+				Type: "PTR",
+				Name: "1",
+				Data: "www.example.com.",
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "1",
+			wantType:     "PTR",
+			wantData:     "www.example.com.",
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
+		{
+			name: "CAA record keeps flags, tag and value",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "CAA",
+				Name: "@",
+				Data: `0 issue "letsencrypt.org"`,
+				TTL:  3600 * time.Second,
+			},
+			wantName:     "@",
+			wantType:     "CAA",
+			wantData:     `0 issue "letsencrypt.org"`,
+			wantTTL:      3600,
+			wantPriority: 0,
+		},
 	}
 
 	for _, tt := range tests {
@@ -169,7 +593,10 @@ func TestLibdnsToInternal(t *testing.T) {
 				t.Fatalf("Failed to parse RR: %v", err)
 			}
 
-			result := libdnsToInternal(tt.zone, rec)
+			result, err := libdnsToInternal(tt.zone, rec)
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
 
 			if result.Name != tt.wantName {
 				t.Errorf("Name = %v, want %v", result.Name, tt.wantName)
@@ -190,77 +617,369 @@ func TestLibdnsToInternal(t *testing.T) {
 	}
 }
 
-func TestInternalToLibdns(t *testing.T) {
+func TestLibdnsToInternalInvalid(t *testing.T) {
 	tests := []struct {
-		name      string
-		zone      string
-		record    Record
-		wantName  string
-		wantType  string
-		wantValue string
-		wantTTL   time.Duration
-		wantErr   bool
+		name string
+		zone string
+		rr   libdns.RR
 	}{
 		{
-			name: "A record",
-			record: Record{
-				ID:      1,
-				Name:    "www",
-				Type:    "A",
-				Content: "192.0.2.1",
-				TTL:     3600,
+			name: "SRV record with missing port",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "SRV",
+				Name: "_sip._tcp",
+				Data: "10 20 sip.example.com",
+				TTL:  3600 * time.Second,
 			},
-			wantName:  "www.example.com.",
-			wantType:  "A",
-			wantValue: "192.0.2.1",
-			wantTTL:   3600 * time.Second,
-			wantErr:   false,
 		},
 		{
-			name: "AAAA record",
-			record: Record{
-				ID:      2,
-				Name:    "www",
-				Type:    "AAAA",
-				Content: "2001:db8::1",
-				TTL:     3600,
+			name: "SRV record with non-numeric port",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "SRV",
+				Name: "_sip._tcp",
+				Data: "10 20 sip sip.example.com",
+				TTL:  3600 * time.Second,
 			},
-			wantName:  "www.example.com.",
-			wantType:  "AAAA",
-			wantValue: "2001:db8::1",
-			wantTTL:   3600 * time.Second,
-			wantErr:   false,
 		},
 		{
-			name: "TXT record",
-			record: Record{
-				ID:      3,
-				Name:    "_acme-challenge",
-				Type:    "TXT",
-				Content: "validation-token",
-				TTL:     300,
+			name: "MX record with missing priority",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "MX",
+				Name: "@",
+				Data: "mail.example.com",
+				TTL:  3600 * time.Second,
 			},
-			wantName:  "_acme-challenge.example.com.",
-			wantType:  "TXT",
-			wantValue: "validation-token",
-			wantTTL:   300 * time.Second,
-			wantErr:   false,
 		},
 		{
-			name: "TXT record with quotes from API",
-			record: Record{
-				ID:      6,
-				Name:    "_acme-challenge",
-				Type:    "TXT",
-				Content: "\"validation-token-with-quotes\"",
-				TTL:     300,
-			},
-			wantName:  "_acme-challenge.example.com.",
+			name: "MX record with non-numeric priority",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "MX",
+				Name: "@",
+				Data: "abc mail.example.com",
+				TTL:  3600 * time.Second,
+			},
+		},
+		{
+			name: "SSHFP record with non-hex fingerprint",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "SSHFP",
+				Name: "host",
+				Data: "4 2 not-a-fingerprint",
+				TTL:  3600 * time.Second,
+			},
+		},
+		{
+			name: "SSHFP record with out of range algorithm",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "SSHFP",
+				Name: "host",
+				Data: "256 2 123456789abcdef6",
+				TTL:  3600 * time.Second,
+			},
+		},
+		{
+			name: "DS record with non-hex digest",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "DS",
+				Name: "sub",
+				Data: "60485 5 1 not-a-digest",
+				TTL:  3600 * time.Second,
+			},
+		},
+		{
+			name: "DS record with out of range key tag",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "DS",
+				Name: "sub",
+				Data: "65536 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+				TTL:  3600 * time.Second,
+			},
+		},
+		{
+			name: "DNSKEY record with invalid public key",
+			zone: "example.com",
+			rr: libdns.RR{
+				Type: "DNSKEY",
+				Name: "@",
+				Data: "257 3 13 not*base64",
+				TTL:  3600 * time.Second,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Malformed data is passed as a raw RR, as libdns callers may do
+			_, err := libdnsToInternal(tt.zone, tt.rr)
+			if err == nil {
+				t.Error("libdnsToInternal() error = nil")
+			}
+		})
+	}
+}
+
+func TestProvider_ValidateRecord(t *testing.T) {
+	tests := []struct {
+		name    string
+		rec     libdns.Record
+		wantErr string
+	}{
+		{
+			name: "valid A",
+			rec:  libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+		},
+		{
+			name:    "invalid A address",
+			rec:     libdns.RR{Name: "www", Type: "A", TTL: time.Hour, Data: "192.0.2.300"},
+			wantErr: "invalid A address",
+		},
+		{
+			name:    "MX without priority",
+			rec:     libdns.RR{Name: "@", Type: "MX", TTL: time.Hour, Data: "mail.example.com."},
+			wantErr: "want \"priority target\"",
+		},
+		{
+			name:    "negative TTL",
+			rec:     libdns.TXT{Name: "www", TTL: -time.Second, Text: "hello"},
+			wantErr: "invalid TTL",
+		},
+		{
+			name:    "apex CNAME",
+			rec:     libdns.CNAME{Name: "@", TTL: time.Hour, Target: "other.example.net."},
+			wantErr: ErrApexCNAME.Error(),
+		},
+		{
+			name:    "unsupported type",
+			rec:     libdns.RR{Name: "www", Type: "HINFO", TTL: time.Hour, Data: "PC Linux"},
+			wantErr: ErrUnsupportedRecordType.Error(),
+		},
+	}
+
+	p := &Provider{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.ValidateRecord("example.com.", tt.rec)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateRecord() error = %v", err)
+				}
+				return
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateRecord() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProvider_TTLBounds(t *testing.T) {
+	tests := []struct {
+		name        string
+		minTTL      time.Duration
+		maxTTL      time.Duration
+		defaultTTL  time.Duration
+		ttl         time.Duration
+		wantTTL     int
+		wantWarning bool
+	}{
+		{
+			name:    "within bounds",
+			minTTL:  60 * time.Second,
+			maxTTL:  86400 * time.Second,
+			ttl:     3600 * time.Second,
+			wantTTL: 3600,
+		},
+		{
+			name:    "under minimum",
+			minTTL:  60 * time.Second,
+			maxTTL:  86400 * time.Second,
+			ttl:     30 * time.Second,
+			wantTTL: 60,
+		},
+		{
+			name:    "over maximum",
+			minTTL:  60 * time.Second,
+			maxTTL:  86400 * time.Second,
+			ttl:     604800 * time.Second,
+			wantTTL: 86400,
+		},
+		{
+			name:        "sub-second rounds up to minimum",
+			minTTL:      60 * time.Second,
+			ttl:         500 * time.Millisecond,
+			wantTTL:     60,
+			wantWarning: true,
+		},
+		{
+			name:        "sub-second without minimum",
+			ttl:         500 * time.Millisecond,
+			wantTTL:     1,
+			wantWarning: true,
+		},
+		{
+			name:        "fractional seconds round to nearest",
+			ttl:         1500 * time.Millisecond,
+			wantTTL:     2,
+			wantWarning: true,
+		},
+		{
+			name:        "fractional seconds round down",
+			ttl:         1400 * time.Millisecond,
+			wantTTL:     1,
+			wantWarning: true,
+		},
+		{
+			name:    "zero uses provider default",
+			minTTL:  60 * time.Second,
+			ttl:     0,
+			wantTTL: 0,
+		},
+		{
+			name:       "zero uses configured default",
+			defaultTTL: 5 * time.Minute,
+			ttl:        0,
+			wantTTL:    300,
+		},
+		{
+			name:       "configured default is clamped",
+			minTTL:     60 * time.Second,
+			defaultTTL: 30 * time.Second,
+			ttl:        0,
+			wantTTL:    60,
+		},
+		{
+			name:       "explicit TTL overrides configured default",
+			defaultTTL: 5 * time.Minute,
+			ttl:        time.Hour,
+			wantTTL:    3600,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			p := &Provider{MinTTL: tt.minTTL, MaxTTL: tt.maxTTL, DefaultTTL: tt.defaultTTL, Logger: log.New(&buf, "", 0)}
+
+			rec := libdns.Address{Name: "www", TTL: tt.ttl, IP: netip.MustParseAddr("192.0.2.1")}
+
+			result, err := p.toInternal("example.com.", rec)
+			if err != nil {
+				t.Fatalf("toInternal() error = %v", err)
+			}
+
+			if result.TTL != tt.wantTTL {
+				t.Errorf("TTL = %d, want %d", result.TTL, tt.wantTTL)
+			}
+
+			if warned := strings.Contains(buf.String(), "not a whole number of seconds"); warned != tt.wantWarning {
+				t.Errorf("logged %q, want precision warning = %v", buf.String(), tt.wantWarning)
+			}
+
+			// A zero TTL must be left out of the payload so the API applies its default
+			payload, _ := json.Marshal(RecordRequest{Record: result})
+			if hasTTL := strings.Contains(string(payload), `"ttl"`); hasTTL != (tt.wantTTL != 0) {
+				t.Errorf("payload %s, want ttl field present = %v", payload, tt.wantTTL != 0)
+			}
+		})
+	}
+}
+
+func TestInternalToLibdns(t *testing.T) {
+	tests := []struct {
+		name      string
+		zone      string
+		record    Record
+		wantName  string
+		wantType  string
+		wantValue string
+		wantTTL   time.Duration
+		wantErr   bool
+	}{
+		{
+			name: "A record",
+			record: Record{
+				ID:      1,
+				Name:    "www",
+				Type:    "A",
+				Content: "192.0.2.1",
+				TTL:     3600,
+			},
+			wantName:  "www.example.com.",
+			wantType:  "A",
+			wantValue: "192.0.2.1",
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "AAAA record",
+			record: Record{
+				ID:      2,
+				Name:    "www",
+				Type:    "AAAA",
+				Content: "2001:db8::1",
+				TTL:     3600,
+			},
+			wantName:  "www.example.com.",
+			wantType:  "AAAA",
+			wantValue: "2001:db8::1",
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "TXT record",
+			record: Record{
+				ID:      3,
+				Name:    "_acme-challenge",
+				Type:    "TXT",
+				Content: "validation-token",
+				TTL:     300,
+			},
+			wantName:  "_acme-challenge.example.com.",
+			wantType:  "TXT",
+			wantValue: "validation-token",
+			wantTTL:   300 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "TXT record with quotes from API",
+			record: Record{
+				ID:      6,
+				Name:    "_acme-challenge",
+				Type:    "TXT",
+				Content: "\"validation-token-with-quotes\"",
+				TTL:     300,
+			},
+			wantName:  "_acme-challenge.example.com.",
 			wantType:  "TXT",
 			wantValue: "validation-token-with-quotes",
 			wantTTL:   300 * time.Second,
 			wantErr:   false,
 		},
+		{
+			name: "multi-string DKIM record from API",
+			record: Record{
+				ID:      9,
+				Name:    "selector._domainkey",
+				Type:    "TXT",
+				Content: `"v=DKIM1; k=rsa; p=MIIBIjANBgkq" "hkiG9w0BAQEFAAOCAQ8A"`,
+				TTL:     3600,
+			},
+			wantName:  "selector._domainkey.example.com.",
+			wantType:  "TXT",
+			wantValue: "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8A",
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
 		{
 			name: "MX record",
 			record: Record{
@@ -341,6 +1060,92 @@ func TestInternalToLibdns(t *testing.T) {
 			wantTTL:   3600 * time.Second,
 			wantErr:   false,
 		},
+		{
+			name: "SRV record with missing port",
+			record: Record{
+				ID:       13,
+				Name:     "_sip._tcp",
+				Type:     "SRV",
+				Content:  "20 sip.example.com",
+				TTL:      3600,
+				Priority: 10,
+			},
+			wantErr: true,
+		},
+		{
+			name: "SSHFP record",
+			record: Record{
+				ID:      14,
+				Name:    "host",
+				Type:    "SSHFP",
+				Content: "1 1 dd465c09cfa51fb45020cc83316fff21b9ec74ac",
+				TTL:     3600,
+			},
+			wantName:  "host.example.com.",
+			wantType:  "SSHFP",
+			wantValue: "1 1 dd465c09cfa51fb45020cc83316fff21b9ec74ac",
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "SSHFP record with missing fingerprint",
+			record: Record{
+				ID:      15,
+				Name:    "host",
+				Type:    "SSHFP",
+				Content: "1 1",
+				TTL:     3600,
+			},
+			wantErr: true,
+		},
+		{
+			name: "NS record ignores priority from API",
+			record: Record{
+				ID:       10,
+				Name:     "sub",
+				Type:     "NS",
+				Content:  "ns1.example.net.",
+				TTL:      86400,
+				Priority: 10,
+			},
+			wantName:  "sub.example.com.",
+			wantType:  "NS",
+			wantValue: "ns1.example.net.",
+			wantTTL:   86400 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "PTR record ignores priority from API",
+			zone: "2.0.192.in-addr.arpa.",
+			record: Record{
+				ID:       11,
+				Name:     "1",
+				Type:     "PTR",
+				Content:  "www.example.com.",
+				TTL:      3600,
+				Priority: 10,
+			},
+			wantName:  "1.2.0.192.in-addr.arpa.",
+			wantType:  "PTR",
+			wantValue: "www.example.com.",
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
+		{
+			name: "CAA record",
+			record: Record{
+				ID:      12,
+				Name:    "@",
+				Type:    "CAA",
+				Content: `0 issue "letsencrypt.org"`,
+				TTL:     3600,
+			},
+			wantName:  "example.com.",
+			wantType:  "CAA",
+			wantValue: `0 issue "letsencrypt.org"`,
+			wantTTL:   3600 * time.Second,
+			wantErr:   false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -374,375 +1179,5244 @@ func TestInternalToLibdns(t *testing.T) {
 	}
 }
 
-func TestProvider_GetZoneID(t *testing.T) {
+func TestSameContent(t *testing.T) {
 	tests := []struct {
-		name     string
-		zoneName string
-		zones    []Zone
-		wantID   int
-		wantErr  bool
+		name string
+		a, b Record
+		want bool
 	}{
 		{
-			name:     "zone found without trailing dot",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-				{ID: 2, Name: "example.org"},
-			},
-			wantID:  1,
-			wantErr: false,
+			name: "compressed and expanded IPv6",
+			a:    Record{Type: "AAAA", Content: "2001:db8::1"},
+			b:    Record{Type: "AAAA", Content: "2001:0db8:0000::0001"},
+			want: true,
 		},
 		{
-			name:     "zone found with trailing dot",
-			zoneName: "example.com.",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
+			name: "fully expanded IPv6",
+			a:    Record{Type: "AAAA", Content: "2001:0db8:0000:0000:0000:0000:0000:0001"},
+			b:    Record{Type: "AAAA", Content: "2001:db8::1"},
+			want: true,
+		},
+		{
+			name: "different IPv6",
+			a:    Record{Type: "AAAA", Content: "2001:db8::1"},
+			b:    Record{Type: "AAAA", Content: "2001:db8::2"},
+			want: false,
+		},
+		{
+			name: "IPv4",
+			a:    Record{Type: "A", Content: "192.0.2.1"},
+			b:    Record{Type: "A", Content: "192.0.2.1"},
+			want: true,
+		},
+		{
+			name: "non-address content compared literally",
+			a:    Record{Type: "TXT", Content: "2001:db8::1"},
+			b:    Record{Type: "TXT", Content: "2001:0db8::1"},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameContent(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameContent(%q, %q) = %v, want %v", tt.a.Content, tt.b.Content, got, tt.want)
+			}
+		})
+	}
+
+	// Addresses are sent to the API in canonical form as well
+	internal, err := libdnsToInternal("example.com", libdns.RR{Name: "www", Type: "AAAA", Data: "2001:0db8:0000::0001"})
+	if err != nil {
+		t.Fatalf("libdnsToInternal() error = %v", err)
+	}
+	if internal.Content != "2001:db8::1" {
+		t.Errorf("libdnsToInternal() Content = %q, want %q", internal.Content, "2001:db8::1")
+	}
+}
+
+func TestWildcardRoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		rrName       string
+		wantAPIName  string
+		wantLibdnsRR string
+	}{
+		{name: "relative wildcard", rrName: "*", wantAPIName: "*", wantLibdnsRR: "*.example.com."},
+		{name: "absolute wildcard", rrName: "*.example.com.", wantAPIName: "*", wantLibdnsRR: "*.example.com."},
+		{name: "relative wildcard below subdomain", rrName: "*.sub", wantAPIName: "*.sub", wantLibdnsRR: "*.sub.example.com."},
+		{name: "absolute wildcard below subdomain", rrName: "*.sub.example.com.", wantAPIName: "*.sub", wantLibdnsRR: "*.sub.example.com."},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := libdns.Address{Name: tt.rrName, TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}
+
+			internal, err := libdnsToInternal("example.com.", rec)
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
+			if internal.Name != tt.wantAPIName {
+				t.Errorf("libdnsToInternal() Name = %q, want %q", internal.Name, tt.wantAPIName)
+			}
+
+			back, err := internalToLibdns("example.com.", internal)
+			if err != nil {
+				t.Fatalf("internalToLibdns() error = %v", err)
+			}
+			if got := back.RR().Name; got != tt.wantLibdnsRR {
+				t.Errorf("internalToLibdns() Name = %q, want %q", got, tt.wantLibdnsRR)
+			}
+		})
+	}
+}
+
+func TestSSHFPRoundTrip(t *testing.T) {
+	rr := libdns.RR{
+		Name: "host.example.com.",
+		Type: "SSHFP",
+		Data: "4 2 123456789abcdef67890123456789abcdef67890123456789abcdef123456789",
+		TTL:  time.Hour,
+	}
+
+	internal, err := libdnsToInternal("example.com", rr)
+	if err != nil {
+		t.Fatalf("libdnsToInternal() error = %v", err)
+	}
+
+	rec, err := internalToLibdns("example.com", internal)
+	if err != nil {
+		t.Fatalf("internalToLibdns() error = %v", err)
+	}
+
+	got := rec.RR()
+	if got.Name != rr.Name || got.Type != rr.Type || got.Data != rr.Data || got.TTL != rr.TTL {
+		t.Errorf("round trip = %+v, want %+v", got, rr)
+	}
+}
+
+func TestDSRoundTrip(t *testing.T) {
+	rr := libdns.RR{
+		Name: "sub.example.com.",
+		Type: "DS",
+		Data: "60485 5 1 2BB183AF5F22588179A53B0A98631FAD1A292118",
+		TTL:  time.Hour,
+	}
+
+	internal, err := libdnsToInternal("example.com", rr)
+	if err != nil {
+		t.Fatalf("libdnsToInternal() error = %v", err)
+	}
+
+	if internal.Content != rr.Data || internal.Priority != 0 {
+		t.Errorf("internal record = %+v, want content %q and no priority", internal, rr.Data)
+	}
+
+	rec, err := internalToLibdns("example.com", internal)
+	if err != nil {
+		t.Fatalf("internalToLibdns() error = %v", err)
+	}
+
+	got := rec.RR()
+	if got.Name != rr.Name || got.Type != rr.Type || got.Data != rr.Data || got.TTL != rr.TTL {
+		t.Errorf("round trip = %+v, want %+v", got, rr)
+	}
+}
+
+func TestReversePTRRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		rrName   string
+		apiName  string
+		wantName string
+	}{
+		{
+			name:     "IPv4 relative name",
+			zone:     "2.0.192.in-addr.arpa.",
+			rrName:   "1",
+			apiName:  "1",
+			wantName: "1.2.0.192.in-addr.arpa.",
+		},
+		{
+			name:     "IPv4 FQDN",
+			zone:     "2.0.192.in-addr.arpa",
+			rrName:   "25.2.0.192.in-addr.arpa.",
+			apiName:  "25",
+			wantName: "25.2.0.192.in-addr.arpa.",
+		},
+		{
+			name:     "IPv4 classless delegation",
+			zone:     "0-25.2.0.192.in-addr.arpa.",
+			rrName:   "1.0-25.2.0.192.in-addr.arpa.",
+			apiName:  "1",
+			wantName: "1.0-25.2.0.192.in-addr.arpa.",
+		},
+		{
+			name:     "IPv6 nibbles",
+			zone:     "8.b.d.0.1.0.0.2.ip6.arpa.",
+			rrName:   "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+			apiName:  "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0",
+			wantName: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := libdns.RR{Name: tt.rrName, Type: "PTR", Data: "host.example.com.", TTL: time.Hour}
+
+			internal, err := libdnsToInternal(tt.zone, rr)
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
+
+			if internal.Name != tt.apiName || internal.Content != "host.example.com." {
+				t.Errorf("libdnsToInternal() = %+v, want name %q and the target as content", internal, tt.apiName)
+			}
+
+			rec, err := internalToLibdns(tt.zone, internal)
+			if err != nil {
+				t.Fatalf("internalToLibdns() error = %v", err)
+			}
+
+			got := rec.RR()
+			if got.Name != tt.wantName || got.Type != "PTR" || got.Data != rr.Data || got.TTL != rr.TTL {
+				t.Errorf("round trip = %+v, want name %q", got, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestApexTXTRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		zone        string
+		rrName      string
+		data        string
+		wantContent string
+		wantData    string
+	}{
+		{
+			name:        "SPF at @",
+			zone:        "example.com",
+			rrName:      "@",
+			data:        "v=spf1 include:_spf.example.com ~all",
+			wantContent: "v=spf1 include:_spf.example.com ~all",
+			wantData:    "v=spf1 include:_spf.example.com ~all",
+		},
+		{
+			name:        "quoted SPF at the zone FQDN",
+			zone:        "example.com.",
+			rrName:      "example.com.",
+			data:        `"v=spf1 mx -all"`,
+			wantContent: "v=spf1 mx -all",
+			wantData:    "v=spf1 mx -all",
+		},
+		{
+			name:        "empty name",
+			zone:        "example.com.",
+			rrName:      "",
+			data:        "google-site-verification=abc123",
+			wantContent: "google-site-verification=abc123",
+			wantData:    "google-site-verification=abc123",
+		},
+		{
+			name:        "multi-string DKIM key",
+			zone:        "example.com",
+			rrName:      "@",
+			data:        `"v=DKIM1; k=rsa; " "p=MIIBIjANBgkq\"hkiG9w0B"`,
+			wantContent: `v=DKIM1; k=rsa; p=MIIBIjANBgkq"hkiG9w0B`,
+			wantData:    `v=DKIM1; k=rsa; p=MIIBIjANBgkq"hkiG9w0B`,
+		},
+		{
+			name:        "value ending in a quote",
+			zone:        "example.com",
+			rrName:      "@",
+			data:        `policy="strict"`,
+			wantContent: `policy="strict"`,
+			wantData:    `policy="strict"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := libdns.RR{Name: tt.rrName, Type: "TXT", Data: tt.data, TTL: time.Hour}
+
+			internal, err := libdnsToInternal(tt.zone, rr)
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
+
+			if internal.Name != "@" || internal.Content != tt.wantContent {
+				t.Errorf("libdnsToInternal() = %+v, want name \"@\" and content %q", internal, tt.wantContent)
+			}
+
+			rec, err := internalToLibdns(tt.zone, internal)
+			if err != nil {
+				t.Fatalf("internalToLibdns() error = %v", err)
+			}
+
+			txt, ok := rec.(libdns.TXT)
+			if !ok {
+				t.Fatalf("internalToLibdns() = %T, want libdns.TXT", rec)
+			}
+
+			got := txt.RR()
+			if got.Name != "example.com." || got.Data != tt.wantData || txt.Text != tt.wantData || got.TTL != time.Hour {
+				t.Errorf("round trip = %+v, want name \"example.com.\" and data %q", got, tt.wantData)
+			}
+
+			// A second round trip must not strip anything more
+			again, err := libdnsToInternal(tt.zone, rec)
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
+			if again != internal {
+				t.Errorf("second round trip = %+v, want %+v", again, internal)
+			}
+		})
+	}
+}
+
+func TestProvider_PreserveTXTQuotes(t *testing.T) {
+	tests := []struct {
+		name      string
+		preserve  bool
+		wantValue string
+	}{
+		{
+			name:      "quotes stripped by default",
+			preserve:  false,
+			wantValue: `v=quoted`,
+		},
+		{
+			name:      "quotes kept when preserved",
+			preserve:  true,
+			wantValue: `"v=quoted"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{PreserveTXTQuotes: tt.preserve}
+
+			internal, err := p.libdnsToInternal("example.com", libdns.TXT{Name: "_test", Text: `"v=quoted"`})
+			if err != nil {
+				t.Fatalf("libdnsToInternal() error = %v", err)
+			}
+			if internal.Content != tt.wantValue {
+				t.Errorf("libdnsToInternal() Content = %q, want %q", internal.Content, tt.wantValue)
+			}
+
+			rec, err := p.internalToLibdns("example.com", Record{Name: "_test", Type: "TXT", Content: `"v=quoted"`, TTL: 300})
+			if err != nil {
+				t.Fatalf("internalToLibdns() error = %v", err)
+			}
+			txt, ok := rec.(libdns.TXT)
+			if !ok {
+				t.Fatalf("internalToLibdns() returned %T, want libdns.TXT", rec)
+			}
+			if txt.Text != tt.wantValue {
+				t.Errorf("internalToLibdns() Text = %q, want %q", txt.Text, tt.wantValue)
+			}
+		})
+	}
+}
+
+func TestProvider_Verify(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		}))
+		defer server.Close()
+
+		p := &Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true}
+
+		if err := p.Verify(context.Background()); err != nil {
+			t.Errorf("Verify() error = %v", err)
+		}
+	})
+
+	t.Run("bad token", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "unauthorized"})
+		}))
+		defer server.Close()
+
+		p := &Provider{APIToken: "bad-token", APIURL: server.URL, AllowInsecureHTTP: true}
+
+		err := p.Verify(context.Background())
+		if !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Verify() error = %v, want ErrUnauthorized", err)
+		}
+		if errors.Is(err, ErrUnreachable) {
+			t.Errorf("Verify() error = %v, should not be ErrUnreachable", err)
+		}
+	})
+
+	t.Run("dial error", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		serverURL := server.URL
+		server.Close()
+
+		p := &Provider{APIToken: "test-token", APIURL: serverURL, AllowInsecureHTTP: true}
+
+		err := p.Verify(context.Background())
+		if !errors.Is(err, ErrUnreachable) {
+			t.Errorf("Verify() error = %v, want ErrUnreachable", err)
+		}
+		if errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Verify() error = %v, should not be ErrUnauthorized", err)
+		}
+	})
+}
+
+func TestProvider_ListZones(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`[
+			{"id": 1, "name": "example.com", "human_name": "example.com", "records_count": 12, "status": "active"},
+			{"id": 2, "name": "xn--bcher-kva.example", "human_name": "bücher.example", "records_count": 3, "status": "pending"}
+		]`))
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	zones, err := p.ListZones(context.Background())
+	if err != nil {
+		t.Fatalf("ListZones() error = %v", err)
+	}
+
+	want := []libdns.Zone{{Name: "example.com."}, {Name: "xn--bcher-kva.example."}}
+	if !slices.Equal(zones, want) {
+		t.Errorf("ListZones() = %v, want %v", zones, want)
+	}
+
+	infos, err := p.ListZoneInfos(context.Background())
+	if err != nil {
+		t.Fatalf("ListZoneInfos() error = %v", err)
+	}
+
+	wantInfos := []ZoneInfo{
+		{ID: 1, Name: "example.com.", HumanName: "example.com", RecordCount: 12, Status: "active"},
+		{ID: 2, Name: "xn--bcher-kva.example.", HumanName: "bücher.example", RecordCount: 3, Status: "pending"},
+	}
+	if !slices.Equal(infos, wantInfos) {
+		t.Errorf("ListZoneInfos() = %+v, want %+v", infos, wantInfos)
+	}
+}
+
+func TestProvider_GetZone(t *testing.T) {
+	tests := []struct {
+		name     string
+		zone     string
+		wantZone libdns.Zone
+		wantErr  error
+	}{
+		{
+			name:     "found",
+			zone:     "example.com",
+			wantZone: libdns.Zone{Name: "example.com."},
+		},
+		{
+			name:     "found with trailing dot",
+			zone:     "example.org.",
+			wantZone: libdns.Zone{Name: "example.org."},
+		},
+		{
+			name:    "not found",
+			zone:    "example.net",
+			wantErr: ErrZoneNotFound,
+		},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Zone{
+			{ID: 1, Name: "example.com", Status: "active"},
+			{ID: 2, Name: "example.org", Status: "pending"},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zone, err := p.GetZone(context.Background(), tt.zone)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetZone() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if zone != tt.wantZone {
+				t.Errorf("GetZone() = %+v, want %+v", zone, tt.wantZone)
+			}
+		})
+	}
+
+	info, err := p.GetZoneInfo(context.Background(), "example.org")
+	if err != nil {
+		t.Fatalf("GetZoneInfo() error = %v", err)
+	}
+	if info.ID != 2 || info.Status != "pending" {
+		t.Errorf("GetZoneInfo() = %+v, want zone 2 with its status", info)
+	}
+}
+
+func TestProvider_CreateZone(t *testing.T) {
+	tests := []struct {
+		name        string
+		zone        string
+		createCode  int
+		wantCreated string
+		wantName    string
+		wantErrIs   error
+	}{
+		{
+			name:        "new zone",
+			zone:        "example.org.",
+			createCode:  http.StatusCreated,
+			wantCreated: "example.org",
+			wantName:    "example.org.",
+		},
+		{
+			name:      "zone already in the account",
+			zone:      "Example.com",
+			wantErrIs: ErrZoneExists,
+		},
+		{
+			name:        "zone created concurrently",
+			zone:        "example.net",
+			createCode:  http.StatusConflict,
+			wantCreated: "example.net",
+			wantErrIs:   ErrZoneExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/dns/zones" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				if r.Method == http.MethodGet {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				var req ZoneRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				created = append(created, req.Zone.Name)
+
+				w.WriteHeader(tt.createCode)
+				_ = json.NewEncoder(w).Encode(Zone{ID: 2, Name: req.Zone.Name})
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			zone, err := p.CreateZone(context.Background(), tt.zone)
+			if tt.wantErrIs != nil {
+				if !errors.Is(err, tt.wantErrIs) {
+					t.Errorf("CreateZone() error = %v, want %v", err, tt.wantErrIs)
+				}
+			} else if err != nil {
+				t.Fatalf("CreateZone() error = %v", err)
+			}
+
+			if tt.wantCreated == "" && len(created) != 0 {
+				t.Errorf("CreateZone() sent creations %v, want none", created)
+			}
+			if tt.wantCreated != "" && !slices.Equal(created, []string{tt.wantCreated}) {
+				t.Errorf("CreateZone() sent creations %v, want %q", created, tt.wantCreated)
+			}
+
+			if zone.Name != tt.wantName {
+				t.Errorf("CreateZone() = %q, want %q", zone.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestProvider_DeleteZone(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			deleted = append(deleted, r.URL.Path)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	err := p.DeleteZone(context.Background(), "example.com.")
+	if err != nil {
+		t.Fatalf("DeleteZone() error = %v", err)
+	}
+
+	if !slices.Equal(deleted, []string{"/dns/zones/1"}) {
+		t.Errorf("DeleteZone() deleted %v, want /dns/zones/1", deleted)
+	}
+
+	err = p.DeleteZone(context.Background(), "missing.com")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("DeleteZone() error = %v, want ErrZoneNotFound", err)
+	}
+
+	if len(deleted) != 1 {
+		t.Errorf("DeleteZone() of a missing zone sent deletions %v", deleted[1:])
+	}
+}
+
+func TestProvider_GetZoneSerial(t *testing.T) {
+	tests := []struct {
+		name       string
+		zone       Zone
+		records    []Record
+		wantSerial uint32
+		wantErr    bool
+	}{
+		{
+			name:       "serial in the zone list",
+			zone:       Zone{ID: 1, Name: "example.com", Serial: 2024010103},
+			wantSerial: 2024010103,
+		},
+		{
+			name: "serial from the SOA record",
+			zone: Zone{ID: 1, Name: "example.com"},
+			records: []Record{
+				{ID: 9, Name: "@", Type: "SOA", Content: "ns1.provider.net. hostmaster.example.com. 2024010205 7200 3600 1209600 300", TTL: 3600},
+			},
+			wantSerial: 2024010205,
+		},
+		{
+			name:    "no serial",
+			zone:    Zone{ID: 1, Name: "example.com"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{tt.zone})
+					return
+				}
+
+				if r.URL.Query().Get("type") != "SOA" {
+					t.Errorf("records requested with type %q, want SOA", r.URL.Query().Get("type"))
+				}
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(tt.records)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			serial, err := p.GetZoneSerial(context.Background(), "example.com.")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetZoneSerial() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if serial != tt.wantSerial {
+				t.Errorf("GetZoneSerial() = %d, want %d", serial, tt.wantSerial)
+			}
+		})
+	}
+}
+
+func TestProvider_GetZoneID(t *testing.T) {
+	tests := []struct {
+		name     string
+		zoneName string
+		zones    []Zone
+		wantID   int
+		wantErr  bool
+	}{
+		{
+			name:     "zone found without trailing dot",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "example.org"},
+			},
+			wantID:  1,
+			wantErr: false,
+		},
+		{
+			name:     "zone found with trailing dot",
+			zoneName: "example.com.",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "example.org"},
+			},
+			wantID:  1,
+			wantErr: false,
+		},
+		{
+			name:     "mixed-case query",
+			zoneName: "Example.COM.",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "example.org"},
+			},
+			wantID:  1,
+			wantErr: false,
+		},
+		{
+			name:     "mixed-case zone with trailing dot",
+			zoneName: "example.org",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "Example.ORG."},
+			},
+			wantID:  2,
+			wantErr: false,
+		},
+		{
+			name:     "punycode query",
+			zoneName: "XN--BCHER-KVA.example.",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 3, Name: "xn--bcher-kva.example", HumanName: "bücher.example"},
+			},
+			wantID:  3,
+			wantErr: false,
+		},
+		{
+			name:     "unicode query",
+			zoneName: "Bücher.example",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 3, Name: "xn--bcher-kva.example", HumanName: "bücher.example"},
+			},
+			wantID:  3,
+			wantErr: false,
+		},
+		{
+			name:     "unicode query without human name",
+			zoneName: "bücher.example.",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 3, Name: "xn--bcher-kva.example"},
+			},
+			wantID:  3,
+			wantErr: false,
+		},
+		{
+			name:     "zone not found",
+			zoneName: "notfound.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "example.org"},
+			},
+			wantID:  0,
+			wantErr: true,
+		},
+		{
+			name:     "empty zones list",
+			zoneName: "example.com",
+			zones:    []Zone{},
+			wantID:   0,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(tt.zones)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			zoneID, err := p.getZoneID(context.Background(), tt.zoneName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getZoneID() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && zoneID != tt.wantID {
+				t.Errorf("getZoneID() = %v, want %v", zoneID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecordsUnicodeNames(t *testing.T) {
+	var created []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 3, Name: "xn--bcher-kva.example"}})
+			return
+		}
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		created = append(created, r.URL.Path+" "+req.Record.Name)
+		req.Record.ID = 100
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	// U-labels are sent in punycode; ASCII labels the IDNA rules reject are kept
+	records, err := p.AppendRecords(context.Background(), "bücher.example.", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge.café", TTL: time.Minute, Text: "token"},
+		libdns.TXT{Name: "café.bücher.example.", TTL: time.Minute, Text: "token"},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords() error = %v", err)
+	}
+
+	want := []string{
+		"/dns/zones/3/records _acme-challenge.xn--caf-dma",
+		"/dns/zones/3/records xn--caf-dma",
+	}
+	if !slices.Equal(created, want) {
+		t.Errorf("created %v, want %v", created, want)
+	}
+
+	if len(records) != 2 || records[0].RR().Name != "_acme-challenge.xn--caf-dma.xn--bcher-kva.example." {
+		t.Errorf("AppendRecords() = %+v", records)
+	}
+}
+
+func TestProvider_ResolveParentZone(t *testing.T) {
+	zones := []Zone{
+		{ID: 1, Name: "example.com"},
+		{ID: 2, Name: "ample.com"},
+		{ID: 3, Name: "dev.example.com"},
+	}
+
+	tests := []struct {
+		name       string
+		zone       string
+		wantZoneID int
+		wantName   string
+	}{
+		{name: "zone itself", zone: "example.com.", wantZoneID: 1, wantName: "_acme-challenge"},
+		{name: "deep name", zone: "a.b.www.example.com", wantZoneID: 1, wantName: "_acme-challenge.a.b.www"},
+		{name: "longest suffix wins", zone: "app.DEV.example.com.", wantZoneID: 3, wantName: "_acme-challenge.app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(zones)
+					return
+				}
+
+				var req RecordRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				created = append(created, r.URL.Path+" "+req.Record.Name)
+				req.Record.ID = 100
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(req.Record)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				ResolveParentZone: true,
+			}
+
+			records, err := p.AppendRecords(context.Background(), tt.zone, []libdns.Record{
+				libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "token"},
+			})
+			if err != nil {
+				t.Fatalf("AppendRecords() error = %v", err)
+			}
+
+			want := fmt.Sprintf("/dns/zones/%d/records %s", tt.wantZoneID, tt.wantName)
+			if len(created) != 1 || created[0] != want {
+				t.Errorf("created %v, want [%s]", created, want)
+			}
+
+			// The name keeps its meaning relative to the given zone
+			wantFQDN := "_acme-challenge." + strings.ToLower(strings.TrimSuffix(tt.zone, ".")) + "."
+			if len(records) != 1 || !strings.EqualFold(records[0].RR().Name, wantFQDN) {
+				t.Errorf("AppendRecords() = %+v, want the record named %s", records, wantFQDN)
+			}
+		})
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(zones)
+	}))
+	defer server.Close()
+
+	p := &Provider{APIToken: "test-token", APIURL: server.URL, AllowInsecureHTTP: true}
+
+	_, err := p.AppendRecords(context.Background(), "www.example.com", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("AppendRecords() error = %v without ResolveParentZone, want ErrZoneNotFound", err)
+	}
+
+	// A whole-zone operation must not take over the enclosing zone
+	p.ResolveParentZone = true
+	_, err = p.ReplaceZone(context.Background(), "www.example.com", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("ReplaceZone() error = %v for a name inside a zone, want ErrZoneNotFound", err)
+	}
+
+	_, err = p.AppendRecords(context.Background(), "example.net", []libdns.Record{libdns.TXT{Name: "x", Text: "y"}})
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("AppendRecords() error = %v for a name outside every zone, want ErrZoneNotFound", err)
+	}
+}
+
+func TestProvider_VerifyEndpoint(t *testing.T) {
+	t.Run("non-API server", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("<html><body>Control panel login</body></html>"))
+		}))
+		defer server.Close()
+
+		p := &Provider{
+			APIToken:          "test-token",
+			APIURL:            server.URL,
+			AllowInsecureHTTP: true,
+			VerifyEndpoint:    true,
+		}
+
+		_, err := p.GetRecords(context.Background(), "example.com")
+		if err == nil {
+			t.Fatal("GetRecords() expected an error")
+		}
+
+		if !strings.Contains(err.Error(), "does not appear to be a Neodigit API") {
+			t.Errorf("GetRecords() error = %v, want a misconfigured API URL error", err)
+		}
+	})
+
+	t.Run("API server is probed once", func(t *testing.T) {
+		zoneRequests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/dns/zones" {
+				zoneRequests++
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			} else {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Record{})
+			}
+		}))
+		defer server.Close()
+
+		p := &Provider{
+			APIToken:          "test-token",
+			APIURL:            server.URL,
+			AllowInsecureHTTP: true,
+			VerifyEndpoint:    true,
+		}
+
+		for range 2 {
+			_, err := p.GetRecords(context.Background(), "example.com")
+			if err != nil {
+				t.Fatalf("GetRecords() error = %v", err)
+			}
+		}
+
+		// One probe plus one zone lookup per call
+		if zoneRequests != 3 {
+			t.Errorf("server received %d zone requests, want 3", zoneRequests)
+		}
+	})
+}
+
+func TestProvider_GetRecords(t *testing.T) {
+	tests := []struct {
+		name      string
+		zoneName  string
+		zones     []Zone
+		records   []Record
+		wantErr   bool
+		wantCount int
+	}{
+		{
+			name:     "get all records",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			records: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "mail", Type: "A", Content: "192.0.2.2", TTL: 3600},
+			},
+			wantErr:   false,
+			wantCount: 2,
+		},
+		{
+			name:      "zone not found",
+			zoneName:  "notfound.com",
+			zones:     []Zone{},
+			records:   []Record{},
+			wantErr:   true,
+			wantCount: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(tt.zones)
+				} else {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(tt.records)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.GetRecords(context.Background(), tt.zoneName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRecords() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && len(records) != tt.wantCount {
+				t.Errorf("GetRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestProvider_WalkRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "a", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			{ID: 2, Name: "b", Type: "A", Content: "192.0.2.2", TTL: 3600},
+			{ID: 3, Name: "c", Type: "A", Content: "192.0.2.3", TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	errStop := errors.New("stop")
+
+	var visited []string
+	err := p.WalkRecords(context.Background(), "example.com", func(rec libdns.Record) error {
+		visited = append(visited, rec.RR().Name)
+		if len(visited) == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("WalkRecords() error = %v, want the callback error", err)
+	}
+
+	if !slices.Equal(visited, []string{"a.example.com.", "b.example.com."}) {
+		t.Errorf("WalkRecords() visited %v, want it to stop after the second record", visited)
+	}
+}
+
+func TestProvider_GetRecordsWithZone(t *testing.T) {
+	var recordPaths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}, {ID: 7, Name: "example.org"}})
+			return
+		}
+
+		recordPaths = append(recordPaths, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	zoneID, records, err := p.GetRecordsWithZone(context.Background(), "example.org.")
+	if err != nil {
+		t.Fatalf("GetRecordsWithZone() error = %v", err)
+	}
+
+	if zoneID != 7 {
+		t.Errorf("GetRecordsWithZone() zone ID = %d, want 7", zoneID)
+	}
+
+	if !slices.Equal(recordPaths, []string{"/dns/zones/7/records"}) {
+		t.Errorf("GetRecordsWithZone() fetched %v, want the records of zone 7", recordPaths)
+	}
+
+	if len(records) != 1 || records[0].RR().Name != "www.example.org." {
+		t.Errorf("GetRecordsWithZone() records = %v", records)
+	}
+
+	_, _, err = p.GetRecordsWithZone(context.Background(), "unknown.com")
+	if !errors.Is(err, ErrZoneNotFound) {
+		t.Errorf("GetRecordsWithZone() error = %v, want ErrZoneNotFound", err)
+	}
+}
+
+func TestProvider_GetAllRecords(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dns/zones":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{
+				{ID: 1, Name: "example.com"},
+				{ID: 2, Name: "example.org"},
+				{ID: 3, Name: "broken.net"},
+			})
+		case "/dns/zones/1/records":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 10, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 11, Name: "@", Type: "TXT", Content: "v=spf1 -all", TTL: 3600},
+			})
+		case "/dns/zones/2/records":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 20, Name: "mail", Type: "AAAA", Content: "2001:db8::25", TTL: 600},
+			})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	all, err := p.GetAllRecords(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "broken.net") {
+		t.Errorf("GetAllRecords() error = %v, want the failure of broken.net", err)
+	}
+
+	if len(all) != 2 {
+		t.Fatalf("GetAllRecords() returned %d zones, want 2: %v", len(all), all)
+	}
+
+	com := all["example.com."]
+	if len(com) != 2 || com[0].RR().Name != "www.example.com." || com[1].RR().Name != "example.com." {
+		t.Errorf("GetAllRecords()[example.com.] = %+v", com)
+	}
+
+	org := all["example.org."]
+	if len(org) != 1 || org[0].RR().Name != "mail.example.org." || org[0].RR().Data != "2001:db8::25" {
+		t.Errorf("GetAllRecords()[example.org.] = %+v", org)
+	}
+}
+
+func TestProvider_GetRecordsStrictParsing(t *testing.T) {
+	tests := []struct {
+		name          string
+		strictParsing bool
+		wantErr       bool
+		wantCount     int
+	}{
+		{
+			name:          "lenient skips the malformed record",
+			strictParsing: false,
+			wantErr:       false,
+			wantCount:     1,
+		},
+		{
+			name:          "strict fails on the malformed record",
+			strictParsing: true,
+			wantErr:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+						{ID: 42, Name: "broken", Type: "A", Content: "not-an-ip", TTL: 3600},
+					})
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				StrictParsing:     tt.strictParsing,
+			}
+
+			records, err := p.GetRecords(context.Background(), "example.com")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetRecords() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "record 42") {
+					t.Errorf("GetRecords() error = %v, want it to name record 42", err)
+				}
+				return
+			}
+
+			if len(records) != tt.wantCount {
+				t.Errorf("GetRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestProvider_GetRecordsLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "broken", Type: "A", Content: "not-an-ip", TTL: 3600},
+			})
+		}
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		Logger:            log.New(&buf, "", 0),
+	}
+
+	records, err := p.GetRecords(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("GetRecords() error = %v", err)
+	}
+
+	if len(records) != 1 {
+		t.Errorf("GetRecords() returned %d records, want 1", len(records))
+	}
+
+	output := buf.String()
+	if !strings.Contains(output, "skipping record 2 (A broken)") {
+		t.Errorf("log output does not mention the skipped record:\n%s", output)
+	}
+	if !strings.Contains(output, "GET "+server.URL+"/dns/zones: 200") {
+		t.Errorf("log output does not mention the zones request:\n%s", output)
+	}
+}
+
+func TestProvider_GetRecordsSorted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "www", Type: "TXT", Content: "b", TTL: 3600},
+			{ID: 2, Name: "mail", Type: "A", Content: "192.0.2.2", TTL: 3600},
+			{ID: 3, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			{ID: 4, Name: "www", Type: "TXT", Content: "a", TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		sortRecords bool
+		wantIDs     []int
+	}{
+		{
+			name:    "API order by default",
+			wantIDs: []int{1, 2, 3, 4},
+		},
+		{
+			name:        "sorted by name, type and data",
+			sortRecords: true,
+			wantIDs:     []int{2, 3, 4, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				SortRecords:       tt.sortRecords,
+			}
+
+			records, err := p.GetRecords(context.Background(), "example.com")
+			if err != nil {
+				t.Fatalf("GetRecords() error = %v", err)
+			}
+
+			var gotIDs []int
+			for _, rec := range records {
+				id, _ := RecordID(rec)
+				gotIDs = append(gotIDs, id)
+			}
+
+			if !slices.Equal(gotIDs, tt.wantIDs) {
+				t.Errorf("GetRecords() returned IDs %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestProvider_GetRecordsIncludeDisabled(t *testing.T) {
+	tests := []struct {
+		name            string
+		includeDisabled bool
+		wantCount       int
+	}{
+		{
+			name:            "disabled records excluded by default",
+			includeDisabled: false,
+			wantCount:       1,
+		},
+		{
+			name:            "disabled records included on request",
+			includeDisabled: true,
+			wantCount:       2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else {
+					gotQuery = r.URL.Query().Get("include_disabled")
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+						{ID: 2, Name: "old", Type: "A", Content: "192.0.2.2", TTL: 3600, Disabled: true},
+					})
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				IncludeDisabled:   tt.includeDisabled,
+			}
+
+			records, err := p.GetRecords(context.Background(), "example.com")
+			if err != nil {
+				t.Fatalf("GetRecords() error = %v", err)
+			}
+
+			if len(records) != tt.wantCount {
+				t.Fatalf("GetRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+
+			if (gotQuery == "true") != tt.includeDisabled {
+				t.Errorf("include_disabled query = %q, want it set = %v", gotQuery, tt.includeDisabled)
+			}
+
+			for _, rec := range records {
+				pd, _ := providerData(rec)
+				if pd.Disabled != (pd.ID == 2) {
+					t.Errorf("record %d Disabled = %v", pd.ID, pd.Disabled)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_GetRecordsWeighted(t *testing.T) {
+	records := []Record{
+		{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600, Weight: 10},
+		{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600, Weight: 30},
+		{ID: 3, Name: "www", Type: "AAAA", Content: "2001:db8::1", TTL: 3600, Weight: 60},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(records)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	got, err := p.GetRecords(context.Background(), "example.com.")
+	if err != nil {
+		t.Fatalf("GetRecords() error = %v", err)
+	}
+
+	if len(got) != len(records) {
+		t.Fatalf("GetRecords() returned %d records, want %d", len(got), len(records))
+	}
+
+	for i, rec := range got {
+		pd, ok := providerData(rec)
+		if !ok {
+			t.Errorf("record %d has no ProviderData", i)
+			continue
+		}
+		if pd.Weight != records[i].Weight {
+			t.Errorf("record %d Weight = %d, want %d", i, pd.Weight, records[i].Weight)
+		}
+
+		// The weight must survive the conversion back to the API format
+		if internal, _ := libdnsToInternal("example.com.", rec); internal.Weight != records[i].Weight {
+			t.Errorf("record %d round-trip Weight = %d, want %d", i, internal.Weight, records[i].Weight)
+		}
+	}
+}
+
+func TestProvider_GetRecordsByType(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordType string
+		wantQuery  string
+		wantErr    bool
+	}{
+		{
+			name:       "TXT records",
+			recordType: "TXT",
+			wantQuery:  "TXT",
+			wantErr:    false,
+		},
+		{
+			name:       "lowercase type",
+			recordType: "mx",
+			wantQuery:  "MX",
+			wantErr:    false,
+		},
+		{
+			name:       "unknown type",
+			recordType: "BOGUS",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotQuery string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else {
+					gotQuery = r.URL.Query().Get("type")
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token", TTL: 300},
+					})
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			_, err := p.GetRecordsByType(context.Background(), "example.com.", tt.recordType)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRecordsByType() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if gotQuery != tt.wantQuery {
+				t.Errorf("GetRecordsByType() sent type=%q, want %q", gotQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestProvider_FindRecordsByContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "www", Type: "AAAA", Content: "2001:0db8::0001", TTL: 3600},
+			{ID: 2, Name: "api", Type: "AAAA", Content: "2001:db8::2", TTL: 3600},
+			{ID: 3, Name: "legacy", Type: "AAAA", Content: "2001:db8::1", TTL: 3600},
+			{ID: 4, Name: "note", Type: "TXT", Content: "2001:db8::1", TTL: 3600},
+			{ID: 5, Name: "mail", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		wantIDs []int
+	}{
+		{name: "address in any notation", content: "2001:db8:0::1", wantIDs: []int{1, 3, 4}},
+		{name: "IPv4 address", content: "192.0.2.1", wantIDs: []int{5}},
+		{name: "no match", content: "198.51.100.1", wantIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := p.FindRecordsByContent(context.Background(), "example.com", tt.content)
+			if err != nil {
+				t.Fatalf("FindRecordsByContent() error = %v", err)
+			}
+
+			var ids []int
+			for _, rec := range records {
+				id, _ := RecordID(rec)
+				ids = append(ids, id)
+			}
+
+			if !slices.Equal(ids, tt.wantIDs) {
+				t.Errorf("FindRecordsByContent() returned records %v, want %v", ids, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestProvider_ListRecordsRaw(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 7, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+			{ID: 8, Name: "broken", Type: "SRV", Content: "not srv data", TTL: 3600, Priority: 5},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	records, err := p.ListRecordsRaw(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("ListRecordsRaw() error = %v", err)
+	}
+
+	// Records that fail to convert are returned as well
+	want := []Record{
+		{ID: 7, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+		{ID: 8, Name: "broken", Type: "SRV", Content: "not srv data", TTL: 3600, Priority: 5},
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("ListRecordsRaw() = %+v, want %+v", records, want)
+	}
+}
+
+func TestProvider_GetRecordRaw(t *testing.T) {
+	raw := `{"id":42,"name":"weird","type":"SRV","content":"not valid srv","ttl":"3600","extra":{"a":[1,2]}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dns/zones":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		case "/dns/zones/1/records/42":
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(raw))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	got, err := p.GetRecordRaw(context.Background(), "example.com.", 42)
+	if err != nil {
+		t.Fatalf("GetRecordRaw() error = %v", err)
+	}
+
+	if string(got) != raw {
+		t.Errorf("GetRecordRaw() = %s, want %s", got, raw)
+	}
+
+	_, err = p.GetRecordRaw(context.Background(), "example.com.", 7)
+	if err == nil {
+		t.Error("GetRecordRaw() expected an error for a missing record")
+	}
+}
+
+func TestProvider_GetRecord(t *testing.T) {
+	var gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else {
+			gotQuery = r.URL.Query().Get("type")
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token-a", TTL: 300},
+				{ID: 2, Name: "_acme-challenge.www", Type: "TXT", Content: "token-b", TTL: 300},
+				{ID: 3, Name: "_acme-challenge", Type: "TXT", Content: "token-c", TTL: 300},
+				{ID: 4, Name: "@", Type: "TXT", Content: "v=spf1 -all", TTL: 300},
+			})
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	tests := []struct {
+		name    string
+		input   string
+		wantIDs []int
+	}{
+		{name: "relative name", input: "_acme-challenge", wantIDs: []int{1, 3}},
+		{name: "FQDN", input: "_acme-challenge.www.example.com.", wantIDs: []int{2}},
+		{name: "apex", input: "@", wantIDs: []int{4}},
+		{name: "no match", input: "missing", wantIDs: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := p.GetRecord(context.Background(), "example.com.", tt.input, "TXT")
+			if err != nil {
+				t.Fatalf("GetRecord() error = %v", err)
+			}
+
+			if gotQuery != "TXT" {
+				t.Errorf("GetRecord() sent type=%q, want TXT", gotQuery)
+			}
+
+			var gotIDs []int
+			for _, rec := range records {
+				id, _ := RecordID(rec)
+				gotIDs = append(gotIDs, id)
+			}
+
+			if !slices.Equal(gotIDs, tt.wantIDs) {
+				t.Errorf("GetRecord() returned IDs %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecords(t *testing.T) {
+	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
+		rr := libdns.RR{
+			Name: name,
+			Type: typ,
+			Data: data,
+			TTL:  ttl,
+		}
+		rec, _ := rr.Parse()
+		return rec
+	}
+
+	tests := []struct {
+		name       string
+		zoneName   string
+		zones      []Zone
+		newRecords []libdns.Record
+		wantErr    bool
+		wantCount  int
+	}{
+		{
+			name:     "append single record",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			newRecords: []libdns.Record{
+				makeRecord("test", "A", "192.0.2.1", 3600*time.Second),
+			},
+			wantErr:   false,
+			wantCount: 1,
+		},
+		{
+			name:     "append multiple records",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			newRecords: []libdns.Record{
+				makeRecord("test1", "A", "192.0.2.1", 3600*time.Second),
+				makeRecord("test2", "A", "192.0.2.2", 3600*time.Second),
+			},
+			wantErr:   false,
+			wantCount: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordID := 1
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(tt.zones)
+				} else if r.Method == http.MethodPost {
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					req.Record.ID = recordID
+					recordID++
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.AppendRecords(context.Background(), tt.zoneName, tt.newRecords)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AppendRecords() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && len(records) != tt.wantCount {
+				t.Errorf("AppendRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+
+			for _, rec := range records {
+				if id, ok := RecordID(rec); !ok || id == 0 {
+					t.Errorf("AppendRecords() returned %s without its ID", rec.RR().Name)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecordsPartialFailure(t *testing.T) {
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		posts++
+		if posts == 2 {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error":"invalid"}`))
+			return
+		}
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		req.Record.ID = posts
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	records, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "one", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.Address{Name: "two", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+		libdns.Address{Name: "three", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Hour},
+	})
+	if err == nil {
+		t.Fatal("AppendRecords() error = nil, want an error for the failed record")
+	}
+	if !strings.Contains(err.Error(), "two A") {
+		t.Errorf("AppendRecords() error = %v, want it to name the failed record", err)
+	}
+
+	if posts != 3 {
+		t.Errorf("AppendRecords() sent %d creations, want 3", posts)
+	}
+
+	var names []string
+	for _, rec := range records {
+		names = append(names, rec.RR().Name)
+	}
+	if !slices.Equal(names, []string{"one.example.com.", "three.example.com."}) {
+		t.Errorf("AppendRecords() returned %v, want the first and third records", names)
+	}
+}
+
+func TestProvider_AppendRecordsCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		// The caller gives up once the first record is created
+		posts++
+		cancel()
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		req.Record.ID = posts
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	records, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+		libdns.Address{Name: "one", IP: netip.MustParseAddr("192.0.2.1"), TTL: time.Hour},
+		libdns.Address{Name: "two", IP: netip.MustParseAddr("192.0.2.2"), TTL: time.Hour},
+		libdns.Address{Name: "three", IP: netip.MustParseAddr("192.0.2.3"), TTL: time.Hour},
+	})
+	if !errors.Is(err, context.Canceled) || !strings.Contains(err.Error(), "two A") || !strings.Contains(err.Error(), "three A") {
+		t.Errorf("AppendRecords() error = %v, want context.Canceled naming the records not created", err)
+	}
+
+	if posts != 1 {
+		t.Errorf("AppendRecords() sent %d creations, want 1", posts)
+	}
+	if len(records) > 1 {
+		t.Errorf("AppendRecords() returned %d records, want at most the first", len(records))
+	}
+}
+
+func TestProvider_AppendRecordsDuplicate(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		body       string
+		wantExists bool
+	}{
+		{
+			name:       "conflict",
+			statusCode: http.StatusConflict,
+			body:       `{"error":"conflict"}`,
+			wantExists: true,
+		},
+		{
+			name:       "validation error naming a duplicate",
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"message":"Record already exists"}`,
+			wantExists: true,
+		},
+		{
+			name:       "other validation error",
+			statusCode: http.StatusUnprocessableEntity,
+			body:       `{"message":"content is invalid"}`,
+			wantExists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				w.WriteHeader(tt.statusCode)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+			})
+			if err == nil {
+				t.Fatal("AppendRecords() error = nil")
+			}
+
+			if errors.Is(err, ErrRecordExists) != tt.wantExists {
+				t.Errorf("AppendRecords() error = %v, want errors.Is(err, ErrRecordExists) = %v", err, tt.wantExists)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.statusCode {
+				t.Errorf("AppendRecords() error = %v, want it to keep the API error", err)
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecordsMissingID(t *testing.T) {
+	tests := []struct {
+		name       string
+		recordName string
+		storedName string // the name the API lists the record under, if not the one sent
+		wantName   string
+		response   func(w http.ResponseWriter, rec Record)
+	}{
+		{
+			name:       "empty body",
+			recordName: "www",
+			wantName:   "www.example.com.",
+			response: func(w http.ResponseWriter, rec Record) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+		{
+			name:       "record without ID",
+			recordName: "www",
+			wantName:   "www.example.com.",
+			response: func(w http.ResponseWriter, rec Record) {
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(rec)
+			},
+		},
+		{
+			name:       "apex listed in zone notation",
+			recordName: "@",
+			storedName: "example.com",
+			wantName:   "example.com.",
+			response: func(w http.ResponseWriter, rec Record) {
+				w.WriteHeader(http.StatusCreated)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := []Record{
+				{ID: 7, Name: "www", Type: "A", Content: "192.0.2.9", TTL: 3600},
+			}
+			var lookups int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/dns/zones":
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				case r.Method == http.MethodPost:
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					created := req.Record
+					created.ID = 100 + len(stored)
+					if tt.storedName != "" {
+						created.Name = tt.storedName
+					}
+					stored = append(stored, created)
+					tt.response(w, req.Record)
+				default:
+					lookups++
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(stored)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.Address{Name: tt.recordName, TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+			})
+			if err != nil {
+				t.Fatalf("AppendRecords() error = %v", err)
+			}
+
+			if lookups != 1 {
+				t.Errorf("AppendRecords() looked the record up %d times, want 1", lookups)
+			}
+
+			if len(records) != 1 {
+				t.Fatalf("AppendRecords() returned %d records, want 1", len(records))
+			}
+			if id, _ := RecordID(records[0]); id != 101 {
+				t.Errorf("AppendRecords() returned ID %d, want 101", id)
+			}
+			if rr := records[0].RR(); rr.Name != tt.wantName || rr.Data != "192.0.2.1" {
+				t.Errorf("AppendRecords() = %+v", rr)
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecordsBulk(t *testing.T) {
+	tests := []struct {
+		name           string
+		bulkCreate     bool
+		bulkStatus     int
+		wantBulkPosts  int
+		wantSinglePost int
+	}{
+		{
+			name:           "bulk creation not enabled",
+			bulkStatus:     http.StatusCreated,
+			wantSinglePost: 4,
+		},
+		{
+			name:          "bulk endpoint",
+			bulkCreate:    true,
+			bulkStatus:    http.StatusCreated,
+			wantBulkPosts: 2,
+		},
+		{
+			name:           "fallback when the bulk endpoint is missing",
+			bulkCreate:     true,
+			bulkStatus:     http.StatusNotFound,
+			wantBulkPosts:  1,
+			wantSinglePost: 4,
+		},
+		{
+			name:           "fallback when the bulk endpoint rejects the method",
+			bulkCreate:     true,
+			bulkStatus:     http.StatusMethodNotAllowed,
+			wantBulkPosts:  1,
+			wantSinglePost: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var bulkPosts, singlePosts int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				switch r.URL.Path {
+				case "/dns/zones/1/records/bulk":
+					bulkPosts++
+					if tt.bulkStatus != http.StatusCreated {
+						w.WriteHeader(tt.bulkStatus)
+						return
+					}
+
+					var req RecordsRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					for i := range req.Records {
+						req.Records[i].ID = 100*bulkPosts + i
+					}
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Records)
+				case "/dns/zones/1/records":
+					singlePosts++
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					req.Record.ID = singlePosts
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				BulkCreate:        tt.bulkCreate,
+			}
+
+			// The second call shows whether a missing bulk endpoint is remembered
+			for range 2 {
+				records, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+					libdns.Address{Name: "a", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+					libdns.Address{Name: "b", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				})
+				if err != nil {
+					t.Fatalf("AppendRecords() error = %v", err)
+				}
+
+				if len(records) != 2 || records[0].RR().Name != "a.example.com." || records[1].RR().Name != "b.example.com." {
+					t.Fatalf("AppendRecords() = %v, want both records", records)
+				}
+
+				for _, rec := range records {
+					if id, _ := RecordID(rec); id == 0 {
+						t.Errorf("AppendRecords() returned %s without its ID", rec.RR().Name)
+					}
+				}
+			}
+
+			if bulkPosts != tt.wantBulkPosts || singlePosts != tt.wantSinglePost {
+				t.Errorf("AppendRecords() sent %d bulk and %d single creations, want %d and %d",
+					bulkPosts, singlePosts, tt.wantBulkPosts, tt.wantSinglePost)
+			}
+		})
+	}
+}
+
+func TestProvider_AppendRecordsWildcard(t *testing.T) {
+	var gotNames []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotNames = append(gotNames, req.Record.Name)
+		req.Record.ID = len(gotNames)
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	records, err := p.AppendRecords(context.Background(), "example.com.", []libdns.Record{
+		libdns.Address{Name: "*", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.CNAME{Name: "*.sub.example.com.", TTL: time.Hour, Target: "www.example.com."},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords() error = %v", err)
+	}
+
+	if !slices.Equal(gotNames, []string{"*", "*.sub"}) {
+		t.Errorf("API received names %q, want [* *.sub]", gotNames)
+	}
+
+	var names []string
+	for _, rec := range records {
+		names = append(names, rec.RR().Name)
+	}
+	if !slices.Equal(names, []string{"*.example.com.", "*.sub.example.com."}) {
+		t.Errorf("AppendRecords() returned names %q, want the absolute wildcard names", names)
+	}
+}
+
+func TestProvider_AppendRecordsWithOptions(t *testing.T) {
+	var created []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else if r.Method == http.MethodPost {
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = len(created) + 1
+			created = append(created, req.Record)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	opts := RecordOptions{
+		Comment:  "managed by cert-manager",
+		Proxied:  true,
+		Disabled: true,
+		Weight:   25,
+	}
+	rec := WithOptions(libdns.RR{Name: "www", Type: "A", Data: "192.0.2.1", TTL: time.Hour}, opts)
+
+	records, err := p.AppendRecords(context.Background(), "example.com.", []libdns.Record{rec})
+	if err != nil {
+		t.Fatalf("AppendRecords() error = %v", err)
+	}
+
+	if len(created) != 1 {
+		t.Fatalf("AppendRecords() created %d records, want 1", len(created))
+	}
+
+	want := Record{
+		ID:       1,
+		Name:     "www",
+		Type:     "A",
+		Content:  "192.0.2.1",
+		TTL:      3600,
+		Weight:   25,
+		Disabled: true,
+		Proxied:  true,
+		Comment:  "managed by cert-manager",
+	}
+	if created[0] != want {
+		t.Errorf("create payload = %+v, want %+v", created[0], want)
+	}
+
+	pd, ok := providerData(records[0])
+	if !ok || pd.Comment != opts.Comment || pd.Weight != opts.Weight || !pd.Proxied || !pd.Disabled {
+		t.Errorf("returned ProviderData = %+v, want the options %+v", pd, opts)
+	}
+}
+
+func TestProvider_ApexNotation(t *testing.T) {
+	tests := []struct {
+		name     string
+		notation string
+		wantName string
+	}{
+		{name: "default", wantName: "@"},
+		{name: "at", notation: ApexNotationAt, wantName: "@"},
+		{name: "zone name", notation: ApexNotationZone, wantName: "example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []Record
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				var req RecordRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				req.Record.ID = 100
+				created = append(created, req.Record)
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(req.Record)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				ApexNotation:      tt.notation,
+			}
+
+			records, err := p.AppendRecords(context.Background(), "example.com.", []libdns.Record{
+				libdns.Address{Name: "@", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+			})
+			if err != nil {
+				t.Fatalf("AppendRecords() error = %v", err)
+			}
+
+			if len(created) != 1 || created[0].Name != tt.wantName {
+				t.Fatalf("created records = %+v, want one named %q", created, tt.wantName)
+			}
+
+			if len(records) != 1 || records[0].RR().Name != "example.com." {
+				t.Errorf("AppendRecords() = %+v, want the apex record", records)
+			}
+		})
+	}
+
+	p := &Provider{APIToken: "test-token", ApexNotation: "apex"}
+	_, err := p.GetRecords(context.Background(), "example.com")
+	if err == nil {
+		t.Error("GetRecords() error = nil for an invalid apex notation")
+	}
+}
+
+func TestProvider_ApexNotationMatching(t *testing.T) {
+	for _, notation := range []string{ApexNotationAt, ApexNotationZone} {
+		for _, apiApex := range []string{"@", "example.com"} {
+			t.Run(notation+" with API apex "+apiApex, func(t *testing.T) {
+				var methods []string
+				server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					switch {
+					case r.URL.Path == "/dns/zones":
+						w.WriteHeader(http.StatusOK)
+						_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					case r.Method == http.MethodGet:
+						w.WriteHeader(http.StatusOK)
+						_ = json.NewEncoder(w).Encode([]Record{
+							{ID: 1, Name: apiApex, Type: "A", Content: "192.0.2.1", TTL: 3600},
+						})
+					default:
+						methods = append(methods, r.Method)
+						var req RecordRequest
+						_ = json.NewDecoder(r.Body).Decode(&req)
+						req.Record.ID = 1
+						w.WriteHeader(http.StatusOK)
+						_ = json.NewEncoder(w).Encode(req.Record)
+					}
+				}))
+				defer server.Close()
+
+				p := &Provider{
+					APIToken:          "test-token",
+					APIURL:            server.URL,
+					AllowInsecureHTTP: true,
+					ApexNotation:      notation,
+				}
+				ctx := context.Background()
+
+				_, skipped, err := p.AppendIfAbsent(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "@", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+				})
+				if err != nil || len(skipped) != 1 {
+					t.Errorf("AppendIfAbsent() skipped %v, error %v; want the apex record skipped", skipped, err)
+				}
+
+				_, err = p.SetRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "@", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				})
+				if err != nil {
+					t.Errorf("SetRecords() error = %v", err)
+				}
+
+				deleted, err := p.DeleteRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "@", IP: netip.MustParseAddr("192.0.2.1")},
+				})
+				if err != nil || len(deleted) != 1 {
+					t.Errorf("DeleteRecords() deleted %v, error %v; want the apex record deleted", deleted, err)
+				}
+
+				if want := []string{http.MethodPut, http.MethodDelete}; !slices.Equal(methods, want) {
+					t.Errorf("requests %v, want %v", methods, want)
+				}
+			})
+		}
+	}
+}
+
+func TestProvider_AppendIfAbsent(t *testing.T) {
+	var created []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/dns/zones":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 5, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 6, Name: "docs", Type: "CNAME", Content: "Pages.Example.net.", TTL: 3600},
+			})
+		case r.Method == http.MethodPost:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = 100 + len(created)
+			created = append(created, req.Record)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	added, skipped, err := p.AppendIfAbsent(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("AppendIfAbsent() error = %v", err)
+	}
+
+	if len(created) != 1 || created[0].Content != "192.0.2.2" {
+		t.Fatalf("AppendIfAbsent() created %+v, want only the missing record", created)
+	}
+
+	if len(added) != 1 || added[0].RR().Data != "192.0.2.2" {
+		t.Errorf("AppendIfAbsent() created = %+v, want the missing record", added)
+	}
+
+	if len(skipped) != 1 || skipped[0].RR().Data != "192.0.2.1" {
+		t.Fatalf("AppendIfAbsent() skipped = %+v, want the existing record", skipped)
+	}
+	if id, _ := RecordID(skipped[0]); id != 5 {
+		t.Errorf("AppendIfAbsent() skipped record has ID %d, want 5", id)
+	}
+
+	// Nothing is created when every record exists
+	added, skipped, err = p.AppendIfAbsent(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+	})
+	if err != nil || len(added) != 0 || len(skipped) != 1 || len(created) != 1 {
+		t.Errorf("AppendIfAbsent() = %v, %v, %v and created %d records, want only a skipped record", added, skipped, err, len(created))
+	}
+
+	// A target spelled with another case and without the trailing dot is present
+	added, skipped, err = p.AppendIfAbsent(context.Background(), "example.com", []libdns.Record{
+		libdns.CNAME{Name: "docs", TTL: time.Hour, Target: "pages.example.net"},
+	})
+	if err != nil || len(added) != 0 || len(skipped) != 1 || len(created) != 1 {
+		t.Errorf("AppendIfAbsent() = %v, %v, %v and created %d records, want the CNAME skipped", added, skipped, err, len(created))
+	}
+}
+
+func TestProvider_AppendRecordsUnsupportedType(t *testing.T) {
+	want := []string{"A", "AAAA", "CAA", "CNAME", "DNSKEY", "DS", "MX", "NS", "PTR", "SRV", "SSHFP", "TXT"}
+	if got := SupportedRecordTypes(); !slices.Equal(got, want) {
+		t.Errorf("SupportedRecordTypes() = %v, want %v", got, want)
+	}
+
+	var posts int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		posts++
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(Record{ID: posts})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	_, err := p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+		libdns.RR{Name: "www", Type: "TLSA", TTL: time.Hour, Data: "3 1 1 0123456789abcdef"},
+	})
+	if !errors.Is(err, ErrUnsupportedRecordType) {
+		t.Errorf("AppendRecords() error = %v, want ErrUnsupportedRecordType", err)
+	}
+
+	if posts != 0 {
+		t.Errorf("AppendRecords() sent %d creations, want none", posts)
+	}
+}
+
+func TestProvider_AppendRecordsApexCNAME(t *testing.T) {
+	tests := []struct {
+		name     string
+		asAlias  bool
+		wantErr  error
+		wantType string
+	}{
+		{
+			name:    "rejected by default",
+			asAlias: false,
+			wantErr: ErrApexCNAME,
+		},
+		{
+			name:     "rewritten to ALIAS",
+			asAlias:  true,
+			wantType: "ALIAS",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []Record
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else if r.Method == http.MethodPost {
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					req.Record.ID = len(created) + 1
+					created = append(created, req.Record)
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				ApexCNAMEAsAlias:  tt.asAlias,
+			}
+
+			rec := libdns.CNAME{Name: "@", TTL: 3600 * time.Second, Target: "target.example.net."}
+
+			_, err := p.AppendRecords(context.Background(), "example.com.", []libdns.Record{rec})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AppendRecords() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if len(created) != 0 {
+					t.Errorf("AppendRecords() created %d records, want 0", len(created))
+				}
+				return
+			}
+
+			if len(created) != 1 || created[0].Type != tt.wantType {
+				t.Errorf("AppendRecords() created %+v, want one %s record", created, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestProvider_UpdateRecordByID(t *testing.T) {
+	var gotMethod, gotPath string
+	var gotRecord Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		gotMethod = r.Method
+		gotPath = r.URL.Path
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		gotRecord = req.Record
+
+		req.Record.ID = 42
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	rec, err := p.UpdateRecordByID(context.Background(), "example.com", 42,
+		libdns.Address{Name: "www.example.com.", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")})
+	if err != nil {
+		t.Fatalf("UpdateRecordByID() error = %v", err)
+	}
+
+	if gotMethod != http.MethodPut || gotPath != "/dns/zones/1/records/42" {
+		t.Errorf("UpdateRecordByID() sent %s %s, want PUT /dns/zones/1/records/42", gotMethod, gotPath)
+	}
+
+	if gotRecord.Name != "www" || gotRecord.Content != "192.0.2.9" || gotRecord.TTL != 3600 {
+		t.Errorf("UpdateRecordByID() sent %+v", gotRecord)
+	}
+
+	if id, _ := RecordID(rec); id != 42 {
+		t.Errorf("UpdateRecordByID() returned ID %d, want 42", id)
+	}
+
+	_, err = p.UpdateRecordByID(context.Background(), "unknown.com", 42,
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")})
+	if err == nil {
+		t.Error("UpdateRecordByID() error = nil for an unknown zone")
+	}
+}
+
+func TestProvider_RenameRecord(t *testing.T) {
+	existing := Record{ID: 42, Name: "old", Type: "MX", Content: "mail.example.com", TTL: 600, Priority: 10, Comment: "primary"}
+
+	var puts []Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.URL.Path != "/dns/zones/1/records/42" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(existing)
+		case http.MethodPut:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			puts = append(puts, req.Record)
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	rec, err := p.RenameRecord(context.Background(), "example.com", 42, "new.example.com.")
+	if err != nil {
+		t.Fatalf("RenameRecord() error = %v", err)
+	}
+
+	if len(puts) != 1 {
+		t.Fatalf("RenameRecord() sent %d updates, want 1", len(puts))
+	}
+
+	want := existing
+	want.Name = "new"
+	if puts[0] != want {
+		t.Errorf("update payload = %+v, want %+v", puts[0], want)
+	}
+
+	rr := rec.RR()
+	if rr.Name != "new.example.com." || rr.Type != "MX" || rr.Data != "10 mail.example.com" || rr.TTL != 600*time.Second {
+		t.Errorf("RenameRecord() = %+v", rr)
+	}
+
+	if id, _ := RecordID(rec); id != 42 {
+		t.Errorf("RenameRecord() returned ID %d, want 42", id)
+	}
+
+	_, err = p.RenameRecord(context.Background(), "example.com", 7, "new")
+	if err == nil {
+		t.Error("RenameRecord() error = nil for an unknown record")
+	}
+}
+
+func TestProvider_DisableRecord(t *testing.T) {
+	stored := Record{ID: 42, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}
+
+	var puts []map[string]json.RawMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored)
+		case http.MethodPut:
+			var raw struct {
+				Record map[string]json.RawMessage `json:"record"`
+			}
+			body, _ := io.ReadAll(r.Body)
+			_ = json.Unmarshal(body, &raw)
+			puts = append(puts, raw.Record)
+
+			var req RecordRequest
+			_ = json.Unmarshal(body, &req)
+			stored = req.Record
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	steps := []struct {
+		name         string
+		toggle       func(context.Context, string, int) (libdns.Record, error)
+		wantPuts     int
+		wantDisabled bool
+	}{
+		{name: "disable", toggle: p.DisableRecord, wantPuts: 1, wantDisabled: true},
+		{name: "disable again", toggle: p.DisableRecord, wantPuts: 1, wantDisabled: true},
+		{name: "enable", toggle: p.EnableRecord, wantPuts: 2, wantDisabled: false},
+	}
+
+	for _, step := range steps {
+		rec, err := step.toggle(context.Background(), "example.com", 42)
+		if err != nil {
+			t.Fatalf("%s: error = %v", step.name, err)
+		}
+
+		if len(puts) != step.wantPuts {
+			t.Fatalf("%s: sent %d updates, want %d", step.name, len(puts), step.wantPuts)
+		}
+
+		// Enabling must send the flag explicitly, an omitted field would leave the record disabled
+		want := strconv.FormatBool(step.wantDisabled)
+		if got := string(puts[len(puts)-1]["disabled"]); got != want {
+			t.Errorf("%s: update payload disabled = %q, want %q", step.name, got, want)
+		}
+
+		if got := string(puts[len(puts)-1]["content"]); got != `"192.0.2.1"` {
+			t.Errorf("%s: update payload content = %s, want the record unchanged", step.name, got)
+		}
+
+		if pd, _ := providerData(rec); pd.Disabled != step.wantDisabled {
+			t.Errorf("%s: returned Disabled = %v, want %v", step.name, pd.Disabled, step.wantDisabled)
+		}
+	}
+}
+
+func TestProvider_SetRecords(t *testing.T) {
+	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
+		rr := libdns.RR{
+			Name: name,
+			Type: typ,
+			Data: data,
+			TTL:  ttl,
+		}
+		rec, _ := rr.Parse()
+		return rec
+	}
+
+	tests := []struct {
+		name            string
+		zoneName        string
+		zones           []Zone
+		existingRecords []Record
+		newRecords      []libdns.Record
+		wantErr         bool
+		wantCount       int
+		wantDeletes     int // expected number of delete calls
+	}{
+		{
+			name:     "set replaces existing record",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			newRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
+			},
+			wantErr:     false,
+			wantCount:   1,
+			wantDeletes: 0,
+		},
+		{
+			name:     "set deletes extra existing records",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+				{ID: 3, Name: "www", Type: "A", Content: "192.0.2.3", TTL: 3600},
+			},
+			newRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
+			},
+			wantErr:     false,
+			wantCount:   1,
+			wantDeletes: 2, // should delete 2 extra records
+		},
+		{
+			name:     "set creates new records when fewer exist",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			newRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
+				makeRecord("www", "A", "192.0.2.101", 7200*time.Second),
+				makeRecord("www", "A", "192.0.2.102", 7200*time.Second),
+			},
+			wantErr:     false,
+			wantCount:   3,
+			wantDeletes: 0,
+		},
+		{
+			name:     "set with empty data clears the (name, type)",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			existingRecords: []Record{
+				{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token-a", TTL: 300},
+				{ID: 2, Name: "_acme-challenge", Type: "TXT", Content: "token-b", TTL: 300},
+				{ID: 3, Name: "www", Type: "TXT", Content: "keep-me", TTL: 300},
+			},
+			newRecords: []libdns.Record{
+				libdns.TXT{Name: "_acme-challenge"},
+			},
+			wantErr:     false,
+			wantCount:   0,
+			wantDeletes: 2,
+		},
+		{
+			name:     "set creates record when none exist",
+			zoneName: "example.com",
+			zones: []Zone{
+				{ID: 1, Name: "example.com"},
+			},
+			existingRecords: []Record{},
+			newRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
+			},
+			wantErr:     false,
+			wantCount:   1,
+			wantDeletes: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recordID := 100
+			deleteCount := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(tt.zones)
+				} else if r.Method == http.MethodGet {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(tt.existingRecords)
+				} else if r.Method == http.MethodDelete {
+					deleteCount++
+					w.WriteHeader(http.StatusNoContent)
+				} else if r.Method == http.MethodPut {
+					// Handle update - extract record ID from path and return updated record
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					// Extract record ID from path (e.g., /dns/zones/1/records/1)
+					parts := strings.Split(r.URL.Path, "/")
+					if len(parts) >= 5 {
+						id, _ := strconv.Atoi(parts[len(parts)-1])
+						req.Record.ID = id
+					}
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				} else if r.Method == http.MethodPost {
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					req.Record.ID = recordID
+					recordID++
+					w.WriteHeader(http.StatusCreated)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.SetRecords(context.Background(), tt.zoneName, tt.newRecords)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("SetRecords() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr && len(records) != tt.wantCount {
+				t.Errorf("SetRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+
+			if deleteCount != tt.wantDeletes {
+				t.Errorf("SetRecords() made %d delete calls, want %d", deleteCount, tt.wantDeletes)
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsEmpty(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	for _, input := range [][]libdns.Record{nil, {}} {
+		records, err := p.SetRecords(context.Background(), "example.com", input)
+		if err != nil {
+			t.Fatalf("SetRecords() error = %v", err)
+		}
+
+		if records == nil || len(records) != 0 {
+			t.Errorf("SetRecords() = %#v, want an empty slice", records)
+		}
+	}
+
+	if requests != 0 {
+		t.Errorf("SetRecords() made %d API calls for empty input, want none", requests)
+	}
+}
+
+func TestProvider_SetRecordsTXT(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token-a", TTL: 300},
+		{ID: 2, Name: "_acme-challenge", Type: "TXT", Content: "token-b", TTL: 300},
+	}
+
+	calls := make(map[string]int)
+	var deletedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		calls[r.Method]++
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(existingRecords)
+		case http.MethodPost:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = 3
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodDelete:
+			deletedPath = r.URL.Path
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	// token-a stays, token-b goes away and token-c is added
+	records, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", TTL: 300 * time.Second, Text: "token-c"},
+		libdns.TXT{Name: "_acme-challenge", TTL: 300 * time.Second, Text: "token-a"},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Errorf("SetRecords() returned %d records, want 2", len(records))
+	}
+
+	if calls[http.MethodPost] != 1 || calls[http.MethodDelete] != 1 || calls[http.MethodPut] != 0 {
+		t.Errorf("SetRecords() made %d creates, %d deletes and %d updates, want 1, 1 and 0",
+			calls[http.MethodPost], calls[http.MethodDelete], calls[http.MethodPut])
+	}
+
+	if deletedPath != "/dns/zones/1/records/2" {
+		t.Errorf("SetRecords() deleted %s, want /dns/zones/1/records/2", deletedPath)
+	}
+}
+
+func TestProvider_SetRecordsEquivalentTXT(t *testing.T) {
+	calls := make(map[string]int)
+	var updatedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		calls[r.Method]++
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token-b", TTL: 300},
+				{ID: 2, Name: "_acme-challenge", Type: "TXT", Content: `"token-a"`, TTL: 300},
+			})
+		case http.MethodPut:
+			updatedPath = r.URL.Path
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	// The quoted token-a is the same value: it keeps its record and loses its quotes
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", TTL: 300 * time.Second, Text: "token-b"},
+		libdns.TXT{Name: "_acme-challenge", TTL: 300 * time.Second, Text: "token-a"},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	if calls[http.MethodPost] != 0 || calls[http.MethodDelete] != 0 || calls[http.MethodPut] != 1 {
+		t.Errorf("SetRecords() made %d creates, %d deletes and %d updates, want 0, 0 and 1",
+			calls[http.MethodPost], calls[http.MethodDelete], calls[http.MethodPut])
+	}
+	if updatedPath != "/dns/zones/1/records/2" {
+		t.Errorf("SetRecords() updated %s, want /dns/zones/1/records/2", updatedPath)
+	}
+}
+
+func TestProvider_ReplaceZone(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "@", Type: "SOA", Content: "ns1.example.net. hostmaster.example.com. 1 7200 3600 1209600 3600", TTL: 3600},
+		{ID: 2, Name: "@", Type: "NS", Content: "ns1.example.net", TTL: 3600},
+		{ID: 3, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 4, Name: "mail", Type: "A", Content: "192.0.2.2", TTL: 3600},
+	}
+
+	tests := []struct {
+		name        string
+		records     []libdns.Record
+		wantCreated int
+		wantUpdated []string
+		wantDeleted []string
+	}{
+		{
+			name: "add only",
+			records: []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+				libdns.Address{Name: "mail", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				libdns.Address{Name: "ftp", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.3")},
+			},
+			wantCreated: 1,
+		},
+		{
+			name: "delete only",
+			records: []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+			},
+			wantDeleted: []string{"/dns/zones/1/records/4"},
+		},
+		{
+			name: "mixed",
+			records: []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+				libdns.TXT{Name: "@", TTL: time.Hour, Text: "v=spf1 -all"},
+			},
+			wantCreated: 1,
+			wantUpdated: []string{"/dns/zones/1/records/3"},
+			wantDeleted: []string{"/dns/zones/1/records/4"},
+		},
+		{
+			name: "apex NS given explicitly",
+			records: []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+				libdns.Address{Name: "mail", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				libdns.NS{Name: "@", TTL: time.Hour, Target: "ns2.example.net"},
+			},
+			wantUpdated: []string{"/dns/zones/1/records/2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created int
+			var updated, deleted []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				switch r.Method {
+				case http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(existingRecords)
+				case http.MethodPost, http.MethodPut:
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					if r.Method == http.MethodPost {
+						created++
+						req.Record.ID = 100 + created
+					} else {
+						updated = append(updated, r.URL.Path)
+					}
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				case http.MethodDelete:
+					deleted = append(deleted, r.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.ReplaceZone(context.Background(), "example.com", tt.records)
+			if err != nil {
+				t.Fatalf("ReplaceZone() error = %v", err)
+			}
+
+			if len(records) != len(tt.records) {
+				t.Errorf("ReplaceZone() returned %d records, want %d", len(records), len(tt.records))
+			}
+
+			if created != tt.wantCreated {
+				t.Errorf("ReplaceZone() created %d records, want %d", created, tt.wantCreated)
+			}
+
+			if !slices.Equal(updated, tt.wantUpdated) {
+				t.Errorf("ReplaceZone() updated %v, want %v", updated, tt.wantUpdated)
+			}
+
+			if !slices.Equal(deleted, tt.wantDeleted) {
+				t.Errorf("ReplaceZone() deleted %v, want %v", deleted, tt.wantDeleted)
+			}
+		})
+	}
+}
+
+func TestProvider_ReplaceZoneSOA(t *testing.T) {
+	var writes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writes++
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "@", Type: "SOA", Content: "ns1.example.net. hostmaster.example.com. 1 7200 3600 1209600 3600", TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	for _, data := range []string{"ns2.example.net. hostmaster.example.com. 2 7200 3600 1209600 3600", ""} {
+		_, err := p.ReplaceZone(context.Background(), "example.com", []libdns.Record{
+			libdns.RR{Name: "@", Type: "SOA", TTL: time.Hour, Data: data},
+		})
+		if !errors.Is(err, ErrUnsupportedRecordType) {
+			t.Errorf("ReplaceZone() with SOA data %q error = %v, want ErrUnsupportedRecordType", data, err)
+		}
+	}
+
+	if writes != 0 {
+		t.Errorf("ReplaceZone() made %d write requests, want none", writes)
+	}
+}
+
+func TestProvider_SetRecordsCaseInsensitive(t *testing.T) {
+	calls := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		calls[r.Method]++
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "WWW", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			})
+		default:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = 1
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	if calls[http.MethodPut] != 1 || calls[http.MethodPost] != 0 || calls[http.MethodDelete] != 0 {
+		t.Errorf("SetRecords() made %d updates, %d creates and %d deletes, want 1, 0 and 0",
+			calls[http.MethodPut], calls[http.MethodPost], calls[http.MethodDelete])
+	}
+}
+
+func TestProvider_UpdateRecordByIDComment(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      libdns.Record
+		wantComment string
+	}{
+		{
+			name:        "comment kept",
+			record:      libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+			wantComment: "primary",
+		},
+		{
+			name:        "comment replaced",
+			record:      WithOptions(libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")}, RecordOptions{Comment: "secondary"}),
+			wantComment: "secondary",
+		},
+		{
+			name:        "comment cleared",
+			record:      WithOptions(libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")}, RecordOptions{ClearComment: true}),
+			wantComment: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent map[string]map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				existing := Record{ID: 7, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600, Comment: "primary"}
+				if r.Method == http.MethodPut {
+					_ = json.NewDecoder(r.Body).Decode(&sent)
+					existing.Content = "192.0.2.2"
+				}
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(existing)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			_, err := p.UpdateRecordByID(context.Background(), "example.com", 7, tt.record)
+			if err != nil {
+				t.Fatalf("UpdateRecordByID() error = %v", err)
+			}
+
+			comment, ok := sent["record"]["comment"]
+			if !ok || comment != tt.wantComment {
+				t.Errorf("update payload comment = %v (sent %v), want %q", comment, ok, tt.wantComment)
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsComments(t *testing.T) {
+	tests := []struct {
+		name        string
+		record      libdns.Record
+		wantUpdate  bool
+		wantComment string
+	}{
+		{
+			name:        "comment kept on content change",
+			record:      libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+			wantUpdate:  true,
+			wantComment: "managed by cert-manager",
+		},
+		{
+			name:        "new comment replaces the old one",
+			record:      WithOptions(libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}, RecordOptions{Comment: "managed by terraform"}),
+			wantUpdate:  true,
+			wantComment: "managed by terraform",
+		},
+		{
+			name:        "comment cleared on request",
+			record:      WithOptions(libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}, RecordOptions{ClearComment: true}),
+			wantUpdate:  true,
+			wantComment: "",
+		},
+		{
+			name:       "no comment and same data changes nothing",
+			record:     libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")},
+			wantUpdate: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updates []Record
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				switch r.Method {
+				case http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600, Comment: "managed by cert-manager"},
+					})
+				case http.MethodPut:
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					updates = append(updates, req.Record)
+					req.Record.ID = 1
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			records, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{tt.record})
+			if err != nil {
+				t.Fatalf("SetRecords() error = %v", err)
+			}
+
+			if (len(updates) == 1) != tt.wantUpdate {
+				t.Fatalf("SetRecords() made %d updates, want update = %v", len(updates), tt.wantUpdate)
+			}
+			if !tt.wantUpdate {
+				return
+			}
+
+			if updates[0].Comment != tt.wantComment {
+				t.Errorf("update payload comment = %q, want %q", updates[0].Comment, tt.wantComment)
+			}
+
+			if pd, _ := providerData(records[0]); pd.Comment != tt.wantComment {
+				t.Errorf("returned comment = %q, want %q", pd.Comment, tt.wantComment)
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsMultiZone(t *testing.T) {
+	var mu sync.Mutex
+	stored := map[string][]Record{
+		"1": {{ID: 10, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}},
+		"2": nil,
+	}
+	nextID := 100
+	zoneLookups := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/dns/zones" {
+			zoneLookups++
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{
+				{ID: 1, Name: "example.com"},
 				{ID: 2, Name: "example.org"},
+			})
+			return
+		}
+
+		// /dns/zones/{zone}/records[/{id}]
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/dns/zones/"), "/")
+		zone := parts[0]
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored[zone])
+		case http.MethodPost:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = nextID
+			nextID++
+			stored[zone] = append(stored[zone], req.Record)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodPut:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			id, _ := strconv.Atoi(path.Base(r.URL.Path))
+			for i := range stored[zone] {
+				if stored[zone][i].ID == id {
+					req.Record.ID = id
+					stored[zone][i] = req.Record
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	set, err := p.SetRecordsMultiZone(context.Background(), map[string][]libdns.Record{
+		"example.com.": {libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")}},
+		"example.org.": {libdns.TXT{Name: "mail", TTL: time.Hour, Text: "v=spf1 -all"}},
+		"example.net.": {libdns.TXT{Name: "www", TTL: time.Hour, Text: "lost"}},
+	})
+	if !errors.Is(err, ErrZoneNotFound) || !strings.Contains(err.Error(), "example.net.") {
+		t.Errorf("SetRecordsMultiZone() error = %v, want ErrZoneNotFound for example.net.", err)
+	}
+
+	if zoneLookups != 1 {
+		t.Errorf("zones were listed %d times, want once", zoneLookups)
+	}
+
+	if len(set) != 2 {
+		t.Fatalf("SetRecordsMultiZone() returned %d zones, want 2: %v", len(set), set)
+	}
+
+	com := set["example.com."]
+	if len(com) != 1 || com[0].RR().Name != "www.example.com." || com[0].RR().Data != "192.0.2.2" {
+		t.Errorf("SetRecordsMultiZone()[example.com.] = %+v", com)
+	}
+	if recs := stored["1"]; len(recs) != 1 || recs[0].ID != 10 || recs[0].Content != "192.0.2.2" {
+		t.Errorf("example.com records = %+v, want record 10 updated in place", recs)
+	}
+
+	org := set["example.org."]
+	if len(org) != 1 || org[0].RR().Name != "mail.example.org." || org[0].RR().Type != "TXT" {
+		t.Errorf("SetRecordsMultiZone()[example.org.] = %+v", org)
+	}
+	if recs := stored["2"]; len(recs) != 1 || recs[0].Name != "mail" || recs[0].Content != "v=spf1 -all" {
+		t.Errorf("example.org records = %+v, want the created mail TXT record", recs)
+	}
+}
+
+func TestProvider_ProtectedRecords(t *testing.T) {
+	var mu sync.Mutex
+	var stored []Record
+	var deletedIDs []int
+	var writes int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writes++
+		}
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored)
+		case http.MethodDelete:
+			id, _ := strconv.Atoi(path.Base(r.URL.Path))
+			deletedIDs = append(deletedIDs, id)
+			stored = slices.DeleteFunc(stored, func(rec Record) bool { return rec.ID == id })
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	reset := func() {
+		stored = []Record{
+			{ID: 1, Name: "@", Type: "MX", Content: "mail.example.com", Priority: 10, TTL: 3600},
+			{ID: 2, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			{ID: 3, Name: "_dmarc", Type: "TXT", Content: "v=DMARC1; p=none", TTL: 3600},
+		}
+		deletedIDs = nil
+		writes = 0
+	}
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		ProtectedRecords: []ProtectedRecord{
+			{Name: "example.com.", Type: "mx"},
+			{Name: "_DMARC*"},
+		},
+	}
+
+	t.Run("DeleteRecords keeps protected records", func(t *testing.T) {
+		reset()
+
+		deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+			libdns.MX{Name: "@", Preference: 10, Target: "mail.example.com."},
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		})
+		if !errors.Is(err, ErrProtectedRecord) || !strings.Contains(err.Error(), "@ MX") {
+			t.Errorf("DeleteRecords() error = %v, want ErrProtectedRecord naming the apex MX", err)
+		}
+
+		if len(deleted) != 1 || deleted[0].RR().Name != "www.example.com." {
+			t.Errorf("DeleteRecords() = %+v, want only www deleted", deleted)
+		}
+		if !slices.Equal(deletedIDs, []int{2}) {
+			t.Errorf("deleted record IDs = %v, want [2]", deletedIDs)
+		}
+	})
+
+	t.Run("DeleteRecords proceeds without protected records", func(t *testing.T) {
+		reset()
+
+		deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+		})
+		if err != nil {
+			t.Fatalf("DeleteRecords() error = %v", err)
+		}
+		if len(deleted) != 1 || !slices.Equal(deletedIDs, []int{2}) {
+			t.Errorf("DeleteRecords() = %+v, deleted IDs %v, want www deleted", deleted, deletedIDs)
+		}
+	})
+
+	t.Run("SetRecords refuses to clear protected records", func(t *testing.T) {
+		reset()
+
+		_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+			libdns.TXT{Name: "_dmarc"},
+		})
+		if !errors.Is(err, ErrProtectedRecord) {
+			t.Errorf("SetRecords() error = %v, want ErrProtectedRecord", err)
+		}
+		if len(deletedIDs) != 0 || len(stored) != 3 {
+			t.Errorf("SetRecords() deleted %v, want no deletion", deletedIDs)
+		}
+	})
+
+	t.Run("ReplaceZone refuses before any change", func(t *testing.T) {
+		reset()
+
+		_, err := p.ReplaceZone(context.Background(), "example.com", []libdns.Record{
+			libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")},
+			libdns.Address{Name: "api", IP: netip.MustParseAddr("192.0.2.3")},
+		})
+		if !errors.Is(err, ErrProtectedRecord) {
+			t.Errorf("ReplaceZone() error = %v, want ErrProtectedRecord", err)
+		}
+		if writes != 0 {
+			t.Errorf("ReplaceZone() made %d write requests, want none", writes)
+		}
+	})
+
+	t.Run("DeleteAllRecords skips protected records", func(t *testing.T) {
+		reset()
+
+		_, err := p.DeleteAllRecords(context.Background(), "example.com")
+		if err != nil {
+			t.Fatalf("DeleteAllRecords() error = %v", err)
+		}
+		if !slices.Equal(deletedIDs, []int{2}) {
+			t.Errorf("deleted record IDs = %v, want [2]", deletedIDs)
+		}
+	})
+}
+
+func TestProvider_WriteErrorContext(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/dns/zones":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 10, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_, _ = w.Write([]byte(`{"error":"internal error"}`))
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	tests := []struct {
+		name       string
+		call       func(ctx context.Context) error
+		wantRecord string
+	}{
+		{
+			name: "AppendRecords create",
+			call: func(ctx context.Context) error {
+				_, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "api", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+				})
+				return err
+			},
+			wantRecord: `api A "192.0.2.9"`,
+		},
+		{
+			name: "AppendRecords several creates",
+			call: func(ctx context.Context) error {
+				_, err := p.AppendRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "api", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+					libdns.TXT{Name: "api", TTL: time.Hour, Text: "owner=ops"},
+				})
+				return err
+			},
+			wantRecord: `api TXT "owner=ops"`,
+		},
+		{
+			name: "SetRecords create",
+			call: func(ctx context.Context) error {
+				_, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+					libdns.TXT{Name: "api", TTL: time.Hour, Text: "owner=ops"},
+				})
+				return err
+			},
+			wantRecord: `api TXT "owner=ops"`,
+		},
+		{
+			name: "SetRecords update",
+			call: func(ctx context.Context) error {
+				_, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				})
+				return err
+			},
+			wantRecord: `record 10 (www A "192.0.2.1")`,
+		},
+		{
+			name: "DeleteRecords",
+			call: func(ctx context.Context) error {
+				_, err := p.DeleteRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+				})
+				return err
+			},
+			wantRecord: `record 10 (www A "192.0.2.1")`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(context.Background())
+			if err == nil {
+				t.Fatal("error = nil, want the failure of the write")
+			}
+
+			for _, want := range []string{tt.wantRecord, "zone example.com"} {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want it to contain %s", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsRoundRobin(t *testing.T) {
+	var mu sync.Mutex
+	stored := []Record{
+		{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+		{ID: 3, Name: "www", Type: "A", Content: "192.0.2.3", TTL: 3600},
+	}
+	var writes []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored)
+			return
+		}
+
+		writes = append(writes, r.Method+" "+path.Base(r.URL.Path))
+		if r.Method != http.MethodPut {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		id, _ := strconv.Atoi(path.Base(r.URL.Path))
+		req.Record.ID = id
+		for i := range stored {
+			if stored[i].ID == id {
+				stored[i] = req.Record
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(req.Record)
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	// The first address is the one that changes, so pairing by position would
+	// rewrite all three records
+	set, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.3")},
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	if !slices.Equal(writes, []string{"PUT 1"}) {
+		t.Errorf("SetRecords() made requests %v, want a single update of record 1", writes)
+	}
+
+	var gotIDs []int
+	for _, rec := range set {
+		id, _ := RecordID(rec)
+		gotIDs = append(gotIDs, id)
+	}
+	if !slices.Equal(gotIDs, []int{3, 1, 2}) {
+		t.Errorf("SetRecords() returned record IDs %v, want [3 1 2]", gotIDs)
+	}
+
+	if stored[0].Content != "192.0.2.9" {
+		t.Errorf("record 1 = %+v, want it updated to 192.0.2.9", stored[0])
+	}
+}
+
+func TestProvider_SetRecordsETag(t *testing.T) {
+	tests := []struct {
+		name        string
+		currentETag string
+		wantErr     error
+	}{
+		{name: "unchanged record", currentETag: `"v1"`},
+		{name: "record changed since listed", currentETag: `"v2"`, wantErr: ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotIfMatch string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/dns/zones":
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				case r.Method == http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_, _ = w.Write([]byte(`[{"id":1,"name":"www","type":"A","content":"192.0.2.1","ttl":3600,"etag":"\"v1\""}]`))
+				case r.Method == http.MethodPut:
+					gotIfMatch = r.Header.Get("If-Match")
+					if gotIfMatch != tt.currentETag {
+						w.WriteHeader(http.StatusPreconditionFailed)
+						return
+					}
+
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					req.Record.ID = 1
+					w.Header().Set("ETag", `"v3"`)
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				default:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("SetRecords() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if gotIfMatch != `"v1"` {
+				t.Errorf("If-Match = %q, want the ETag of the listed record", gotIfMatch)
+			}
+		})
+	}
+}
+
+func TestProvider_UpdateKeepsDisabled(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(ctx context.Context, p *Provider) error
+	}{
+		{
+			name: "SetRecords",
+			update: func(ctx context.Context, p *Provider) error {
+				_, err := p.SetRecords(ctx, "example.com", []libdns.Record{
+					libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				})
+				return err
 			},
-			wantID:  1,
-			wantErr: false,
 		},
 		{
-			name:     "zone not found",
-			zoneName: "notfound.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-				{ID: 2, Name: "example.org"},
+			name: "UpdateRecordByID",
+			update: func(ctx context.Context, p *Provider) error {
+				_, err := p.UpdateRecordByID(ctx, "example.com", 7,
+					libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")})
+				return err
 			},
-			wantID:  0,
-			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			disabled := Record{ID: 7, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600, Disabled: true}
+
+			var gotPut map[string]map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/dns/zones":
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				case r.Method == http.MethodGet && r.URL.Path == "/dns/zones/1/records/7":
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(disabled)
+				case r.Method == http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{disabled})
+				case r.Method == http.MethodPut:
+					body, _ := io.ReadAll(r.Body)
+					_ = json.Unmarshal(body, &gotPut)
+
+					var req RecordRequest
+					_ = json.Unmarshal(body, &req)
+					req.Record.ID = 7
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				default:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				IncludeDisabled:   true,
+			}
+
+			err := tt.update(context.Background(), p)
+			if err != nil {
+				t.Fatalf("update error = %v", err)
+			}
+
+			if got := gotPut["record"]["disabled"]; got != true {
+				t.Errorf("update sent disabled = %v, want true", got)
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsOptionsChange(t *testing.T) {
+	www := libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.1")}
+
+	tests := []struct {
+		name      string
+		input     libdns.Record
+		wantPuts  int
+		wantFlags map[string]any
+	}{
+		{
+			name:  "same data without options",
+			input: www,
 		},
 		{
-			name:     "empty zones list",
-			zoneName: "example.com",
-			zones:    []Zone{},
-			wantID:   0,
-			wantErr:  true,
+			name:  "same data and options",
+			input: WithOptions(www, RecordOptions{}),
+		},
+		{
+			name:      "proxied turned on",
+			input:     WithOptions(www, RecordOptions{Proxied: true}),
+			wantPuts:  1,
+			wantFlags: map[string]any{"proxied": true, "disabled": false},
+		},
+		{
+			name:      "disabled through options",
+			input:     WithOptions(www, RecordOptions{Disabled: true}),
+			wantPuts:  1,
+			wantFlags: map[string]any{"proxied": false, "disabled": true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var puts []map[string]map[string]any
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.URL.Path == "/dns/zones":
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				case r.Method == http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}})
+				case r.Method == http.MethodPut:
+					body, _ := io.ReadAll(r.Body)
+					var put map[string]map[string]any
+					_ = json.Unmarshal(body, &put)
+					puts = append(puts, put)
+
+					var req RecordRequest
+					_ = json.Unmarshal(body, &req)
+					req.Record.ID = 1
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				default:
+					w.WriteHeader(http.StatusMethodNotAllowed)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+			}
+
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{tt.input})
+			if err != nil {
+				t.Fatalf("SetRecords() error = %v", err)
+			}
+
+			if len(puts) != tt.wantPuts {
+				t.Fatalf("SetRecords() sent %d updates, want %d", len(puts), tt.wantPuts)
+			}
+
+			for flag, want := range tt.wantFlags {
+				if got := puts[0]["record"][flag]; got != want {
+					t.Errorf("update sent %s = %v, want %v", flag, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestProvider_SetRecordsConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	var stored []Record
+	nextID := 1
+	inFlight, maxInFlight := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		// Give concurrent operations the chance to interleave
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		inFlight--
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(stored)
+		case http.MethodPost:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = nextID
+			nextID++
+			stored = append(stored, req.Record)
+			w.WriteHeader(http.StatusCreated)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodPut:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			id, _ := strconv.Atoi(path.Base(r.URL.Path))
+			for i := range stored {
+				if stored[i].ID == id {
+					req.Record.ID = id
+					stored[i] = req.Record
+				}
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodDelete:
+			id, _ := strconv.Atoi(path.Base(r.URL.Path))
+			stored = slices.DeleteFunc(stored, func(rec Record) bool { return rec.ID == id })
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := range 8 {
+		wg.Go(func() {
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.TXT{Name: "www", TTL: time.Hour, Text: fmt.Sprintf("value-%d", i)},
+			})
+			errs <- err
+		})
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("SetRecords() error = %v", err)
+		}
+	}
+
+	if maxInFlight != 1 {
+		t.Errorf("%d record requests were in flight at once, want 1", maxInFlight)
+	}
+
+	if len(stored) != 1 || stored[0].Name != "www" || stored[0].Type != "TXT" {
+		t.Errorf("zone records after concurrent SetRecords = %+v, want one www TXT record", stored)
+	}
+}
+
+func TestProvider_LockZone(t *testing.T) {
+	var writes int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		if r.Method != http.MethodGet {
+			writes++
+		}
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(Record{ID: 7, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	unlock, err := p.lockZone(context.Background(), "Example.com.")
+	if err != nil {
+		t.Fatalf("lockZone() error = %v", err)
+	}
+
+	// Every write path waits for the lock, and gives up once its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	writers := map[string]func() error{
+		"UpdateRecordByID": func() error {
+			_, err := p.UpdateRecordByID(ctx, "example.com", 7, libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.2")})
+			return err
+		},
+		"RenameRecord": func() error {
+			_, err := p.RenameRecord(ctx, "example.com", 7, "web")
+			return err
+		},
+		"DisableRecord": func() error {
+			_, err := p.DisableRecord(ctx, "example.com", 7)
+			return err
+		},
+	}
+	for name, write := range writers {
+		if err := write(); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("%s() error = %v while the zone is locked, want context.DeadlineExceeded", name, err)
+		}
+	}
+	if writes != 0 {
+		t.Errorf("%d writes were made while the zone was locked", writes)
+	}
+
+	unlock()
+
+	// Unused locks are forgotten
+	p.zoneLocksMu.Lock()
+	n := len(p.zoneLocks)
+	p.zoneLocksMu.Unlock()
+	if n != 0 {
+		t.Errorf("%d zone locks are kept after every call returned, want 0", n)
+	}
+
+	_, err = p.DisableRecord(context.Background(), "example.com", 7)
+	if err != nil {
+		t.Errorf("DisableRecord() error = %v once the zone is unlocked", err)
+	}
+}
+
+func TestProvider_SetRecordsRetryBudget(t *testing.T) {
+	defer func(d time.Duration) { retryBaseDelay = d }(retryBaseDelay)
+	retryBaseDelay = time.Millisecond
+
+	tests := []struct {
+		name      string
+		budget    int
+		flaky     bool
+		wantPuts  int
+		wantError bool
+	}{
+		{
+			name:      "no budget makes no retries",
+			budget:    0,
+			wantPuts:  1,
+			wantError: true,
+		},
+		{
+			name:      "failing batch stops once the budget is spent",
+			budget:    3,
+			wantPuts:  4,
+			wantError: true,
+		},
+		{
+			name:     "budget shared by every update of the batch",
+			budget:   3,
+			flaky:    true,
+			wantPuts: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			puts := map[string]int{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				switch r.Method {
+				case http.MethodGet:
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "a", Type: "A", Content: "192.0.2.1", TTL: 3600},
+						{ID: 2, Name: "b", Type: "A", Content: "192.0.2.1", TTL: 3600},
+						{ID: 3, Name: "c", Type: "A", Content: "192.0.2.1", TTL: 3600},
+					})
+				case http.MethodPut:
+					mu.Lock()
+					puts[r.URL.Path]++
+					attempt := puts[r.URL.Path]
+					mu.Unlock()
+
+					// A flaky API fails the first attempt of every update
+					if !tt.flaky || attempt == 1 {
+						w.WriteHeader(http.StatusServiceUnavailable)
+						return
+					}
+
+					var req RecordRequest
+					_ = json.NewDecoder(r.Body).Decode(&req)
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode(req.Record)
+				}
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				RetryBudget:       tt.budget,
+			}
+
+			_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.Address{Name: "a", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				libdns.Address{Name: "b", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+				libdns.Address{Name: "c", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.2")},
+			})
+			if (err != nil) != tt.wantError {
+				t.Fatalf("SetRecords() error = %v, wantError %v", err, tt.wantError)
+			}
+
+			total := 0
+			for _, n := range puts {
+				total += n
+			}
+
+			if total != tt.wantPuts {
+				t.Errorf("SetRecords() sent %d updates, want %d", total, tt.wantPuts)
+			}
+
+			if retries := total - len(puts); retries > tt.budget {
+				t.Errorf("SetRecords() retried %d times, budget is %d", retries, tt.budget)
+			}
+		})
+	}
+}
+
+// countingMetrics is a Metrics sink recording the counters it receives.
+type countingMetrics struct {
+	mu       sync.Mutex
+	counters map[string]int
+}
+
+func (m *countingMetrics) Add(name string, delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.counters == nil {
+		m.counters = map[string]int{}
+	}
+	m.counters[name] += delta
+}
+
+func TestProvider_SetRecordsMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+				{ID: 3, Name: "mail", Type: "A", Content: "192.0.2.5", TTL: 3600},
+			})
+		case http.MethodPost, http.MethodPut:
+			if strings.HasSuffix(r.URL.Path, "/99") {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			req.Record.ID = 10
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	metrics := &countingMetrics{}
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		Metrics:           metrics,
+	}
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.3")},
+		libdns.Address{Name: "api", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	want := map[string]int{
+		MetricRecordsCreated: 1,
+		MetricRecordsUpdated: 1,
+		MetricRecordsDeleted: 1,
+	}
+	if !maps.Equal(metrics.counters, want) {
+		t.Errorf("counters after SetRecords() = %v, want %v", metrics.counters, want)
+	}
+
+	_, err = p.UpdateRecordByID(context.Background(), "example.com", 99,
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.3")})
+	if err == nil {
+		t.Fatal("UpdateRecordByID() error = nil for a missing record")
+	}
+
+	want[MetricAPIErrors] = 1
+	if !maps.Equal(metrics.counters, want) {
+		t.Errorf("counters after a failed update = %v, want %v", metrics.counters, want)
+	}
+}
+
+func TestProvider_OnChange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/dns/zones":
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		case r.Method == http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+				{ID: 3, Name: "mail", Type: "A", Content: "192.0.2.25", TTL: 3600},
+			})
+		case r.Method == http.MethodPost, r.Method == http.MethodPut:
+			var req RecordRequest
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			if req.Record.ID == 0 {
+				req.Record.ID = 100
+			}
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	var events []string
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		OnChange: func(event ChangeEvent) {
+			rr := event.Record.RR()
+			events = append(events, fmt.Sprintf("%s %s %s %s %s", event.Op, event.Zone, rr.Name, rr.Type, rr.Data))
 		},
 	}
 
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				w.WriteHeader(http.StatusOK)
-				_ = json.NewEncoder(w).Encode(tt.zones)
-			}))
-			defer server.Close()
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "www", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.9")},
+		libdns.TXT{Name: "new", TTL: time.Hour, Text: "hello"},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+
+	slices.Sort(events)
+	want := []string{
+		"create example.com new.example.com. TXT hello",
+		"delete example.com www.example.com. A 192.0.2.2",
+		"update example.com www.example.com. A 192.0.2.9",
+	}
+	if !slices.Equal(events, want) {
+		t.Errorf("OnChange events =\n%v\nwant\n%v", events, want)
+	}
+
+	// Unchanged records are not reported
+	events = nil
+	_, err = p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "mail", TTL: time.Hour, IP: netip.MustParseAddr("192.0.2.25")},
+	})
+	if err != nil {
+		t.Fatalf("SetRecords() error = %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("OnChange events = %v for an unchanged record, want none", events)
+	}
+
+	_, err = p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.Address{Name: "mail", IP: netip.MustParseAddr("192.0.2.25")},
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecords() error = %v", err)
+	}
+	if !slices.Equal(events, []string{"delete example.com mail.example.com. A 192.0.2.25"}) {
+		t.Errorf("OnChange events = %v after DeleteRecords", events)
+	}
+
+	// Without a hook nothing is reported, and nothing fails
+	p.OnChange = nil
+	_, err = p.AppendRecords(context.Background(), "example.com", []libdns.Record{
+		libdns.TXT{Name: "other", TTL: time.Hour, Text: "hi"},
+	})
+	if err != nil {
+		t.Fatalf("AppendRecords() error = %v", err)
+	}
+}
+
+func TestProvider_SetRecordsRollback(t *testing.T) {
+	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
+		rr := libdns.RR{
+			Name: name,
+			Type: typ,
+			Data: data,
+			TTL:  ttl,
+		}
+		rec, _ := rr.Parse()
+		return rec
+	}
+
+	original := map[int]Record{
+		1: {ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		2: {ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+		3: {ID: 3, Name: "mail", Type: "A", Content: "192.0.2.3", TTL: 3600},
+	}
+	state := make(map[int]Record)
+	for id, rec := range original {
+		state[id] = rec
+	}
 
-			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   server.URL,
-			}
+	deleteCount := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
 
-			zoneID, err := p.getZoneID(context.Background(), tt.zoneName)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("getZoneID() error = %v, wantErr %v", err, tt.wantErr)
-				return
-			}
+		var req RecordRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		parts := strings.Split(r.URL.Path, "/")
+		id, _ := strconv.Atoi(parts[len(parts)-1])
 
-			if !tt.wantErr && zoneID != tt.wantID {
-				t.Errorf("getZoneID() = %v, want %v", zoneID, tt.wantID)
+		switch r.Method {
+		case http.MethodGet:
+			var records []Record
+			for _, rec := range state {
+				records = append(records, rec)
 			}
-		})
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(records)
+		case http.MethodPut:
+			req.Record.ID = id
+			state[id] = req.Record
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(req.Record)
+		case http.MethodPost:
+			// Every creation fails to simulate a mid-batch error
+			w.WriteHeader(http.StatusInternalServerError)
+		case http.MethodDelete:
+			deleteCount++
+			delete(state, id)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	_, err := p.SetRecords(context.Background(), "example.com", []libdns.Record{
+		makeRecord("www", "A", "192.0.2.100", 3600*time.Second),
+		makeRecord("new", "A", "192.0.2.200", 3600*time.Second),
+	})
+	if err == nil {
+		t.Fatal("SetRecords() expected an error")
+	}
+
+	if deleteCount != 0 {
+		t.Errorf("SetRecords() made %d delete calls, want 0", deleteCount)
+	}
+
+	for id, want := range original {
+		if got := state[id]; got != want {
+			t.Errorf("record %d = %+v after rollback, want %+v", id, got, want)
+		}
 	}
 }
 
-func TestProvider_GetRecords(t *testing.T) {
+func TestProvider_DeleteRecords(t *testing.T) {
+	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
+		rr := libdns.RR{
+			Name: name,
+			Type: typ,
+			Data: data,
+			TTL:  ttl,
+		}
+		rec, _ := rr.Parse()
+		return rec
+	}
+
+	twoARecords := []Record{
+		{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+	}
+
 	tests := []struct {
-		name      string
-		zoneName  string
-		zones     []Zone
-		records   []Record
-		wantErr   bool
-		wantCount int
+		name            string
+		zoneName        string
+		zones           []Zone
+		existingRecords []Record
+		deleteRecords   []libdns.Record
+		looseDelete     bool
+		wantErr         bool
+		wantCount       int
+		wantDeleted     []string
 	}{
 		{
-			name:     "get all records",
+			name:     "delete existing record",
 			zoneName: "example.com",
 			zones: []Zone{
 				{ID: 1, Name: "example.com"},
 			},
-			records: []Record{
+			existingRecords: []Record{
 				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
 				{ID: 2, Name: "mail", Type: "A", Content: "192.0.2.2", TTL: 3600},
 			},
-			wantErr:   false,
-			wantCount: 2,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 3600*time.Second),
+			},
+			wantErr:     false,
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/1"},
 		},
 		{
-			name:      "zone not found",
-			zoneName:  "notfound.com",
-			zones:     []Zone{},
-			records:   []Record{},
-			wantErr:   true,
-			wantCount: 0,
+			name:            "only the exact content among several records",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.2", 3600*time.Second),
+			},
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/2"},
+		},
+		{
+			name:            "no exact match deletes nothing and fails",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.3", 3600*time.Second),
+			},
+			wantErr:     true,
+			wantDeleted: nil,
+		},
+		{
+			name:            "no exact match with LooseDelete",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.3", 3600*time.Second),
+			},
+			looseDelete: true,
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/1"},
+		},
+		{
+			name:     "expanded IPv6 address matches compressed input",
+			zoneName: "example.com",
+			zones:    []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "AAAA", Content: "2001:0db8:0000::0001", TTL: 3600},
+				{ID: 2, Name: "www", Type: "AAAA", Content: "2001:0db8:0000::0002", TTL: 3600},
+			},
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "AAAA", "2001:db8::1", 3600*time.Second),
+			},
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/1"},
+		},
+		{
+			name:     "mixed-case existing name",
+			zoneName: "example.com",
+			zones:    []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: []Record{
+				{ID: 1, Name: "WWW", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 3600*time.Second),
+			},
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/1"},
+		},
+		{
+			name:     "empty data matches every value",
+			zoneName: "example.com",
+			zones:    []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: []Record{
+				{ID: 1, Name: "_acme-challenge", Type: "TXT", Content: "token-a", TTL: 300},
+				{ID: 2, Name: "_acme-challenge", Type: "TXT", Content: "token-b", TTL: 300},
+				{ID: 3, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			deleteRecords: []libdns.Record{
+				libdns.RR{Name: "_acme-challenge", Type: "TXT"},
+			},
+			wantCount:   2,
+			wantDeleted: []string{"/dns/zones/1/records/1", "/dns/zones/1/records/2"},
+		},
+		{
+			name:            "empty data of an address type",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				libdns.RR{Name: "www", Type: "A"},
+			},
+			wantCount:   2,
+			wantDeleted: []string{"/dns/zones/1/records/1", "/dns/zones/1/records/2"},
+		},
+		{
+			name:     "empty type matches every type",
+			zoneName: "example.com",
+			zones:    []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "AAAA", Content: "2001:db8::1", TTL: 3600},
+				{ID: 3, Name: "mail", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			deleteRecords: []libdns.Record{
+				libdns.RR{Name: "www"},
+			},
+			wantCount:   2,
+			wantDeleted: []string{"/dns/zones/1/records/1", "/dns/zones/1/records/2"},
+		},
+		{
+			name:     "empty type with data",
+			zoneName: "example.com",
+			zones:    []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+				{ID: 3, Name: "www", Type: "TXT", Content: "192.0.2.1", TTL: 3600},
+			},
+			deleteRecords: []libdns.Record{
+				libdns.RR{Name: "www", Data: "192.0.2.1"},
+			},
+			wantCount:   2,
+			wantDeleted: []string{"/dns/zones/1/records/1", "/dns/zones/1/records/3"},
+		},
+		{
+			name:            "zero TTL matches every TTL",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.2", 0),
+			},
+			wantCount:   1,
+			wantDeleted: []string{"/dns/zones/1/records/2"},
+		},
+		{
+			name:            "other TTL deletes nothing",
+			zoneName:        "example.com",
+			zones:           []Zone{{ID: 1, Name: "example.com"}},
+			existingRecords: twoARecords,
+			deleteRecords: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.2", 300*time.Second),
+			},
+			wantErr:     true,
+			wantDeleted: nil,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var deleted []string
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if r.URL.Path == "/dns/zones" {
 					w.WriteHeader(http.StatusOK)
 					_ = json.NewEncoder(w).Encode(tt.zones)
-				} else {
+				} else if r.Method == http.MethodGet {
 					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(tt.records)
+					_ = json.NewEncoder(w).Encode(tt.existingRecords)
+				} else if r.Method == http.MethodDelete {
+					deleted = append(deleted, r.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
 				}
 			}))
 			defer server.Close()
 
 			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   server.URL,
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				LooseDelete:       tt.looseDelete,
 			}
 
-			records, err := p.GetRecords(context.Background(), tt.zoneName)
+			records, err := p.DeleteRecords(context.Background(), tt.zoneName, tt.deleteRecords)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("GetRecords() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("DeleteRecords() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
+			if tt.wantErr && tt.existingRecords != nil && !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("DeleteRecords() error = %v, want ErrRecordNotFound", err)
+			}
+
 			if !tt.wantErr && len(records) != tt.wantCount {
-				t.Errorf("GetRecords() returned %d records, want %d", len(records), tt.wantCount)
+				t.Errorf("DeleteRecords() returned %d records, want %d", len(records), tt.wantCount)
+			}
+
+			if !slices.Equal(deleted, tt.wantDeleted) {
+				t.Errorf("DeleteRecords() deleted %v, want %v", deleted, tt.wantDeleted)
 			}
 		})
 	}
 }
 
-func TestProvider_AppendRecords(t *testing.T) {
-	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
-		rr := libdns.RR{
-			Name: name,
-			Type: typ,
-			Data: data,
-			TTL:  ttl,
+func TestProvider_DeleteRecordsByID(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 2, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+	}
+
+	var deletedIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(existingRecords)
+		} else if r.Method == http.MethodDelete {
+			parts := strings.Split(r.URL.Path, "/")
+			deletedIDs = append(deletedIDs, parts[len(parts)-1])
+			w.WriteHeader(http.StatusNoContent)
 		}
-		rec, _ := rr.Parse()
-		return rec
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	current, err := p.GetRecords(context.Background(), "example.com.")
+	if err != nil {
+		t.Fatalf("GetRecords() error = %v", err)
+	}
+
+	// Both records share name, type and content; only the ID tells them apart
+	var target libdns.Record
+	for _, rec := range current {
+		if pd, ok := providerData(rec); ok && pd.ID == 2 {
+			target = rec
+		}
+	}
+	if target == nil {
+		t.Fatal("GetRecords() did not return a record with ID 2")
+	}
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com.", []libdns.Record{target})
+	if err != nil {
+		t.Fatalf("DeleteRecords() error = %v", err)
+	}
+
+	if len(deleted) != 1 {
+		t.Fatalf("DeleteRecords() returned %d records, want 1", len(deleted))
+	}
+
+	if len(deletedIDs) != 1 || deletedIDs[0] != "2" {
+		t.Errorf("DeleteRecords() deleted IDs %v, want [2]", deletedIDs)
+	}
+}
+
+func TestProvider_DeleteRecordsByIDParentZone(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "www.dev", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 2, Name: "www.dev", Type: "A", Content: "192.0.2.1", TTL: 3600},
+	}
+
+	var deletedIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(existingRecords)
+		} else if r.Method == http.MethodDelete {
+			parts := strings.Split(r.URL.Path, "/")
+			deletedIDs = append(deletedIDs, parts[len(parts)-1])
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+		ResolveParentZone: true,
 	}
 
+	// The record is given for dev.example.com, which the API only knows as part
+	// of example.com; its ID must survive the move to the enclosing zone
+	target := withProviderData(libdns.Address{
+		Name: "www",
+		TTL:  time.Hour,
+		IP:   netip.MustParseAddr("192.0.2.1"),
+	}, ProviderData{ID: 2})
+
+	deleted, err := p.DeleteRecords(context.Background(), "dev.example.com.", []libdns.Record{target})
+	if err != nil {
+		t.Fatalf("DeleteRecords() error = %v", err)
+	}
+
+	if len(deleted) != 1 {
+		t.Fatalf("DeleteRecords() returned %d records, want 1", len(deleted))
+	}
+
+	if len(deletedIDs) != 1 || deletedIDs[0] != "2" {
+		t.Errorf("DeleteRecords() deleted IDs %v, want [2]", deletedIDs)
+	}
+}
+
+func TestProvider_DeleteRecordsNormalized(t *testing.T) {
+	var deletedIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+		} else if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Record{
+				{ID: 1, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+				{ID: 2, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 20},
+				{ID: 3, Name: "@", Type: "TXT", Content: `"v=spf1 mx -all"`, TTL: 3600},
+				{ID: 4, Name: "@", Type: "TXT", Content: "v=spf1 -all", TTL: 3600},
+			})
+		} else if r.Method == http.MethodDelete {
+			deletedIDs = append(deletedIDs, path.Base(r.URL.Path))
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+		// The target differs in case and trailing dot, the priority picks one record
+		libdns.MX{Name: "@", Preference: 10, Target: "MAIL.example.com."},
+		// The API stores this value quoted
+		libdns.TXT{Name: "@", Text: "v=spf1 mx -all"},
+		// No record has this priority
+		libdns.MX{Name: "@", Preference: 30, Target: "mail.example.com."},
+	})
+	if !errors.Is(err, ErrRecordNotFound) || !strings.Contains(err.Error(), `@ MX "mail.example.com."`) {
+		t.Fatalf("DeleteRecords() error = %v, want ErrRecordNotFound for the MX of priority 30", err)
+	}
+
+	if !slices.Equal(deletedIDs, []string{"1", "3"}) {
+		t.Errorf("DeleteRecords() deleted IDs %v, want [1 3]", deletedIDs)
+	}
+
+	if len(deleted) != 2 || deleted[0].RR().Data != "10 mail.example.com" || deleted[1].RR().Data != "v=spf1 mx -all" {
+		t.Errorf("DeleteRecords() = %+v, want the MX of priority 10 and the quoted TXT", deleted)
+	}
+}
+
+func TestProvider_DeleteRecordsFailOnMissing(t *testing.T) {
 	tests := []struct {
-		name       string
-		zoneName   string
-		zones      []Zone
-		newRecords []libdns.Record
-		wantErr    bool
-		wantCount  int
+		name    string
+		fail    bool
+		wantErr bool
 	}{
-		{
-			name:     "append single record",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			newRecords: []libdns.Record{
-				makeRecord("test", "A", "192.0.2.1", 3600*time.Second),
-			},
-			wantErr:   false,
-			wantCount: 1,
-		},
-		{
-			name:     "append multiple records",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			newRecords: []libdns.Record{
-				makeRecord("test1", "A", "192.0.2.1", 3600*time.Second),
-				makeRecord("test2", "A", "192.0.2.2", 3600*time.Second),
-			},
-			wantErr:   false,
-			wantCount: 2,
-		},
+		{name: "lenient by default"},
+		{name: "fail on missing", fail: true, wantErr: true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			recordID := 1
+			var deletedIDs []string
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if r.URL.Path == "/dns/zones" {
 					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(tt.zones)
-				} else if r.Method == http.MethodPost {
-					var req RecordRequest
-					_ = json.NewDecoder(r.Body).Decode(&req)
-					req.Record.ID = recordID
-					recordID++
-					w.WriteHeader(http.StatusCreated)
-					_ = json.NewEncoder(w).Encode(req.Record)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else if r.Method == http.MethodGet {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Record{
+						{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+					})
+				} else if r.Method == http.MethodDelete {
+					deletedIDs = append(deletedIDs, path.Base(r.URL.Path))
+					w.WriteHeader(http.StatusNoContent)
 				}
 			}))
 			defer server.Close()
 
 			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   server.URL,
+				APIToken:            "test-token",
+				APIURL:              server.URL,
+				AllowInsecureHTTP:   true,
+				FailOnMissingDelete: tt.fail,
 			}
 
-			records, err := p.AppendRecords(context.Background(), tt.zoneName, tt.newRecords)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("AppendRecords() error = %v, wantErr %v", err, tt.wantErr)
+			deleted, err := p.DeleteRecords(context.Background(), "example.com", []libdns.Record{
+				libdns.Address{Name: "www", IP: netip.MustParseAddr("192.0.2.1")},
+				libdns.TXT{Name: "gone", Text: "old"},
+			})
+
+			if len(deleted) != 1 || len(deletedIDs) != 1 || deletedIDs[0] != "1" {
+				t.Errorf("DeleteRecords() returned %d records and deleted %v, want the existing record deleted", len(deleted), deletedIDs)
+			}
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("DeleteRecords() error = %v", err)
+				}
 				return
 			}
 
-			if !tt.wantErr && len(records) != tt.wantCount {
-				t.Errorf("AppendRecords() returned %d records, want %d", len(records), tt.wantCount)
+			if !errors.Is(err, ErrRecordNotFound) {
+				t.Fatalf("DeleteRecords() error = %v, want ErrRecordNotFound", err)
+			}
+			if !strings.Contains(err.Error(), `gone TXT "old"`) || strings.Contains(err.Error(), "www") {
+				t.Errorf("DeleteRecords() error = %q, want it to list only the missing record", err)
 			}
 		})
 	}
 }
 
-func TestProvider_SetRecords(t *testing.T) {
-	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
-		rr := libdns.RR{
-			Name: name,
-			Type: typ,
-			Data: data,
-			TTL:  ttl,
-		}
-		rec, _ := rr.Parse()
-		return rec
+func TestProvider_DeleteAllRecords(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "@", Type: "SOA", Content: "ns1.example.net. hostmaster.example.com. 1 7200 3600 1209600 3600", TTL: 3600},
+		{ID: 2, Name: "@", Type: "NS", Content: "ns1.example.net", TTL: 3600},
+		{ID: 3, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+		{ID: 4, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+		{ID: 5, Name: "_test", Type: "TXT", Content: "stray", TTL: 300},
 	}
 
 	tests := []struct {
-		name            string
-		zoneName        string
-		zones           []Zone
-		existingRecords []Record
-		newRecords      []libdns.Record
-		wantErr         bool
-		wantCount       int
-		wantDeletes     int // expected number of delete calls
+		name        string
+		opts        []DeleteAllOption
+		failID      int
+		wantDeleted []string
+		wantErr     bool
 	}{
 		{
-			name:     "set replaces existing record",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			existingRecords: []Record{
-				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
-			},
-			newRecords: []libdns.Record{
-				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
-			},
-			wantErr:     false,
-			wantCount:   1,
-			wantDeletes: 0,
+			name:        "apex NS and SOA kept by default",
+			wantDeleted: []string{"A", "MX", "TXT"},
 		},
 		{
-			name:     "set deletes extra existing records",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			existingRecords: []Record{
-				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
-				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
-				{ID: 3, Name: "www", Type: "A", Content: "192.0.2.3", TTL: 3600},
-			},
-			newRecords: []libdns.Record{
-				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
-			},
-			wantErr:     false,
-			wantCount:   1,
-			wantDeletes: 2, // should delete 2 extra records
+			name:        "kept types",
+			opts:        []DeleteAllOption{KeepTypes("mx")},
+			wantDeleted: []string{"A", "TXT"},
 		},
 		{
-			name:     "set creates new records when fewer exist",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			existingRecords: []Record{
-				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
-			},
-			newRecords: []libdns.Record{
-				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
-				makeRecord("www", "A", "192.0.2.101", 7200*time.Second),
-				makeRecord("www", "A", "192.0.2.102", 7200*time.Second),
-			},
-			wantErr:     false,
-			wantCount:   3,
-			wantDeletes: 0,
+			name:        "apex NS deleted on request",
+			opts:        []DeleteAllOption{DeleteApexNS()},
+			wantDeleted: []string{"SOA", "NS", "A", "MX", "TXT"},
 		},
 		{
-			name:     "set creates record when none exist",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
-			},
-			existingRecords: []Record{},
-			newRecords: []libdns.Record{
-				makeRecord("www", "A", "192.0.2.100", 7200*time.Second),
-			},
-			wantErr:     false,
-			wantCount:   1,
-			wantDeletes: 0,
+			name:        "failures do not stop the others",
+			failID:      4,
+			wantDeleted: []string{"A", "TXT"},
+			wantErr:     true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			recordID := 100
-			deleteCount := 0
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if r.URL.Path == "/dns/zones" {
 					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(tt.zones)
-				} else if r.Method == http.MethodGet {
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				switch r.Method {
+				case http.MethodGet:
 					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(tt.existingRecords)
-				} else if r.Method == http.MethodDelete {
-					deleteCount++
-					w.WriteHeader(http.StatusNoContent)
-				} else if r.Method == http.MethodPut {
-					// Handle update - extract record ID from path and return updated record
-					var req RecordRequest
-					_ = json.NewDecoder(r.Body).Decode(&req)
-					// Extract record ID from path (e.g., /dns/zones/1/records/1)
-					parts := strings.Split(r.URL.Path, "/")
-					if len(parts) >= 5 {
-						id, _ := strconv.Atoi(parts[len(parts)-1])
-						req.Record.ID = id
+					_ = json.NewEncoder(w).Encode(existingRecords)
+				case http.MethodDelete:
+					if r.URL.Path == "/dns/zones/1/records/"+strconv.Itoa(tt.failID) {
+						w.WriteHeader(http.StatusInternalServerError)
+						return
 					}
-					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(req.Record)
-				} else if r.Method == http.MethodPost {
-					var req RecordRequest
-					_ = json.NewDecoder(r.Body).Decode(&req)
-					req.Record.ID = recordID
-					recordID++
-					w.WriteHeader(http.StatusCreated)
-					_ = json.NewEncoder(w).Encode(req.Record)
+					w.WriteHeader(http.StatusNoContent)
 				}
 			}))
 			defer server.Close()
 
 			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   server.URL,
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
 			}
 
-			records, err := p.SetRecords(context.Background(), tt.zoneName, tt.newRecords)
+			records, err := p.DeleteAllRecords(context.Background(), "example.com", tt.opts...)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("SetRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
+				t.Fatalf("DeleteAllRecords() error = %v, wantErr %v", err, tt.wantErr)
 			}
 
-			if !tt.wantErr && len(records) != tt.wantCount {
-				t.Errorf("SetRecords() returned %d records, want %d", len(records), tt.wantCount)
+			var gotDeleted []string
+			for _, rec := range records {
+				gotDeleted = append(gotDeleted, rec.RR().Type)
 			}
 
-			if deleteCount != tt.wantDeletes {
-				t.Errorf("SetRecords() made %d delete calls, want %d", deleteCount, tt.wantDeletes)
+			if !slices.Equal(gotDeleted, tt.wantDeleted) {
+				t.Errorf("DeleteAllRecords() deleted %v, want %v", gotDeleted, tt.wantDeleted)
 			}
 		})
 	}
 }
 
-func TestProvider_DeleteRecords(t *testing.T) {
+func TestProvider_DeleteRecordsMatching(t *testing.T) {
+	existingRecords := []Record{
+		{ID: 1, Name: "@", Type: "NS", Content: "ns1.example.net", TTL: 3600},
+		{ID: 2, Name: "_acme-challenge", Type: "TXT", Content: "token-a", TTL: 300},
+		{ID: 3, Name: "_acme-challenge.www", Type: "TXT", Content: "token-b", TTL: 300},
+		{ID: 4, Name: "_acme-challenge.www", Type: "CNAME", Content: "acme.example.net", TTL: 300},
+		{ID: 5, Name: "www", Type: "TXT", Content: "_acme-challenge", TTL: 300},
+	}
+
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode(existingRecords)
+		case http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	records, err := p.DeleteRecordsMatching(context.Background(), "example.com", func(rec libdns.Record) bool {
+		rr := rec.RR()
+		return rr.Type == "TXT" && strings.HasPrefix(rr.Name, "_acme-challenge.")
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsMatching() error = %v", err)
+	}
+
+	wantDeleted := []string{"/dns/zones/1/records/2", "/dns/zones/1/records/3"}
+	if !slices.Equal(deleted, wantDeleted) {
+		t.Errorf("DeleteRecordsMatching() deleted %v, want %v", deleted, wantDeleted)
+	}
+
+	var names []string
+	for _, rec := range records {
+		names = append(names, rec.RR().Name)
+	}
+	if !slices.Equal(names, []string{"_acme-challenge.example.com.", "_acme-challenge.www.example.com."}) {
+		t.Errorf("DeleteRecordsMatching() returned %v", names)
+	}
+
+	// The apex NS record goes when the matcher selects it explicitly
+	deleted = nil
+	_, err = p.DeleteRecordsMatching(context.Background(), "example.com", func(rec libdns.Record) bool {
+		return rec.RR().Type == "NS"
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsMatching() error = %v", err)
+	}
+	if !slices.Equal(deleted, []string{"/dns/zones/1/records/1"}) {
+		t.Errorf("DeleteRecordsMatching() deleted %v, want the apex NS record", deleted)
+	}
+
+	// A subzone resolved to its parent only covers its own names, and the
+	// deletions are reported
+	deleted = nil
+	var events []string
+	p.ResolveParentZone = true
+	p.OnChange = func(event ChangeEvent) {
+		events = append(events, fmt.Sprintf("%s %s %s", event.Op, event.Zone, event.Record.RR().Name))
+	}
+	_, err = p.DeleteRecordsMatching(context.Background(), "www.example.com", func(rec libdns.Record) bool {
+		return rec.RR().Type == "TXT"
+	})
+	if err != nil {
+		t.Fatalf("DeleteRecordsMatching() error = %v", err)
+	}
+	if !slices.Equal(deleted, []string{"/dns/zones/1/records/3", "/dns/zones/1/records/5"}) {
+		t.Errorf("DeleteRecordsMatching() deleted %v, want the TXT records of www", deleted)
+	}
+	wantEvents := []string{
+		"delete example.com _acme-challenge.www.example.com.",
+		"delete example.com www.example.com.",
+	}
+	if !slices.Equal(events, wantEvents) {
+		t.Errorf("OnChange events = %v, want %v", events, wantEvents)
+	}
+}
+
+func TestProvider_DiffZone(t *testing.T) {
 	makeRecord := func(name, typ, data string, ttl time.Duration) libdns.Record {
 		rr := libdns.RR{
 			Name: name,
@@ -756,64 +6430,212 @@ func TestProvider_DeleteRecords(t *testing.T) {
 
 	tests := []struct {
 		name            string
-		zoneName        string
-		zones           []Zone
 		existingRecords []Record
-		deleteRecords   []libdns.Record
-		wantErr         bool
-		wantCount       int
+		desired         []libdns.Record
+		minTTL          time.Duration
+		wantMissing     int
+		wantExtra       int
+		wantChanged     int
 	}{
 		{
-			name:     "delete existing record",
-			zoneName: "example.com",
-			zones: []Zone{
-				{ID: 1, Name: "example.com"},
+			name: "in sync",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 3600*time.Second),
 			},
+		},
+		{
+			name: "missing record",
 			existingRecords: []Record{
 				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
-				{ID: 2, Name: "mail", Type: "A", Content: "192.0.2.2", TTL: 3600},
 			},
-			deleteRecords: []libdns.Record{
+			desired: []libdns.Record{
 				makeRecord("www", "A", "192.0.2.1", 3600*time.Second),
+				makeRecord("mail", "A", "192.0.2.2", 3600*time.Second),
 			},
-			wantErr:   false,
-			wantCount: 1,
+			wantMissing: 1,
+		},
+		{
+			name: "extra record",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "old", Type: "A", Content: "192.0.2.9", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 3600*time.Second),
+			},
+			wantExtra: 1,
+		},
+		{
+			name: "changed content",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.100", 3600*time.Second),
+			},
+			wantChanged: 1,
+		},
+		{
+			name: "changed TTL",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 300*time.Second),
+			},
+			wantChanged: 1,
+		},
+		{
+			name: "TTL rounding to the same seconds",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", 3600*time.Second+200*time.Millisecond),
+			},
+		},
+		{
+			name: "TTL raised to MinTTL",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 300},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.1", time.Minute),
+			},
+			minTTL: 5 * time.Minute,
+		},
+		{
+			name: "quoted TXT value rewritten in place",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "TXT", Content: `"hello"`, TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "TXT", "hello", 3600*time.Second),
+			},
+			wantChanged: 1,
+		},
+		{
+			name: "mixed",
+			existingRecords: []Record{
+				{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600},
+				{ID: 2, Name: "www", Type: "A", Content: "192.0.2.2", TTL: 3600},
+				{ID: 3, Name: "old", Type: "CNAME", Content: "example.com.", TTL: 3600},
+			},
+			desired: []libdns.Record{
+				makeRecord("www", "A", "192.0.2.2", 3600*time.Second),
+				makeRecord("www", "A", "192.0.2.3", 3600*time.Second),
+				makeRecord("new", "TXT", "hello", 3600*time.Second),
+			},
+			wantMissing: 1,
+			wantExtra:   1,
+			wantChanged: 1,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					t.Errorf("DiffZone() made a %s request, want only GET", r.Method)
+				}
+
 				if r.URL.Path == "/dns/zones" {
 					w.WriteHeader(http.StatusOK)
-					_ = json.NewEncoder(w).Encode(tt.zones)
-				} else if r.Method == http.MethodGet {
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+				} else {
 					w.WriteHeader(http.StatusOK)
 					_ = json.NewEncoder(w).Encode(tt.existingRecords)
-				} else if r.Method == http.MethodDelete {
-					w.WriteHeader(http.StatusNoContent)
 				}
 			}))
 			defer server.Close()
 
 			p := &Provider{
-				APIToken: "test-token",
-				APIURL:   server.URL,
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				MinTTL:            tt.minTTL,
 			}
 
-			records, err := p.DeleteRecords(context.Background(), tt.zoneName, tt.deleteRecords)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("DeleteRecords() error = %v, wantErr %v", err, tt.wantErr)
-				return
+			missing, extra, changed, err := p.DiffZone(context.Background(), "example.com.", tt.desired)
+			if err != nil {
+				t.Fatalf("DiffZone() error = %v", err)
 			}
 
-			if !tt.wantErr && len(records) != tt.wantCount {
-				t.Errorf("DeleteRecords() returned %d records, want %d", len(records), tt.wantCount)
+			if len(missing) != tt.wantMissing {
+				t.Errorf("DiffZone() missing = %d, want %d", len(missing), tt.wantMissing)
+			}
+			if len(extra) != tt.wantExtra {
+				t.Errorf("DiffZone() extra = %d, want %d", len(extra), tt.wantExtra)
+			}
+			if len(changed) != tt.wantChanged {
+				t.Errorf("DiffZone() changed = %d, want %d", len(changed), tt.wantChanged)
 			}
 		})
 	}
 }
 
+func TestProvider_GetZoneSnapshot(t *testing.T) {
+	snapshot := func(records []Record) ZoneSnapshot {
+		t.Helper()
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/dns/zones" {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			} else {
+				w.WriteHeader(http.StatusOK)
+				_ = json.NewEncoder(w).Encode(records)
+			}
+		}))
+		defer server.Close()
+
+		p := &Provider{
+			APIToken:          "test-token",
+			APIURL:            server.URL,
+			AllowInsecureHTTP: true,
+		}
+
+		snap, err := p.GetZoneSnapshot(context.Background(), "example.com.")
+		if err != nil {
+			t.Fatalf("GetZoneSnapshot() error = %v", err)
+		}
+
+		if len(snap.Records) != len(records) {
+			t.Fatalf("GetZoneSnapshot() returned %d records, want %d", len(snap.Records), len(records))
+		}
+
+		return snap
+	}
+
+	www := Record{ID: 1, Name: "www", Type: "A", Content: "192.0.2.1", TTL: 3600}
+	mail := Record{ID: 2, Name: "mail", Type: "MX", Content: "mx.example.com.", TTL: 3600, Priority: 10}
+	txt := Record{ID: 3, Name: "@", Type: "TXT", Content: "v=spf1 -all", TTL: 300}
+
+	base := snapshot([]Record{www, mail, txt})
+	reordered := snapshot([]Record{txt, www, mail})
+
+	if base.Checksum != reordered.Checksum {
+		t.Errorf("checksum changed after reordering: %s != %s", base.Checksum, reordered.Checksum)
+	}
+
+	changedWWW := www
+	changedWWW.Content = "192.0.2.2"
+	changed := snapshot([]Record{changedWWW, mail, txt})
+
+	if base.Checksum == changed.Checksum {
+		t.Error("checksum did not change after a record changed")
+	}
+
+	changedTTL := txt
+	changedTTL.TTL = 600
+	if base.Checksum == snapshot([]Record{www, mail, changedTTL}).Checksum {
+		t.Error("checksum did not change after a TTL changed")
+	}
+}
+
 // Integration tests - only run if environment variables are set
 func TestIntegration_GetRecords(t *testing.T) {
 	apiToken := os.Getenv("NEODIGIT_TOKEN")
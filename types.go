@@ -1,10 +1,23 @@
 package tecnocratica
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
 // Zone represents a DNS zone.
 type Zone struct {
-	ID        int    `json:"id"`
-	Name      string `json:"name"`
-	HumanName string `json:"human_name"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	HumanName   string `json:"human_name"`
+	RecordCount int    `json:"records_count,omitempty"`
+	Status      string `json:"status,omitempty"`
+
+	// Serial is the SOA serial of the zone, when the API reports it.
+	Serial uint32 `json:"serial,omitempty"`
 }
 
 // Record represents a DNS record.
@@ -15,9 +28,268 @@ type Record struct {
 	Content  string `json:"content,omitempty"`
 	TTL      int    `json:"ttl,omitempty"`
 	Priority int    `json:"prio,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	Proxied  bool   `json:"proxied,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+
+	// ETag is the entity tag the API returned with the record, if any: the ETag
+	// header of a single-record response, or the etag field of a listed record.
+	// It is sent back as If-Match when the record is updated.
+	ETag string `json:"-"`
+}
+
+// UnmarshalJSON decodes a zone, accepting numbers encoded as JSON strings.
+func (z *Zone) UnmarshalJSON(data []byte) error {
+	type plain Zone
+
+	aux := struct {
+		*plain
+		ID          flexInt    `json:"id"`
+		RecordCount flexInt    `json:"records_count"`
+		Serial      flexSerial `json:"serial"`
+	}{plain: (*plain)(z)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	z.ID = int(aux.ID)
+	z.RecordCount = int(aux.RecordCount)
+	z.Serial = uint32(aux.Serial)
+
+	return nil
+}
+
+// UnmarshalJSON decodes a record, accepting numbers encoded as JSON strings
+// (e.g. "ttl": "3600"), which some API versions send.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type plain Record
+
+	aux := struct {
+		*plain
+		ID       flexInt `json:"id"`
+		TTL      flexInt `json:"ttl"`
+		Priority flexInt `json:"prio"`
+		Weight   flexInt `json:"weight"`
+		ETag     string  `json:"etag"`
+	}{plain: (*plain)(r)}
+
+	err := json.Unmarshal(data, &aux)
+	if err != nil {
+		return err
+	}
+
+	r.ID = int(aux.ID)
+	r.TTL = int(aux.TTL)
+	r.Priority = int(aux.Priority)
+	r.Weight = int(aux.Weight)
+	r.ETag = aux.ETag
+
+	return nil
+}
+
+// flexInt is an integer that may be encoded as a JSON number or string.
+// An empty string or null decodes to zero.
+type flexInt int
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (i *flexInt) UnmarshalJSON(data []byte) error {
+	s, err := flexNumber(data)
+	if err != nil || s == "" {
+		return err
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		// Accept integral floats such as 3600.0
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || f != float64(int(f)) {
+			return fmt.Errorf("invalid integer %s", data)
+		}
+		n = int(f)
+	}
+
+	*i = flexInt(n)
+
+	return nil
+}
+
+// flexSerial is a zone serial that may be encoded as a JSON number or string.
+// Unlike flexInt, it holds the whole uint32 range on every platform.
+type flexSerial uint32
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (serial *flexSerial) UnmarshalJSON(data []byte) error {
+	s, err := flexNumber(data)
+	if err != nil || s == "" {
+		return err
+	}
+
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid zone serial %s", data)
+	}
+
+	*serial = flexSerial(n)
+
+	return nil
+}
+
+// flexNumber returns the text of a number encoded as a JSON number or string,
+// or "" for null and an empty string.
+func flexNumber(data []byte) (string, error) {
+	s := string(data)
+	if s == "null" {
+		return "", nil
+	}
+
+	if len(s) >= 2 && s[0] == '"' {
+		err := json.Unmarshal(data, &s)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return s, nil
+}
+
+// listResponse is a list returned by the API either as a bare JSON array or
+// wrapped in an envelope such as {"data": [...], "meta": {...}}.
+type listResponse[T any] []T
+
+// UnmarshalJSON picks the shape of the list by peeking at the first JSON token.
+func (l *listResponse[T]) UnmarshalJSON(data []byte) error {
+	tok, err := json.NewDecoder(bytes.NewReader(data)).Token()
+	if err != nil {
+		return err
+	}
+
+	if tok == json.Delim('{') {
+		var envelope struct {
+			Data []T `json:"data"`
+		}
+
+		err = json.Unmarshal(data, &envelope)
+		if err != nil {
+			return err
+		}
+
+		*l = envelope.Data
+
+		return nil
+	}
+
+	var items []T
+
+	err = json.Unmarshal(data, &items)
+	if err != nil {
+		return err
+	}
+
+	*l = items
+
+	return nil
+}
+
+// ZoneRequest is the request body for creating a zone.
+type ZoneRequest struct {
+	Zone NewZone `json:"zone"`
+}
+
+// NewZone holds the fields of a zone to be created.
+type NewZone struct {
+	Name string `json:"name"`
 }
 
 // RecordRequest is the request body for creating/updating a record.
 type RecordRequest struct {
 	Record Record `json:"record"`
 }
+
+// recordUpdate is the record sent by updates. Unlike creations, which leave the
+// flags out so records start enabled and unproxied, updates always send whether
+// the record is disabled and proxied, so either can be turned off again, and the
+// comment, so it can be cleared.
+type recordUpdate struct {
+	Record
+	Disabled bool   `json:"disabled"`
+	Proxied  bool   `json:"proxied"`
+	Comment  string `json:"comment"`
+}
+
+// RecordsRequest is the request body for creating several records at once.
+type RecordsRequest struct {
+	Records []Record `json:"records"`
+}
+
+// ProviderData is attached to the records returned by the provider and
+// carries the API fields that have no libdns equivalent.
+type ProviderData struct {
+	// ID is the identifier the API assigned to the record. When set on a record
+	// passed to DeleteRecords, it targets that exact record.
+	ID int
+
+	// Weight is the load-balancing weight of the record, if the API exposes one.
+	Weight int
+
+	// Disabled reports whether the record is disabled in the control panel.
+	Disabled bool
+
+	// Proxied reports whether the record is proxied by the provider.
+	Proxied bool
+
+	// Comment is the operator note stored along with the record.
+	Comment string
+
+	// ClearComment makes an update remove the comment of the record when Comment
+	// is empty, instead of keeping it.
+	ClearComment bool
+}
+
+// RecordOptions are the provider-specific settings that can be attached to a
+// record with WithOptions before it is appended or set.
+type RecordOptions struct {
+	Comment  string
+	Proxied  bool
+	Disabled bool
+	Weight   int
+
+	// ClearComment removes the comment of the record it updates. Without it, a
+	// record given with an empty Comment keeps its existing one.
+	ClearComment bool
+}
+
+// ZoneInfo describes a zone along with the metadata the API reports for it.
+type ZoneInfo struct {
+	// ID is the identifier the API assigned to the zone.
+	ID int
+
+	// Name is the fully-qualified zone name, with a trailing dot.
+	Name string
+
+	// HumanName is the display name of the zone, e.g. its Unicode form.
+	HumanName string
+
+	// RecordCount is the number of records in the zone, when the API reports it.
+	RecordCount int
+
+	// Status is the state of the zone in the control panel, when the API reports it.
+	Status string
+}
+
+// APIInfo describes the API version and the optional features the API reports.
+type APIInfo struct {
+	// Version is the API version, or APIVersionUnknown when the API does not
+	// report it.
+	Version string `json:"version"`
+
+	// Features lists the optional features the API supports, e.g. FeatureBulkCreate.
+	Features []string `json:"features,omitempty"`
+}
+
+// Supports reports whether the API lists the given feature.
+func (i APIInfo) Supports(feature string) bool {
+	return slices.Contains(i.Features, feature)
+}
@@ -0,0 +1,438 @@
+package tecnocratica
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// ZoneFileOption configures AppendFromZoneFile.
+type ZoneFileOption func(*zoneFileOptions)
+
+type zoneFileOptions struct {
+	importApexNS bool
+}
+
+// ImportApexNS makes AppendFromZoneFile also create the NS records at the zone
+// apex, which are skipped by default since the provider manages them.
+func ImportApexNS() ZoneFileOption {
+	return func(o *zoneFileOptions) {
+		o.importApexNS = true
+	}
+}
+
+// AppendFromZoneFile parses a zone file in the BIND master-file format (RFC 1035)
+// and appends its records to the zone with AppendRecords. Names relative to the
+// file's $ORIGIN, which defaults to the zone, are resolved.
+//
+// The SOA record is always skipped, as are the NS records at the apex unless the
+// ImportApexNS option is given. Records of a type the provider cannot write make
+// the whole import fail before anything is created.
+func (p *Provider) AppendFromZoneFile(ctx context.Context, zone string, r io.Reader, opts ...ZoneFileOption) ([]libdns.Record, error) {
+	var options zoneFileOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	rrs, err := parseZoneFile(r, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []libdns.Record
+	for _, rr := range rrs {
+		if rr.Type == "SOA" {
+			continue
+		}
+		if rr.Type == "NS" && apiName(zone, rr.Name) == "@" && !options.importApexNS {
+			continue
+		}
+
+		records = append(records, rr)
+	}
+
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	return p.AppendRecords(ctx, zone, records)
+}
+
+// zoneFileToken is a word of a zone file entry. The text has its escapes
+// resolved, while raw keeps an unquoted word as written, so that the escapes of a
+// domain name such as "\." keep their meaning.
+type zoneFileToken struct {
+	text   string
+	raw    string
+	quoted bool
+}
+
+// zoneFileEntry is a logical line of a zone file, with parentheses resolved.
+type zoneFileEntry struct {
+	line   int
+	tokens []zoneFileToken
+
+	// blankOwner is set when the entry starts with whitespace and so reuses the
+	// owner name of the previous record
+	blankOwner bool
+}
+
+// parseZoneFile reads the records of a zone file. The returned records have
+// fully-qualified names; their TTL is zero when the file sets none.
+func parseZoneFile(r io.Reader, zone string) ([]libdns.RR, error) {
+	entries, err := readZoneFileEntries(r)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := strings.TrimSuffix(zone, ".") + "."
+
+	var rrs []libdns.RR
+	var owner string
+	var defaultTTL, lastTTL time.Duration
+	for _, entry := range entries {
+		tokens := entry.tokens
+
+		switch strings.ToUpper(tokens[0].text) {
+		case "$ORIGIN":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("zone file line %d: $ORIGIN takes one name", entry.line)
+			}
+			origin = zoneFileName(tokens[1].raw, origin)
+			continue
+		case "$TTL":
+			if len(tokens) != 2 {
+				return nil, fmt.Errorf("zone file line %d: $TTL takes one value", entry.line)
+			}
+			ttl, err := parseZoneFileTTL(tokens[1].text)
+			if err != nil {
+				return nil, fmt.Errorf("zone file line %d: %w", entry.line, err)
+			}
+			defaultTTL = ttl
+			continue
+		case "$INCLUDE", "$GENERATE":
+			return nil, fmt.Errorf("zone file line %d: %s is not supported", entry.line, tokens[0].text)
+		}
+
+		if !entry.blankOwner {
+			owner = zoneFileName(tokens[0].raw, origin)
+			tokens = tokens[1:]
+		}
+		if owner == "" {
+			return nil, fmt.Errorf("zone file line %d: no owner name", entry.line)
+		}
+
+		// The TTL and class are both optional and may come in either order
+		ttl, hasTTL := time.Duration(0), false
+		for len(tokens) > 0 && !tokens[0].quoted {
+			if t, err := parseZoneFileTTL(tokens[0].text); err == nil && !hasTTL {
+				ttl, hasTTL = t, true
+			} else if strings.EqualFold(tokens[0].text, "IN") {
+				// Only the Internet class is meaningful here
+			} else {
+				break
+			}
+			tokens = tokens[1:]
+		}
+
+		switch {
+		case hasTTL:
+			lastTTL = ttl
+		case defaultTTL > 0:
+			ttl = defaultTTL
+		default:
+			ttl = lastTTL
+		}
+
+		if len(tokens) < 2 {
+			return nil, fmt.Errorf("zone file line %d: want a type and data", entry.line)
+		}
+
+		rrType := strings.ToUpper(tokens[0].text)
+		rrs = append(rrs, libdns.RR{
+			Name: owner,
+			Type: rrType,
+			TTL:  ttl,
+			Data: zoneFileData(rrType, tokens[1:], origin),
+		})
+	}
+
+	return rrs, nil
+}
+
+// readZoneFileEntries splits a zone file into entries, dropping comments and
+// joining the lines enclosed in parentheses. Escapes are those of RFC 1035: "\X"
+// stands for the character X, even a delimiter, and "\DDD" for the byte of
+// decimal value DDD.
+func readZoneFileEntries(r io.Reader) ([]zoneFileEntry, error) {
+	var entries []zoneFileEntry
+	var current *zoneFileEntry
+	depth := 0
+
+	scanner := bufio.NewScanner(r)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := scanner.Text()
+
+		if depth == 0 {
+			current = &zoneFileEntry{
+				line:       lineNo,
+				blankOwner: line != "" && (line[0] == ' ' || line[0] == '\t'),
+			}
+		}
+
+		var word, raw strings.Builder
+		inWord, inQuotes := false, false
+		flush := func(quoted bool) {
+			if inWord || quoted {
+				current.tokens = append(current.tokens, zoneFileToken{text: word.String(), raw: raw.String(), quoted: quoted})
+			}
+			word.Reset()
+			raw.Reset()
+			inWord = false
+		}
+
+	chars:
+		for i := 0; i < len(line); i++ {
+			c := line[i]
+
+			switch {
+			case c == '\\':
+				b, n, err := zoneFileEscape(line[i:])
+				if err != nil {
+					return nil, fmt.Errorf("zone file line %d: %w", lineNo, err)
+				}
+				word.WriteByte(b)
+				raw.WriteString(line[i : i+n])
+				inWord = true
+				i += n - 1
+			case inQuotes && c == '"':
+				flush(true)
+				inQuotes = false
+			case inQuotes:
+				word.WriteByte(c)
+			case c == '"':
+				flush(false)
+				inQuotes = true
+			case c == ';':
+				break chars
+			case c == '(':
+				flush(false)
+				depth++
+			case c == ')':
+				flush(false)
+				if depth == 0 {
+					return nil, fmt.Errorf("zone file line %d: unbalanced parenthesis", lineNo)
+				}
+				depth--
+			case c == ' ' || c == '\t':
+				flush(false)
+			default:
+				word.WriteByte(c)
+				raw.WriteByte(c)
+				inWord = true
+			}
+		}
+		if inQuotes {
+			return nil, fmt.Errorf("zone file line %d: unterminated quoted string", lineNo)
+		}
+		flush(false)
+
+		if depth == 0 && len(current.tokens) > 0 {
+			entries = append(entries, *current)
+		}
+	}
+
+	err := scanner.Err()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zone file: %w", err)
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("zone file line %d: unbalanced parenthesis", current.line)
+	}
+
+	return entries, nil
+}
+
+// zoneFileEscape decodes the escape at the start of s, returning the byte it
+// stands for and its length.
+func zoneFileEscape(s string) (byte, int, error) {
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("incomplete escape %q", s)
+	}
+	if s[1] < '0' || s[1] > '9' {
+		return s[1], 2, nil
+	}
+
+	if len(s) < 4 {
+		return 0, 0, fmt.Errorf("invalid escape %q", s)
+	}
+	n, err := strconv.ParseUint(s[1:4], 10, 8)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid escape %q", s[:4])
+	}
+
+	return byte(n), 4, nil
+}
+
+// zoneFileName resolves a name of a zone file against the origin.
+func zoneFileName(name, origin string) string {
+	switch {
+	case name == "@":
+		return origin
+	case strings.HasSuffix(name, "."):
+		return name
+	default:
+		return name + "." + origin
+	}
+}
+
+// parseZoneFileTTL parses a TTL given in seconds or with BIND's unit suffixes, e.g. "1h30m".
+func parseZoneFileTTL(s string) (time.Duration, error) {
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(n) * time.Second, nil
+	}
+
+	units := map[byte]time.Duration{
+		's': time.Second, 'm': time.Minute, 'h': time.Hour, 'd': 24 * time.Hour, 'w': 7 * 24 * time.Hour,
+	}
+
+	var ttl time.Duration
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] >= '0' && s[i] <= '9' {
+			continue
+		}
+
+		unit, ok := units[s[i]|0x20]
+		if !ok || i == start {
+			return 0, fmt.Errorf("invalid TTL %q", s)
+		}
+
+		n, _ := strconv.Atoi(s[start:i])
+		ttl += time.Duration(n) * unit
+		start = i + 1
+	}
+	if start != len(s) || s == "" {
+		return 0, fmt.Errorf("invalid TTL %q", s)
+	}
+
+	return ttl, nil
+}
+
+// zoneFileData renders the data tokens of a record the way libdns expects them:
+// the strings of a TXT record are concatenated, and the names that other types
+// point at are made fully-qualified.
+func zoneFileData(rrType string, tokens []zoneFileToken, origin string) string {
+	if rrType == "TXT" || rrType == "SPF" {
+		var text strings.Builder
+		for _, tok := range tokens {
+			text.WriteString(tok.text)
+		}
+		return text.String()
+	}
+
+	parts := make([]string, len(tokens))
+	for i, tok := range tokens {
+		parts[i] = tok.raw
+		if tok.quoted {
+			parts[i] = zoneFileQuote(tok.text)
+		}
+	}
+
+	// The last field of these types is a domain name
+	switch rrType {
+	case "CNAME", "NS", "PTR", "MX", "SRV", "ALIAS":
+		last := len(parts) - 1
+		if !tokens[last].quoted && parts[last] != "." {
+			parts[last] = zoneFileName(parts[last], origin)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// ExportZoneFile writes the records of the zone to w in the BIND master-file
+// format, e.g. to back the zone up. Names are written relative to the zone, with
+// "@" for the apex, and the domain names records point at are fully-qualified.
+func (p *Provider) ExportZoneFile(ctx context.Context, zone string, w io.Writer) error {
+	records, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "$ORIGIN %s.\n", strings.TrimSuffix(zone, "."))
+	for _, rec := range records {
+		rr := rec.RR()
+		fmt.Fprintf(bw, "%s\t%d\tIN\t%s\t%s\n", apiName(zone, rr.Name), int(rr.TTL.Seconds()), rr.Type, zoneFileRData(rr))
+	}
+
+	return bw.Flush()
+}
+
+// zoneFileRData renders the data of a record for a zone file.
+func zoneFileRData(rr libdns.RR) string {
+	switch rr.Type {
+	case "TXT", "SPF":
+		return quoteTXT(rr.Data)
+	case "CNAME", "NS", "PTR", "MX", "SRV", "ALIAS":
+		// A bare name would be read back relative to $ORIGIN
+		fields := strings.Fields(rr.Data)
+		if len(fields) == 0 {
+			return rr.Data
+		}
+		last := len(fields) - 1
+		if !strings.HasSuffix(fields[last], ".") && fields[last] != "@" {
+			fields[last] += "."
+		}
+		return strings.Join(fields, " ")
+	default:
+		return rr.Data
+	}
+}
+
+// quoteTXT quotes the text of a TXT record, splitting it into strings of at most
+// 255 bytes as the DNS requires.
+func quoteTXT(text string) string {
+	if text == "" {
+		return `""`
+	}
+
+	var chunks []string
+	for len(text) > 0 {
+		n := min(len(text), 255)
+		chunks = append(chunks, zoneFileQuote(text[:n]))
+		text = text[n:]
+	}
+
+	return strings.Join(chunks, " ")
+}
+
+// zoneFileQuote quotes s as a zone file character string, escaping quotes and
+// backslashes, and control characters as "\DDD".
+func zoneFileQuote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
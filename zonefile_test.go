@@ -0,0 +1,273 @@
+package tecnocratica
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+const testZoneFile = `$ORIGIN example.com.
+$TTL 1h
+@       IN  SOA ns1.provider.net. hostmaster.example.com. (
+                2024010101 ; serial
+                7200 3600 1209600 300 )
+@           NS  ns1.provider.net.
+@           NS  ns2.provider.net.
+@       300 IN  A   192.0.2.1
+            IN  AAAA 2001:db8::1
+www         CNAME @
+@           MX  10 mail
+mail    IN 600  A   192.0.2.25
+@           TXT "v=spf1 mx" " -all" ; split in two strings
+_sip._tcp   SRV 10 20 5060 sip.example.com.
+@           CAA 0 issue "letsencrypt.org"
+$ORIGIN sub.example.com.
+host        A   192.0.2.7
+`
+
+func TestParseZoneFile(t *testing.T) {
+	rrs, err := parseZoneFile(strings.NewReader(testZoneFile), "example.com")
+	if err != nil {
+		t.Fatalf("parseZoneFile() error = %v", err)
+	}
+
+	want := []libdns.RR{
+		{Name: "example.com.", Type: "SOA", TTL: time.Hour, Data: "ns1.provider.net. hostmaster.example.com. 2024010101 7200 3600 1209600 300"},
+		{Name: "example.com.", Type: "NS", TTL: time.Hour, Data: "ns1.provider.net."},
+		{Name: "example.com.", Type: "NS", TTL: time.Hour, Data: "ns2.provider.net."},
+		{Name: "example.com.", Type: "A", TTL: 5 * time.Minute, Data: "192.0.2.1"},
+		{Name: "example.com.", Type: "AAAA", TTL: time.Hour, Data: "2001:db8::1"},
+		{Name: "www.example.com.", Type: "CNAME", TTL: time.Hour, Data: "example.com."},
+		{Name: "example.com.", Type: "MX", TTL: time.Hour, Data: "10 mail.example.com."},
+		{Name: "mail.example.com.", Type: "A", TTL: 10 * time.Minute, Data: "192.0.2.25"},
+		{Name: "example.com.", Type: "TXT", TTL: time.Hour, Data: "v=spf1 mx -all"},
+		{Name: "_sip._tcp.example.com.", Type: "SRV", TTL: time.Hour, Data: "10 20 5060 sip.example.com."},
+		{Name: "example.com.", Type: "CAA", TTL: time.Hour, Data: `0 issue "letsencrypt.org"`},
+		{Name: "host.sub.example.com.", Type: "A", TTL: time.Hour, Data: "192.0.2.7"},
+	}
+
+	if !slices.Equal(rrs, want) {
+		t.Errorf("parseZoneFile() =\n%v\nwant\n%v", rrs, want)
+	}
+}
+
+func TestParseZoneFileEscapes(t *testing.T) {
+	const file = `$ORIGIN example.com.
+@       TXT   "caf\195\169 \"quoted\"; not a comment"
+note    TXT   semi\;colon\032space ; a comment
+@       CAA   0 issue "ca.example.net; account=\"1\""
+esc\.dot CNAME target
+`
+
+	rrs, err := parseZoneFile(strings.NewReader(file), "example.com")
+	if err != nil {
+		t.Fatalf("parseZoneFile() error = %v", err)
+	}
+
+	want := []libdns.RR{
+		{Name: "example.com.", Type: "TXT", Data: `café "quoted"; not a comment`},
+		{Name: "note.example.com.", Type: "TXT", Data: "semi;colon space"},
+		{Name: "example.com.", Type: "CAA", Data: `0 issue "ca.example.net; account=\"1\""`},
+		{Name: `esc\.dot.example.com.`, Type: "CNAME", Data: "target.example.com."},
+	}
+
+	if !slices.Equal(rrs, want) {
+		t.Errorf("parseZoneFile() =\n%v\nwant\n%v", rrs, want)
+	}
+
+	// Control characters are written as \DDD and read back unchanged
+	rr := libdns.RR{Name: "example.com.", Type: "TXT", Data: "tab\there \\ \"x\""}
+	quoted := zoneFileRData(rr)
+	if quoted != `"tab\009here \\ \"x\""` {
+		t.Errorf("zoneFileRData() = %s", quoted)
+	}
+
+	rrs, err = parseZoneFile(strings.NewReader("@ TXT "+quoted+"\n"), "example.com")
+	if err != nil {
+		t.Fatalf("parseZoneFile() error = %v", err)
+	}
+	if len(rrs) != 1 || rrs[0].Data != rr.Data {
+		t.Errorf("reparsed TXT = %v, want data %q", rrs, rr.Data)
+	}
+}
+
+func TestParseZoneFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+	}{
+		{name: "unbalanced parenthesis", file: "@ SOA ns1. host. ( 1 2 3 4 5\n"},
+		{name: "unterminated string", file: "@ TXT \"v=spf1\n"},
+		{name: "missing data", file: "www 3600 IN A\n"},
+		{name: "no owner", file: "  A 192.0.2.1\n"},
+		{name: "include", file: "$INCLUDE other.zone\n"},
+		{name: "escape out of range", file: "@ TXT \"a\\256\"\n"},
+		{name: "short escape", file: "@ TXT \"a\\12\"\n"},
+		{name: "dangling escape", file: "@ TXT a\\\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseZoneFile(strings.NewReader(tt.file), "example.com")
+			if err == nil {
+				t.Error("parseZoneFile() error = nil")
+			}
+		})
+	}
+}
+
+func TestProvider_AppendFromZoneFile(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []ZoneFileOption
+		wantN int
+	}{
+		{
+			name:  "apex NS skipped by default",
+			wantN: 9,
+		},
+		{
+			name:  "apex NS imported on request",
+			opts:  []ZoneFileOption{ImportApexNS()},
+			wantN: 11,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var created []Record
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/dns/zones" {
+					w.WriteHeader(http.StatusOK)
+					_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+					return
+				}
+
+				var req RecordsRequest
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				for i := range req.Records {
+					req.Records[i].ID = len(created) + 1
+					created = append(created, req.Records[i])
+				}
+				w.WriteHeader(http.StatusCreated)
+				_ = json.NewEncoder(w).Encode(req.Records)
+			}))
+			defer server.Close()
+
+			p := &Provider{
+				APIToken:          "test-token",
+				APIURL:            server.URL,
+				AllowInsecureHTTP: true,
+				BulkCreate:        true,
+			}
+
+			records, err := p.AppendFromZoneFile(context.Background(), "example.com", strings.NewReader(testZoneFile), tt.opts...)
+			if err != nil {
+				t.Fatalf("AppendFromZoneFile() error = %v", err)
+			}
+
+			if len(records) != tt.wantN || len(created) != tt.wantN {
+				t.Fatalf("AppendFromZoneFile() returned %d records and created %d, want %d", len(records), len(created), tt.wantN)
+			}
+
+			for _, rec := range created {
+				if rec.Type == "SOA" {
+					t.Errorf("AppendFromZoneFile() created the SOA record")
+				}
+			}
+
+			wantFirst := Record{ID: created[0].ID, Name: "@", Type: "A", Content: "192.0.2.1", TTL: 300}
+			if tt.opts != nil {
+				wantFirst = Record{ID: created[0].ID, Name: "@", Type: "NS", Content: "ns1.provider.net.", TTL: 3600}
+			}
+			if created[0] != wantFirst {
+				t.Errorf("first created record = %+v, want %+v", created[0], wantFirst)
+			}
+
+			var gotMX, gotTXT, gotHost bool
+			for _, rec := range created {
+				gotMX = gotMX || (rec.Type == "MX" && rec.Priority == 10 && rec.Content == "mail.example.com.")
+				gotTXT = gotTXT || (rec.Type == "TXT" && rec.Content == "v=spf1 mx -all")
+				gotHost = gotHost || (rec.Type == "A" && rec.Name == "host.sub")
+			}
+			if !gotMX || !gotTXT || !gotHost {
+				t.Errorf("created records %+v lack the MX, TXT or sub-origin record", created)
+			}
+		})
+	}
+}
+
+func TestProvider_ExportZoneFile(t *testing.T) {
+	longText := strings.Repeat("k", 300)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/dns/zones" {
+			w.WriteHeader(http.StatusOK)
+			_ = json.NewEncoder(w).Encode([]Zone{{ID: 1, Name: "example.com"}})
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode([]Record{
+			{ID: 1, Name: "@", Type: "A", Content: "192.0.2.1", TTL: 300},
+			{ID: 2, Name: "www", Type: "CNAME", Content: "example.com", TTL: 3600},
+			{ID: 3, Name: "@", Type: "MX", Content: "mail.example.com", TTL: 3600, Priority: 10},
+			{ID: 4, Name: "_sip._tcp", Type: "SRV", Content: "20 5060 sip.example.com", TTL: 3600, Priority: 5},
+			{ID: 5, Name: "@", Type: "TXT", Content: `v=spf1 include:"quoted" -all`, TTL: 600},
+			{ID: 6, Name: "dkim", Type: "TXT", Content: longText, TTL: 600},
+			{ID: 7, Name: "@", Type: "CAA", Content: `0 issue "letsencrypt.org"`, TTL: 3600},
+		})
+	}))
+	defer server.Close()
+
+	p := &Provider{
+		APIToken:          "test-token",
+		APIURL:            server.URL,
+		AllowInsecureHTTP: true,
+	}
+
+	var out strings.Builder
+
+	err := p.ExportZoneFile(context.Background(), "example.com.", &out)
+	if err != nil {
+		t.Fatalf("ExportZoneFile() error = %v", err)
+	}
+
+	for _, line := range []string{
+		"$ORIGIN example.com.\n",
+		"@\t300\tIN\tA\t192.0.2.1\n",
+		"@\t3600\tIN\tMX\t10 mail.example.com.\n",
+		"@\t600\tIN\tTXT\t\"v=spf1 include:\\\"quoted\\\" -all\"\n",
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("ExportZoneFile() output lacks %q:\n%s", line, out.String())
+		}
+	}
+
+	// Reading the file back must give the records of the zone
+	rrs, err := parseZoneFile(strings.NewReader(out.String()), "example.com")
+	if err != nil {
+		t.Fatalf("parseZoneFile() error = %v\n%s", err, out.String())
+	}
+
+	want := []libdns.RR{
+		{Name: "example.com.", Type: "A", TTL: 5 * time.Minute, Data: "192.0.2.1"},
+		{Name: "www.example.com.", Type: "CNAME", TTL: time.Hour, Data: "example.com."},
+		{Name: "example.com.", Type: "MX", TTL: time.Hour, Data: "10 mail.example.com."},
+		{Name: "_sip._tcp.example.com.", Type: "SRV", TTL: time.Hour, Data: "5 20 5060 sip.example.com."},
+		{Name: "example.com.", Type: "TXT", TTL: 10 * time.Minute, Data: `v=spf1 include:"quoted" -all`},
+		{Name: "dkim.example.com.", Type: "TXT", TTL: 10 * time.Minute, Data: longText},
+		{Name: "example.com.", Type: "CAA", TTL: time.Hour, Data: `0 issue "letsencrypt.org"`},
+	}
+
+	if !slices.Equal(rrs, want) {
+		t.Errorf("reparsed zone file =\n%v\nwant\n%v", rrs, want)
+	}
+}